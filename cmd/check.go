@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hot-coffee/internal/flags"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
+	"log/slog"
+)
+
+// check reports the integrity issues in the data and, with --fix, repairs
+// what it can. It fails when issues are left unfixed.
+func check(store *repository.Store, operands []string) error {
+	integrityService := service.NewIntegrityServiceImpl(repository.NewIntegrityRepoImpl(store), service.NewUnitOfWork(store.Begin))
+
+	report, err := integrityService.CheckIntegrityServ(*flags.FIX)
+	if err != nil {
+		slog.Error("Failed to check the data integrity", "error", err)
+		return err
+	}
+
+	if len(report.Issues) == 0 {
+		fmt.Println("No issues found")
+		return nil
+	}
+	for _, issue := range report.Issues {
+		line := fmt.Sprintf("%-18s  %s/%s: %s", issue.Kind, issue.Collection, issue.ID, issue.Detail)
+		switch {
+		case issue.Fixed:
+			line += " (fixed: " + issue.Fix + ")"
+		case issue.Fix != "":
+			line += " (--fix would " + issue.Fix + ")"
+		default:
+			line += " (fix by hand)"
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("\n%d issues, %d fixed\n", len(report.Issues), report.Fixed)
+
+	if report.Fixed < len(report.Issues) {
+		return errors.New("integrity issues left")
+	}
+	return nil
+}
@@ -1,21 +1,66 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"hot-coffee/internal/flags"
+	"hot-coffee/internal/models"
+	"hot-coffee/internal/repository"
 	"hot-coffee/internal/router"
-	"log"
+	"hot-coffee/internal/service"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// command is a subcommand hot-coffee accepts before its flags. Operands are
+// the arguments between the command name and the flags.
+type command struct {
+	run                      func(store *repository.Store, operands []string) error
+	minOperands, maxOperands int
+}
+
+// commands are the subcommands of hot-coffee. Without one it serves the API.
+var commands = map[string]command{
+	"serve":     {run: serve},
+	"rebuild":   {run: rebuild},
+	"snapshot":  {run: createSnapshot, maxOperands: 1},
+	"snapshots": {run: listSnapshots},
+	"restore":   {run: restoreSnapshot, minOperands: 1, maxOperands: 1},
+	"check":     {run: check},
+}
+
 func main() {
-	flag.Parse()
-	args := os.Args[1:]
+	name, args := "serve", os.Args[1:]
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, exists := commands[name]
+	if !exists {
+		fmt.Printf("Unknown command %q\n", name)
+		flags.HelpShow()
+		os.Exit(1)
+	}
+
+	var operands []string
+	for len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		operands, args = append(operands, args[0]), args[1:]
+	}
+	if len(operands) < cmd.minOperands || len(operands) > cmd.maxOperands {
+		fmt.Println("bad input")
+		flags.HelpShow()
+		os.Exit(1)
+	}
+	flag.CommandLine.Parse(args)
 
 	if len(args) != 0 {
 		if !(flags.ArgsCheck(args)) {
@@ -43,15 +88,96 @@ func main() {
 		}
 	}
 
+	if !slices.Contains(repository.DriverNames(), *flags.STORAGE) {
+		fmt.Printf("Unknown storage driver %q, available: %v\n", *flags.STORAGE, repository.DriverNames())
+		os.Exit(1)
+	}
+
+	if *flags.IDEMPOTENCY_TTL <= 0 {
+		fmt.Println("The idempotency TTL should be positive, such as 24h or 30m")
+		os.Exit(1)
+	}
+
+	if !slices.Contains(models.OrderIDStrategies(), *flags.ORDER_IDS) {
+		fmt.Printf("Unknown order ID strategy %q, available: %v\n", *flags.ORDER_IDS, models.OrderIDStrategies())
+		os.Exit(1)
+	}
+
 	fmt.Printf("The files will be stored at: %s\n", absDir)
-	fmt.Printf("Starting server on port %d ...\n", *flags.PORT)
+	fmt.Printf("Using the %s storage driver\n", *flags.STORAGE)
 
-	mux, err := router.SetupRoutes()
+	if *flags.MIGRATE_DRY_RUN {
+		if err := migrateDryRun(*flags.STORAGE, absDir); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	store, err := repository.OpenStore(*flags.STORAGE, absDir, *flags.ORDER_IDS)
 	if err != nil {
-		slog.Error("Failed to set up routes", "error", err)
+		slog.Error("Failed to open the data store", "error", err)
 		os.Exit(1)
 	}
 
+	runErr := cmd.run(store, operands)
+
+	if err := store.Close(); err != nil {
+		slog.Error("Failed to close the data store", "error", err)
+		os.Exit(1)
+	}
+	if runErr != nil {
+		os.Exit(1)
+	}
+}
+
+func serve(store *repository.Store, operands []string) error {
+	deliveries, err := repository.OpenDeliveryLog(store)
+	if err != nil {
+		slog.Error("Failed to open the webhook delivery log", "error", err)
+		return err
+	}
+	defer deliveries.Close()
+
+	// Webhooks are sent from the background once a transaction commits.
+	dispatcher := service.NewWebhookDispatcher(repository.NewWebhookRepoImpl(store), repository.NewJournalRepoImpl(store), deliveries)
+	store.OnCommit(dispatcher.Notify)
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
+	idempotency, err := repository.OpenIdempotencyLog(store)
+	if err != nil {
+		slog.Error("Failed to open the idempotency log", "error", err)
+		return err
+	}
+	defer idempotency.Close()
+
+	broadcaster := service.NewBroadcaster()
+	mux := router.SetupRoutes(store, broadcaster, deliveries, idempotency, *flags.IDEMPOTENCY_TTL)
+
+	fmt.Printf("Starting server on port %d ...\n", *flags.PORT)
+
 	portStr := ":" + strconv.Itoa(*flags.PORT)
-	log.Fatal(http.ListenAndServe(portStr, mux))
+	server := &http.Server{Addr: portStr, Handler: mux}
+	// Shutdown does not wait for streams to end by themselves.
+	server.RegisterOnShutdown(broadcaster.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down the server", "error", err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Server failed", "error", err)
+		return err
+	}
+
+	slog.Info("Server stopped")
+	return nil
 }
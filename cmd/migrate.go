@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"hot-coffee/internal/repository"
+	"log/slog"
+)
+
+// migrateDryRun prints the migrations the next start would apply to the data
+// without changing it.
+func migrateDryRun(storage, dir string) error {
+	version, steps, err := repository.PlanMigrations(storage, dir)
+	if err != nil {
+		slog.Error("Failed to plan the data migrations", "error", err)
+		return err
+	}
+
+	if len(steps) == 0 {
+		fmt.Printf("The data is at schema version %d, nothing to migrate\n", version)
+		return nil
+	}
+
+	fmt.Printf("The data is at schema version %d and would be migrated to %d:\n", version, repository.SchemaVersion)
+	for _, step := range steps {
+		fmt.Printf("\nv%d: %s (%d changed)\n", step.Version, step.Description, len(step.Changes))
+		for _, change := range step.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
+	"log/slog"
+)
+
+// rebuild regenerates the orders, menu, inventory, promotions, settings,
+// webhooks and customers by replaying the event journal from the start.
+func rebuild(store *repository.Store, operands []string) error {
+	journalService := service.NewJournalServiceImpl(repository.NewJournalRepoImpl(store), service.NewUnitOfWork(store.Begin))
+
+	count, err := journalService.RebuildService()
+	if err != nil {
+		slog.Error("Failed to rebuild from the event journal", "error", err)
+		return err
+	}
+
+	fmt.Printf("Replayed %d events from the journal\n", count)
+	return nil
+}
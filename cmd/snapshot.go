@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
+	"log/slog"
+)
+
+// The snapshot commands work on a data directory no server is running on;
+// while one is, use the /admin/snapshots endpoints instead.
+
+func newSnapshotService(store *repository.Store) *service.SnapshotServiceImpl {
+	return service.NewSnapshotServiceImpl(repository.NewSnapshotRepoImpl(store))
+}
+
+// createSnapshot archives the data directory, with an optional note.
+func createSnapshot(store *repository.Store, operands []string) error {
+	var note string
+	if len(operands) != 0 {
+		note = operands[0]
+	}
+
+	snapshot, err := newSnapshotService(store).CreateSnapshotServ(note)
+	if err != nil {
+		slog.Error("Failed to create a snapshot", "error", err)
+		return err
+	}
+
+	fmt.Printf("Created snapshot %s (%d bytes)\n", snapshot.ID, snapshot.Size)
+	return nil
+}
+
+func listSnapshots(store *repository.Store, operands []string) error {
+	snapshots, err := newSnapshotService(store).GetSnapshotsServ()
+	if err != nil {
+		slog.Error("Failed to list the snapshots", "error", err)
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots")
+		return nil
+	}
+	for _, snapshot := range snapshots {
+		fmt.Printf("%s  %s  %-6s  %8d bytes  %s\n", snapshot.ID, snapshot.CreatedAt.Local().Format("2006-01-02 15:04:05"), snapshot.Storage, snapshot.Size, snapshot.Note)
+	}
+	return nil
+}
+
+func restoreSnapshot(store *repository.Store, operands []string) error {
+	snapshot, err := newSnapshotService(store).RestoreSnapshotServ(operands[0])
+	if err != nil {
+		slog.Error("Failed to restore the snapshot", "error", err)
+		return err
+	}
+
+	fmt.Printf("Restored snapshot %s\n", snapshot.ID)
+	return nil
+}
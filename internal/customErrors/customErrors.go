@@ -1,15 +1,55 @@
 package customErrors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
-	ErrInvalidInput     = errors.New("invalid input: missing required field")
-	ErrJsonOpen         = errors.New("error opening JSON file")
-	ErrJsonRead         = errors.New("error reading JSON file")
-	ErrJsonWrite        = errors.New("error writing JSON file")
-	ErrJsonUnmarshal    = errors.New("error unmarshalling Json")
-	ErrJsonMarshal      = errors.New("error marshalling JSON")
-	ErrExistConflict    = errors.New("already exist")
-	ErrNotExistConflict = errors.New("doesn't exist")
-	ErrOrderClosed      = errors.New("the order is already closed")
+	ErrInvalidInput       = errors.New("invalid input: missing required field")
+	ErrJsonOpen           = errors.New("error opening JSON file")
+	ErrJsonRead           = errors.New("error reading JSON file")
+	ErrJsonWrite          = errors.New("error writing JSON file")
+	ErrJsonUnmarshal      = errors.New("error unmarshalling Json")
+	ErrJsonMarshal        = errors.New("error marshalling JSON")
+	ErrExistConflict      = errors.New("already exist")
+	ErrNotExistConflict   = errors.New("doesn't exist")
+	ErrOrderClosed        = errors.New("the order is already closed")
+	ErrTxDone             = errors.New("transaction has already been committed or rolled back")
+	ErrUnknownStorage     = errors.New("unknown storage driver")
+	ErrSchemaVersion      = errors.New("unsupported data schema")
+	ErrNotSupported       = errors.New("not supported by the storage driver")
+	ErrOrderNotEditable   = errors.New("the order can no longer be changed")
+	ErrInvalidTransition  = errors.New("invalid order status transition")
+	ErrInsufficientStock  = errors.New("insufficient ingredient in inventory")
+	ErrInvalidPromotion   = errors.New("the promo code cannot be applied")
+	ErrPaymentDue         = errors.New("the payments do not cover the order total")
+	ErrNotRefundable      = errors.New("the order cannot be refunded")
+	ErrIdempotencyReused  = errors.New("the idempotency key was used for a different request")
+	ErrIdempotencyBusy    = errors.New("a request with the idempotency key is still in progress")
+	ErrIdempotencyUnknown = errors.New("a request with the idempotency key was not answered, it may or may not have been applied")
+	ErrInsufficientPoints = errors.New("not enough loyalty points")
+	ErrInvalidQuery       = errors.New("invalid query")
+	ErrOrderNotDeletable  = errors.New("only cancelled or closed orders can be deleted")
 )
+
+// TransitionError is returned for an order status change the order lifecycle
+// does not allow. Allowed lists the statuses the order can change to instead.
+type TransitionError struct {
+	OrderID string   `json:"order_id"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Allowed []string `json:"allowed"`
+}
+
+func (e *TransitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("%s: order %s is %s and cannot change anymore", ErrInvalidTransition, e.OrderID, e.From)
+	}
+	return fmt.Sprintf("%s: order %s cannot go from %s to %s, only to %s", ErrInvalidTransition, e.OrderID, e.From, e.To, strings.Join(e.Allowed, ", "))
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
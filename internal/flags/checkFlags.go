@@ -1,29 +1,46 @@
 package flags
 
-import "os"
-
-func ArgsCheck(args []string) bool {
-	if len(args) > 4 {
-		return false
-	}
-
-	if len(args) == 1 && !(args[0] == "-help" || args[0] == "--help") {
-		return false
-	}
+import (
+	"os"
+	"strings"
+)
+
+// valueFlags are the flags that take a value; each may be given once.
+var valueFlags = map[string]bool{
+	"port":            true,
+	"dir":             true,
+	"storage":         true,
+	"order-ids":       true,
+	"idempotency-ttl": true,
+}
 
-	if len(args) == 2 && !(args[0] == "-port" || args[0] == "--port" || args[0] == "-dir" || args[0] == "--dir") {
-		return false
-	}
+// boolFlags are the flags given without a value.
+var boolFlags = map[string]bool{
+	"migrate-dry-run": true,
+	"fix":             true,
+}
 
-	if len(args) == 3 {
-		return false
+func ArgsCheck(args []string) bool {
+	if len(args) == 1 && (args[0] == "-help" || args[0] == "--help") {
+		return true
 	}
 
-	if len(args) == 4 {
-		if !(args[0] == "-port" || args[0] == "--port" || args[0] == "-dir" || args[0] == "--dir") {
+	seen := make(map[string]bool)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			return false
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(args[i], "-"), "-")
+		if seen[name] {
 			return false
 		}
-		if !(args[2] == "-port" || args[2] == "--port" || args[2] == "-dir" || args[2] == "--dir") {
+		seen[name] = true
+
+		switch {
+		case boolFlags[name]:
+		case valueFlags[name] && i+1 < len(args):
+			i++
+		default:
 			return false
 		}
 	}
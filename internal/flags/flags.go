@@ -4,26 +4,53 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 )
 
 var (
-	DIR  = flag.String("dir", "./data", "Path to the directory")
-	PORT = flag.Int("port", 8080, "Port number")
-	HELP = flag.Bool("help", false, "Show the help screen")
+	DIR             = flag.String("dir", "./data", "Path to the directory")
+	PORT            = flag.Int("port", 8080, "Port number")
+	STORAGE         = flag.String("storage", "json", "Storage driver: json, memory or log")
+	ORDER_IDS       = flag.String("order-ids", "orderN", "Order ID strategy: orderN, ulid or daily")
+	IDEMPOTENCY_TTL = flag.Duration("idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key are kept")
+	HELP            = flag.Bool("help", false, "Show the help screen")
+
+	MIGRATE_DRY_RUN = flag.Bool("migrate-dry-run", false, "Report the pending data migrations and exit")
+	FIX             = flag.Bool("fix", false, "Repair the issues found by the check command")
 )
 
 func HelpShow() {
-	fmt.Println(`Simple Storage Service.
+	fmt.Println(`Coffee Shop Management System.
 
 **Usage:**
-    triple-s [-port <N>] [-dir <S>]  
-    triple-s [-dir <S>] [-port <N>]  
-    triple-s --help
+    hot-coffee [serve] [--port <N>] [--dir <S>] [--storage <D>] [--order-ids <I>] [--idempotency-ttl <T>]
+    hot-coffee rebuild [--dir <S>] [--storage <D>]
+    hot-coffee snapshot [<note>] [--dir <S>] [--storage <D>]
+    hot-coffee snapshots [--dir <S>] [--storage <D>]
+    hot-coffee restore <snapshot_id> [--dir <S>] [--storage <D>]
+    hot-coffee check [--fix] [--dir <S>] [--storage <D>]
+    hot-coffee --migrate-dry-run [--dir <S>] [--storage <D>]
+    hot-coffee --help
+
+**Commands:**
+- serve        Run the server (default).
+- rebuild      Regenerate the data files by replaying the event journal.
+- snapshot     Archive the data directory to <dir>/snapshots.
+- snapshots    List the snapshots.
+- restore      Replace the data with the content of a snapshot.
+- check        Report dangling references, duplicate IDs, negative stock and
+               malformed order IDs; --fix repairs what it can.
 
 **Options:**
-- --help     Show this screen.
-- --port N   Port number
-- --dir S    Path to the directory`)
+- --help       Show this screen.
+- --port N     Port number
+- --dir S      Path to the directory
+- --storage D  Storage driver: json (default), memory or log
+- --order-ids I  How new orders are numbered: orderN (default, order1, order2, ...),
+               ulid, or daily (20241001-001, restarting every day)
+- --idempotency-ttl T  How long the response to a request with an Idempotency-Key
+               is replayed for its retries, such as 24h (default) or 30m
+- --migrate-dry-run  Report how the data would be migrated to the current schema and exit.`)
 
 	wd, _ := os.Getwd()
 	fmt.Printf("\nCurrent working directory: %v\n", wd)
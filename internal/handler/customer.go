@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+type CustomerServ interface {
+	CreateCustomerServ(customer models.Customer) (models.Customer, error)
+	GetCustomersServ(search string) ([]models.Customer, error)
+	GetCustomerServ(id string) (models.Customer, error)
+	UpdateCustomerServ(customer models.Customer) (models.Customer, error)
+	DeleteCustomerServ(id string) error
+	GetPointsServ(id string) (models.PointsLedger, error)
+	AdjustPointsServ(id string, points int, reason string) (models.PointsEntry, error)
+}
+
+type CustomerHandler struct {
+	customerServ CustomerServ
+}
+
+func NewCustomerHandler(cS CustomerServ) *CustomerHandler {
+	return &CustomerHandler{customerServ: cS}
+}
+
+func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in CreateCustomer: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	customer, err := models.NewCustomer(input)
+	if err != nil {
+		slog.Error("Handler Error in CreateCustomer: Invalid input data", "error", err)
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.customerServ.CreateCustomerServ(*customer)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrExistConflict) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in CreateCustomer: creating customer", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Customer created successfully", "customerID", created.ID)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// GetCustomers lists the customers by name. ?search= narrows them down to
+// those whose name, email or phone contain it.
+func (h *CustomerHandler) GetCustomers(w http.ResponseWriter, r *http.Request) {
+	customers, err := h.customerServ.GetCustomersServ(r.URL.Query().Get("search"))
+	if err != nil {
+		slog.Error("Handler Error in GetCustomers: retrieving all customers", "error", err)
+		writeError(w, "Failed to retrieve all customers", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("All customers retrieved successfully")
+	writeJSON(w, http.StatusOK, customers)
+}
+
+func (h *CustomerHandler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	customer, err := h.customerServ.GetCustomerServ(r.PathValue("id"))
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in GetCustomer: retrieving customer by ID", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Customer retrieved successfully", "customerID", customer.ID)
+	writeJSON(w, http.StatusOK, customer)
+}
+
+func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in UpdateCustomer: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+	input.ID = r.PathValue("id")
+
+	customer, err := models.NewCustomer(input)
+	if err != nil {
+		slog.Error("Handler Error in UpdateCustomer: Invalid input data", "error", err)
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.customerServ.UpdateCustomerServ(*customer)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrExistConflict) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in UpdateCustomer: updating customer", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Customer updated successfully", "customerID", updated.ID)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *CustomerHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
+	if err := h.customerServ.DeleteCustomerServ(r.PathValue("id")); err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in DeleteCustomer: deleting customer by ID", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	slog.Info("Customer deleted successfully")
+}
+
+// GetPoints returns the points balance of a customer and its ledger, newest
+// first.
+func (h *CustomerHandler) GetPoints(w http.ResponseWriter, r *http.Request) {
+	ledger, err := h.customerServ.GetPointsServ(r.PathValue("id"))
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in GetPoints: retrieving points", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Customer points retrieved successfully", "customerID", ledger.CustomerID)
+	writeJSON(w, http.StatusOK, ledger)
+}
+
+// AdjustPoints adds points to a customer by hand, or takes them with negative
+// points, for the given reason.
+func (h *CustomerHandler) AdjustPoints(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input struct {
+		Points int    `json:"points"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in AdjustPoints: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.customerServ.AdjustPointsServ(r.PathValue("id"), input.Points, input.Reason)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrInsufficientPoints) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in AdjustPoints: adjusting points", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Customer points adjusted successfully", "customerID", r.PathValue("id"), "points", entry.Points)
+	writeJSON(w, http.StatusCreated, entry)
+}
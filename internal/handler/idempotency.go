@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on a response given again for a
+	// retried request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+type IdempotencyServ interface {
+	BeginServ(key, fingerprint string) (*models.IdempotencyRecord, error)
+	FinishServ(key string, record *models.IdempotencyRecord) error
+}
+
+type IdempotencyHandler struct {
+	idempotencyServ IdempotencyServ
+}
+
+func NewIdempotencyHandler(iS IdempotencyServ) *IdempotencyHandler {
+	return &IdempotencyHandler{idempotencyServ: iS}
+}
+
+// Wrap makes the POST, PUT, PATCH and DELETE requests sent with an
+// Idempotency-Key header run once. A retry with the same key, method, path
+// and body is given the stored response; the same key with another request
+// responds 422, and while the first request is still running or when its
+// response was never stored 409. Responses with a 5xx status are not stored,
+// so the request runs again when retried.
+func (h *IdempotencyHandler) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("Handler Error in Idempotency: reading the request body", "error", err)
+			writeError(w, "Failed to read the request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record, err := h.idempotencyServ.BeginServ(key, models.RequestFingerprint(r.Method, r.URL.RequestURI(), body))
+		if err != nil {
+			var status int
+			if errors.Is(err, customErrors.ErrInvalidInput) {
+				status = http.StatusBadRequest
+			} else if errors.Is(err, customErrors.ErrIdempotencyReused) {
+				status = http.StatusUnprocessableEntity
+			} else if errors.Is(err, customErrors.ErrIdempotencyBusy) || errors.Is(err, customErrors.ErrIdempotencyUnknown) {
+				status = http.StatusConflict
+			} else {
+				status = http.StatusInternalServerError
+			}
+			slog.Error("Handler Error in Idempotency: claiming the key", "error", err)
+			writeError(w, err.Error(), status)
+			return
+		}
+
+		if record != nil {
+			slog.Info("Replaying the stored response", "key", key, "status", record.Status)
+			if record.ContentType != "" {
+				w.Header().Set("Content-Type", record.ContentType)
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(record.Status)
+			w.Write(record.Body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		finished := false
+		defer func() {
+			// The handler panicked: let the request run again.
+			if !finished {
+				h.idempotencyServ.FinishServ(key, nil)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+
+		var response *models.IdempotencyRecord
+		if recorder.status < http.StatusInternalServerError {
+			response = &models.IdempotencyRecord{
+				Status:      recorder.status,
+				ContentType: recorder.Header().Get("Content-Type"),
+				Body:        recorder.body.Bytes(),
+			}
+		}
+		finished = true
+		if err := h.idempotencyServ.FinishServ(key, response); err != nil {
+			slog.Error("Handler Error in Idempotency: storing the response", "key", key, "error", err)
+		}
+	})
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+type IntegrityServ interface {
+	CheckIntegrityServ(fix bool) (models.IntegrityReport, error)
+}
+
+type IntegrityHandler struct {
+	integrityServ IntegrityServ
+}
+
+func NewIntegrityHandler(iS IntegrityServ) *IntegrityHandler {
+	return &IntegrityHandler{integrityServ: iS}
+}
+
+func (h *IntegrityHandler) GetIntegrity(w http.ResponseWriter, r *http.Request) {
+	report, err := h.integrityServ.CheckIntegrityServ(false)
+	if err != nil {
+		slog.Error("Handler Error in GetIntegrity: checking data integrity", "error", err)
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Data integrity checked", "issues", len(report.Issues))
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (h *IntegrityHandler) FixIntegrity(w http.ResponseWriter, r *http.Request) {
+	report, err := h.integrityServ.CheckIntegrityServ(true)
+	if err != nil {
+		slog.Error("Handler Error in FixIntegrity: fixing data integrity", "error", err)
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Data integrity fixed", "issues", len(report.Issues), "fixed", report.Fixed)
+	writeJSON(w, http.StatusOK, report)
+}
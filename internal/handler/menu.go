@@ -3,8 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"hotC/internal/customErrors"
-	"hotC/internal/models"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
 	"log/slog"
 	"net/http"
 )
@@ -37,7 +37,7 @@ func (h *MenuHandler) CreateMenu(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	menu, err := models.NewMenuItem(inputMenu.ID, inputMenu.Name, inputMenu.Description, inputMenu.Price, inputMenu.Ingredients)
+	menu, err := models.NewMenuItem(inputMenu.ID, inputMenu.Name, inputMenu.Description, inputMenu.Category, inputMenu.Price, inputMenu.Ingredients, inputMenu.Variants, inputMenu.ModifierGroups)
 	if err != nil {
 		slog.Error("Handler Error in CreateMenu: Invalid input data", "error", err)
 		writeError(w, err.Error(), http.StatusBadRequest)
@@ -124,7 +124,7 @@ func (h *MenuHandler) UpdateMenuId(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	menu, err := models.NewMenuItem(inputMenu.ID, inputMenu.Name, inputMenu.Description, inputMenu.Price, inputMenu.Ingredients)
+	menu, err := models.NewMenuItem(inputMenu.ID, inputMenu.Name, inputMenu.Description, inputMenu.Category, inputMenu.Price, inputMenu.Ingredients, inputMenu.Variants, inputMenu.ModifierGroups)
 	if err != nil {
 		slog.Error("Handler Error in UpdateMenuId: Invalid input data", "error", err)
 		writeError(w, err.Error(), http.StatusBadRequest)
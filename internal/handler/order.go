@@ -5,27 +5,36 @@ import (
 	"errors"
 	"hot-coffee/internal/customErrors"
 	"hot-coffee/internal/models"
+	"io"
 	"log/slog"
 	"net/http"
 	"time"
 )
 
 type OrderService interface {
-	CreateOrderService(newOrder models.Order) (models.TotalPrice, error)
-	GetOrdersService() ([]models.Order, error)
+	CreateOrderService(newOrder models.Order) (models.OrderTotals, error)
+	GetOrdersService(query models.OrderQuery) (models.OrderPage, error)
 	GetOrderByIdService(id string) (models.Order, error)
-	UpdateOrderByIdService(updateOrder models.Order) (models.TotalPrice, error)
+	UpdateOrderByIdService(updateOrder models.Order) (models.OrderTotals, error)
 	DeleteOrderByIdService(id string) error
-	CloseOrderByIdService(id string) error
+	CloseOrderByIdService(id string, payments []models.Payment) (models.OrderBill, error)
+	PayOrderService(id string, payments []models.Payment) (models.OrderBill, error)
+	RefundOrderService(id string, refund models.Refund) (models.Refund, error)
+	TransitionOrderService(id, status string) (models.Order, error)
+	CancelOrderService(id, reason string) (models.Order, error)
+	UpdateOrderItemsService(id string, ops []models.OrderItemOperation) (models.Order, error)
 }
 
 type OrderHandler struct {
 	orderService OrderService
+	// orderIDs is the order ID strategy order IDs in requests must follow.
+	orderIDs string
 }
 
-func NewOrderHandler(os OrderService) *OrderHandler {
+func NewOrderHandler(os OrderService, orderIDs string) *OrderHandler {
 	return &OrderHandler{
 		orderService: os,
+		orderIDs:     orderIDs,
 	}
 }
 
@@ -41,20 +50,42 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := models.NewOrder(inputOrder.CustomerName, time.Now(), inputOrder.Items)
+	order, err := models.NewOrder(inputOrder.CustomerName, inputOrder.CustomerID, time.Now(), inputOrder.Items)
 	if err != nil {
 		slog.Error("Handler Error in CreateOrderHandler: Invalid input data", "error", err)
 		writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	totalPrice, err := h.orderService.CreateOrderService(*order)
+	order.PromoCode = inputOrder.PromoCode
+	order.Priority = inputOrder.Priority
+	if order.Priority < 0 {
+		slog.Error("Handler Error in CreateOrderHandler: Invalid input data", "priority", order.Priority)
+		writeError(w, "The priority cannot be negative", http.StatusBadRequest)
+		return
+	}
+	order.RedeemPoints = inputOrder.RedeemPoints
+	if order.RedeemPoints < 0 {
+		slog.Error("Handler Error in CreateOrderHandler: Invalid input data", "redeem_points", order.RedeemPoints)
+		writeError(w, "The points to redeem cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	totals, err := h.orderService.CreateOrderService(*order)
 	if err != nil {
 		var status int
 		if errors.Is(err, customErrors.ErrExistConflict) {
 			status = http.StatusConflict
 		} else if errors.Is(err, customErrors.ErrNotExistConflict) {
 			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrInsufficientStock) {
+			status = http.StatusConflict
+		} else if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrInvalidPromotion) {
+			status = http.StatusUnprocessableEntity
+		} else if errors.Is(err, customErrors.ErrInsufficientPoints) {
+			status = http.StatusConflict
 		} else {
 			status = http.StatusInternalServerError
 		}
@@ -64,33 +95,47 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Info("Order created successfully", "orderID", order.ID)
-	writeJSON(w, http.StatusCreated, totalPrice)
+	writeJSON(w, http.StatusCreated, totals)
 }
 
+// GetOrders lists the orders selected by the query parameters a page at a
+// time. The link to the next page is given in the response and in a Link
+// header.
 func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
-	allOrders, err := h.orderService.GetOrdersService()
+	query, err := models.NewOrderQuery(r.URL.Query())
 	if err != nil {
-		slog.Error("Handler Error in GetOrders: retrieving all orders", "error", err)
-		writeError(w, "Failed to retrieve all orders", http.StatusInternalServerError)
+		var status int
+		if errors.Is(err, customErrors.ErrInvalidQuery) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in GetOrders: Invalid query", "error", err)
+		writeError(w, err.Error(), status)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	if err := json.NewEncoder(w).Encode(allOrders); err != nil {
-		slog.Error("Handler Error in GetOrders: encoding JSON data", "error", err)
-		writeError(w, "Failed to encode all orders to JSON", http.StatusInternalServerError)
-
+	page, err := h.orderService.GetOrdersService(*query)
+	if err != nil {
+		slog.Error("Handler Error in GetOrders: retrieving orders", "error", err)
+		writeError(w, "Failed to retrieve orders", http.StatusInternalServerError)
 		return
 	}
 
-	slog.Info("All orders retrieved successfully")
+	if page.NextCursor != "" {
+		params := r.URL.Query()
+		params.Set("cursor", page.NextCursor)
+		page.Next = r.URL.Path + "?" + params.Encode()
+		w.Header().Set("Link", "<"+page.Next+`>; rel="next"`)
+	}
+
+	slog.Info("Orders retrieved successfully", "orders", len(page.Orders))
+	writeJSON(w, http.StatusOK, page)
 }
 
 func (h *OrderHandler) GetOrderId(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	if !isValidID(w, id, "GetOrderByIdHandler", "get by id") {
+	if !isValidID(w, id, h.orderIDs, "GetOrderByIdHandler", "get by id") {
 		return
 	}
 
@@ -110,7 +155,7 @@ func (h *OrderHandler) GetOrderId(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	if err := json.NewEncoder(w).Encode(orderId); err != nil {
+	if err := json.NewEncoder(w).Encode(models.NewOrderView(orderId)); err != nil {
 		slog.Error("Handler Error in GetOrderId: encoding JSON data", "error", err)
 		writeError(w, "Failed to encode order to JSON", http.StatusInternalServerError)
 		return
@@ -126,7 +171,7 @@ func (h *OrderHandler) UpdateOrderId(w http.ResponseWriter, r *http.Request) {
 
 	id := r.PathValue("id")
 
-	if !isValidID(w, id, "UpdateOrderByIdHandler", "update") {
+	if !isValidID(w, id, h.orderIDs, "UpdateOrderByIdHandler", "update") {
 		return
 	}
 
@@ -137,7 +182,7 @@ func (h *OrderHandler) UpdateOrderId(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := models.NewOrder(inputOrder.CustomerName, time.Now(), inputOrder.Items)
+	order, err := models.NewOrder(inputOrder.CustomerName, inputOrder.CustomerID, time.Now(), inputOrder.Items)
 	if err != nil {
 		slog.Error("Handler Error in UpdateOrderId: Invalid input data", "error", err)
 		writeError(w, err.Error(), http.StatusBadRequest)
@@ -145,16 +190,37 @@ func (h *OrderHandler) UpdateOrderId(w http.ResponseWriter, r *http.Request) {
 	}
 
 	order.ID = id
+	order.PromoCode = inputOrder.PromoCode
+	order.Priority = inputOrder.Priority
+	if order.Priority < 0 {
+		slog.Error("Handler Error in UpdateOrderId: Invalid input data", "priority", order.Priority)
+		writeError(w, "The priority cannot be negative", http.StatusBadRequest)
+		return
+	}
+	order.RedeemPoints = inputOrder.RedeemPoints
+	if order.RedeemPoints < 0 {
+		slog.Error("Handler Error in UpdateOrderId: Invalid input data", "redeem_points", order.RedeemPoints)
+		writeError(w, "The points to redeem cannot be negative", http.StatusBadRequest)
+		return
+	}
 
-	totalPrice, err := h.orderService.UpdateOrderByIdService(*order)
+	totals, err := h.orderService.UpdateOrderByIdService(*order)
 	if err != nil {
 		var status int
 		if errors.Is(err, customErrors.ErrNotExistConflict) {
 			status = http.StatusNotFound
 		} else if errors.Is(err, customErrors.ErrOrderClosed) {
 			status = http.StatusBadRequest
-		} else if errors.Is(err, customErrors.ErrNotExistConflict) {
-			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrOrderNotEditable) {
+			status = http.StatusConflict
+		} else if errors.Is(err, customErrors.ErrInsufficientStock) {
+			status = http.StatusConflict
+		} else if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrInvalidPromotion) {
+			status = http.StatusUnprocessableEntity
+		} else if errors.Is(err, customErrors.ErrInsufficientPoints) {
+			status = http.StatusConflict
 		} else {
 			status = http.StatusInternalServerError
 		}
@@ -164,12 +230,60 @@ func (h *OrderHandler) UpdateOrderId(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Info("Order updated successfully", "orderID", order.ID)
-	writeJSON(w, http.StatusOK, totalPrice)
+	writeJSON(w, http.StatusOK, totals)
+}
+
+func (h *OrderHandler) UpdateOrderItems(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if !isValidID(w, id, h.orderIDs, "UpdateOrderItems", "update items") {
+		return
+	}
+
+	var input struct {
+		Operations []models.OrderItemOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in UpdateOrderItems: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderService.UpdateOrderItemsService(id, input.Operations)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrOrderClosed) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrOrderNotEditable) {
+			status = http.StatusConflict
+		} else if errors.Is(err, customErrors.ErrInsufficientStock) {
+			status = http.StatusConflict
+		} else if errors.Is(err, customErrors.ErrInvalidPromotion) {
+			status = http.StatusUnprocessableEntity
+		} else if errors.Is(err, customErrors.ErrInsufficientPoints) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in UpdateOrderItems: updating order items", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Order items updated successfully", "orderID", id)
+	writeJSON(w, http.StatusOK, models.NewOrderView(order))
 }
 
 func (h *OrderHandler) DeleteOrderId(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	if !isValidID(w, id, "DeleteOrderId", "delete") {
+	if !isValidID(w, id, h.orderIDs, "DeleteOrderId", "delete") {
 		return
 	}
 
@@ -179,6 +293,8 @@ func (h *OrderHandler) DeleteOrderId(w http.ResponseWriter, r *http.Request) {
 			status = http.StatusNotFound
 		} else if errors.Is(err, customErrors.ErrOrderClosed) {
 			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrOrderNotDeletable) {
+			status = http.StatusConflict
 		} else {
 			status = http.StatusInternalServerError
 		}
@@ -192,18 +308,41 @@ func (h *OrderHandler) DeleteOrderId(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Order deleted successfully")
 }
 
+// CloseOrderId closes the order, taking the payments in the body first. The
+// body is optional for an order that is already paid.
 func (h *OrderHandler) CloseOrderId(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	if !isValidID(w, id, "CloseOrderId", "close") {
+	if !isValidID(w, id, h.orderIDs, "CloseOrderId", "close") {
 		return
 	}
 
-	if err := h.orderService.CloseOrderByIdService(id); err != nil {
+	var input struct {
+		Payments []models.Payment `json:"payments"`
+	}
+	if r.ContentLength != 0 {
+		if !isJSONFile(w, r) {
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+			slog.Error("Handler Error in CloseOrderId: decoding JSON data", "error", err)
+			writeError(w, "Invalid JSON data", http.StatusBadRequest)
+			return
+		}
+	}
+
+	bill, err := h.orderService.CloseOrderByIdService(id, input.Payments)
+	if err != nil {
+		if writeTransitionError(w, err) {
+			slog.Error("Handler Error in CloseOrderId: closing order by ID ", "error", err)
+			return
+		}
 		var status int
 		if errors.Is(err, customErrors.ErrNotExistConflict) {
 			status = http.StatusNotFound
-		} else if errors.Is(err, customErrors.ErrOrderClosed) {
+		} else if errors.Is(err, customErrors.ErrOrderClosed) || errors.Is(err, customErrors.ErrInvalidInput) {
 			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrPaymentDue) || errors.Is(err, customErrors.ErrOrderNotEditable) {
+			status = http.StatusConflict
 		} else {
 			status = http.StatusInternalServerError
 		}
@@ -212,6 +351,184 @@ func (h *OrderHandler) CloseOrderId(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	slog.Info("Order closed successfully")
+	slog.Info("Order closed successfully", "orderID", id)
+	writeJSON(w, http.StatusOK, bill)
+}
+
+// PayOrderId takes payments for the order, closing it once a served order is
+// paid in full.
+func (h *OrderHandler) PayOrderId(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if !isValidID(w, id, h.orderIDs, "PayOrderId", "pay") {
+		return
+	}
+
+	var input struct {
+		Payments []models.Payment `json:"payments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in PayOrderId: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	bill, err := h.orderService.PayOrderService(id, input.Payments)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrOrderClosed) || errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrOrderNotEditable) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in PayOrderId: taking payments", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Order payments taken successfully", "orderID", id, "balance", bill.Balance)
+	writeJSON(w, http.StatusOK, bill)
+}
+
+func (h *OrderHandler) RefundOrderId(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if !isValidID(w, id, h.orderIDs, "RefundOrderId", "refund") {
+		return
+	}
+
+	var input models.Refund
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in RefundOrderId: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := h.orderService.RefundOrderService(id, input)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrNotRefundable) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in RefundOrderId: refunding order", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Order refunded successfully", "orderID", id, "refundID", refund.ID, "amount", refund.Amount)
+	writeJSON(w, http.StatusCreated, refund)
+}
+
+func (h *OrderHandler) TransitionOrderId(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if !isValidID(w, id, h.orderIDs, "TransitionOrderId", "transition") {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in TransitionOrderId: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderService.TransitionOrderService(id, input.Status)
+	if err != nil {
+		slog.Error("Handler Error in TransitionOrderId: changing order status", "error", err)
+		if writeTransitionError(w, err) {
+			return
+		}
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, customErrors.ErrPaymentDue) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Order status changed successfully", "orderID", id, "status", order.Status)
+	writeJSON(w, http.StatusOK, models.NewOrderView(order))
+}
+
+func (h *OrderHandler) CancelOrderId(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if !isValidID(w, id, h.orderIDs, "CancelOrderId", "cancel") {
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in CancelOrderId: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderService.CancelOrderService(id, input.Reason)
+	if err != nil {
+		slog.Error("Handler Error in CancelOrderId: cancelling order", "error", err)
+		if writeTransitionError(w, err) {
+			return
+		}
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Order cancelled successfully", "orderID", id, "reason", order.CancelReason)
+	writeJSON(w, http.StatusOK, models.NewOrderView(order))
+}
+
+// writeTransitionError answers 409 with the statuses the order could move to
+// instead, if err is a status change the order lifecycle does not allow.
+func writeTransitionError(w http.ResponseWriter, err error) bool {
+	var transitionErr *customErrors.TransitionError
+	if !errors.As(err, &transitionErr) {
+		return false
+	}
+	writeJSON(w, http.StatusConflict, struct {
+		Error string `json:"error"`
+		*customErrors.TransitionError
+	}{err.Error(), transitionErr})
+	return true
 }
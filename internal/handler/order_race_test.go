@@ -0,0 +1,197 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/models"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/router"
+	"hot-coffee/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestServer serves the routes over a store of driver.
+func newTestServer(t *testing.T, driver string) *httptest.Server {
+	t.Helper()
+
+	store, err := repository.OpenStore(driver, t.TempDir(), models.OrderIDSequential)
+	if err != nil {
+		t.Fatalf("opening the store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	deliveries, err := repository.OpenDeliveryLog(store)
+	if err != nil {
+		t.Fatalf("opening the delivery log: %v", err)
+	}
+	t.Cleanup(func() { deliveries.Close() })
+
+	idempotency, err := repository.OpenIdempotencyLog(store)
+	if err != nil {
+		t.Fatalf("opening the idempotency log: %v", err)
+	}
+	t.Cleanup(func() { idempotency.Close() })
+
+	broadcaster := service.NewBroadcaster()
+	t.Cleanup(broadcaster.Close)
+
+	server := httptest.NewServer(router.SetupRoutes(store, broadcaster, deliveries, idempotency, time.Hour))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// send sends body as JSON and decodes the response into out, if given. It
+// returns the status of the response.
+func send(t *testing.T, method, url string, body, out any) int {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Errorf("encoding the request: %v", err)
+		return 0
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("building the request: %v", err)
+		return 0
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("%s %s: %v", method, url, err)
+		return 0
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Errorf("%s %s: decoding the response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func mustSend(t *testing.T, method, url string, body, out any, want int) {
+	t.Helper()
+	if status := send(t, method, url, body, out); status != want {
+		t.Fatalf("%s %s: got status %d, want %d", method, url, status, want)
+	}
+}
+
+func inventoryQuantity(t *testing.T, url, id string) float64 {
+	t.Helper()
+	var item models.InventoryItem
+	mustSend(t, http.MethodGet, url+"/inventory/"+id, nil, &item, http.StatusOK)
+	return item.Quantity
+}
+
+// TestConcurrentOrders creates orders while others are cancelled, all at once,
+// and checks that every order created is kept and that the inventory moved by
+// exactly what they took and gave back, with every storage driver.
+func TestConcurrentOrders(t *testing.T) {
+	for _, driver := range repository.DriverNames() {
+		t.Run(driver, func(t *testing.T) {
+			testConcurrentOrders(t, driver)
+		})
+	}
+}
+
+func testConcurrentOrders(t *testing.T, driver string) {
+	const (
+		shots     = 100
+		milk      = 100000
+		cancelled = 20
+		created   = 120
+	)
+
+	server := newTestServer(t, driver)
+	url := server.URL
+
+	mustSend(t, http.MethodPost, url+"/inventory", models.InventoryItem{IngredientID: "espresso_shot", Name: "Espresso Shot", Quantity: shots, Unit: "shots"}, nil, http.StatusCreated)
+	mustSend(t, http.MethodPost, url+"/inventory", models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: milk, Unit: "ml"}, nil, http.StatusCreated)
+	mustSend(t, http.MethodPost, url+"/menu", models.MenuItem{ID: "latte", Name: "Latte", Price: 3.5, Ingredients: []models.MenuItemIngredient{{IngredientID: "espresso_shot", Quantity: 1}, {IngredientID: "milk", Quantity: 200}}}, nil, http.StatusCreated)
+	mustSend(t, http.MethodPost, url+"/menu", models.MenuItem{ID: "espresso", Name: "Espresso", Price: 2, Ingredients: []models.MenuItemIngredient{{IngredientID: "espresso_shot", Quantity: 1}}}, nil, http.StatusCreated)
+
+	order := func(productID string) map[string]any {
+		return map[string]any{
+			"customer_name": "Racer",
+			"items":         []map[string]any{{"product_id": productID, "quantity": 1}},
+		}
+	}
+
+	toCancel := make([]string, cancelled)
+	for i := range toCancel {
+		var totals models.OrderTotals
+		mustSend(t, http.MethodPost, url+"/orders", order("latte"), &totals, http.StatusCreated)
+		toCancel[i] = totals.OrderID
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		ok      int
+		refused int
+	)
+	for i := 0; i < created; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := send(t, http.MethodPost, url+"/orders", order("espresso"), nil)
+			mu.Lock()
+			defer mu.Unlock()
+			switch status {
+			case http.StatusCreated:
+				ok++
+			case http.StatusConflict:
+				refused++
+			default:
+				t.Errorf("POST /orders: got status %d", status)
+			}
+		}()
+	}
+	for _, id := range toCancel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status := send(t, http.MethodPost, url+"/orders/"+id+"/cancel", map[string]string{"reason": models.CancelReasonMistake}, nil); status != http.StatusOK {
+				t.Errorf("POST /orders/%s/cancel: got status %d", id, status)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	// The cancelled lattes give back their shots, so at least the shots left
+	// after them can be sold, and never more than there were in all.
+	if ok < shots-cancelled || ok > shots {
+		t.Errorf("got %d orders created, want from %d to %d", ok, shots-cancelled, shots)
+	}
+	if ok+refused != created {
+		t.Errorf("got %d orders created and %d refused, want %d in all", ok, refused, created)
+	}
+
+	var page models.OrderPage
+	mustSend(t, http.MethodGet, fmt.Sprintf("%s/orders?status=pending&limit=%d", url, models.MaxOrderPageSize), nil, &page, http.StatusOK)
+	if len(page.Orders) != ok {
+		t.Errorf("got %d pending orders, want %d", len(page.Orders), ok)
+	}
+	mustSend(t, http.MethodGet, fmt.Sprintf("%s/orders?status=cancelled&limit=%d", url, models.MaxOrderPageSize), nil, &page, http.StatusOK)
+	if len(page.Orders) != cancelled {
+		t.Errorf("got %d cancelled orders, want %d", len(page.Orders), cancelled)
+	}
+
+	if got, want := inventoryQuantity(t, url, "espresso_shot"), float64(shots-ok); got != want {
+		t.Errorf("got %v espresso shots left, want %v", got, want)
+	}
+	if got, want := inventoryQuantity(t, url, "milk"), float64(milk); got != want {
+		t.Errorf("got %v ml of milk left, want %v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+type PromotionServ interface {
+	CreatePromotionServ(promotion models.Promotion) error
+	GetPromotionsServ() ([]models.Promotion, error)
+	GetPromotionServ(code string) (models.Promotion, error)
+	UpdatePromotionServ(promotion models.Promotion) error
+	DeletePromotionServ(code string) error
+}
+
+type PromotionHandler struct {
+	promotionServ PromotionServ
+}
+
+func NewPromotionHandler(pS PromotionServ) *PromotionHandler {
+	return &PromotionHandler{promotionServ: pS}
+}
+
+func (h *PromotionHandler) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input models.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in CreatePromotion: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := models.NewPromotion(input)
+	if err != nil {
+		slog.Error("Handler Error in CreatePromotion: Invalid input data", "error", err)
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.promotionServ.CreatePromotionServ(*promotion); err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrExistConflict) {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in CreatePromotion: creating promotion", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Promotion created successfully", "code", promotion.Code)
+	writeJSON(w, http.StatusCreated, promotion)
+}
+
+func (h *PromotionHandler) GetPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := h.promotionServ.GetPromotionsServ()
+	if err != nil {
+		slog.Error("Handler Error in GetPromotions: retrieving all promotions", "error", err)
+		writeError(w, "Failed to retrieve all promotions", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("All promotions retrieved successfully")
+	writeJSON(w, http.StatusOK, promotions)
+}
+
+func (h *PromotionHandler) GetPromotion(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	promotion, err := h.promotionServ.GetPromotionServ(code)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in GetPromotion: retrieving promotion by code", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Promotion retrieved successfully", "code", promotion.Code)
+	writeJSON(w, http.StatusOK, promotion)
+}
+
+func (h *PromotionHandler) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input models.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in UpdatePromotion: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+	input.Code = r.PathValue("code")
+
+	promotion, err := models.NewPromotion(input)
+	if err != nil {
+		slog.Error("Handler Error in UpdatePromotion: Invalid input data", "error", err)
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.promotionServ.UpdatePromotionServ(*promotion); err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in UpdatePromotion: updating promotion", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Promotion updated successfully", "code", promotion.Code)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *PromotionHandler) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	if err := h.promotionServ.DeletePromotionServ(code); err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in DeletePromotion: deleting promotion by code", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	slog.Info("Promotion deleted successfully")
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// heartbeatInterval is how often the queue stream sends a comment while there
+// are no events, so that proxies keep the connection open.
+const heartbeatInterval = 15 * time.Second
+
+type QueueService interface {
+	GetQueueService(by string) ([]models.QueueEntry, error)
+}
+
+// OrderEventSource hands out the order events as they happen.
+type OrderEventSource interface {
+	Subscribe() (<-chan models.OrderEvent, func())
+}
+
+type QueueHandler struct {
+	queueService QueueService
+	events       OrderEventSource
+}
+
+func NewQueueHandler(qS QueueService, events OrderEventSource) *QueueHandler {
+	return &QueueHandler{queueService: qS, events: events}
+}
+
+func (h *QueueHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("sort")
+	if by == "" {
+		by = models.QueueFIFO
+	}
+
+	queue, err := h.queueService.GetQueueService(by)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in GetQueue: retrieving the queue", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Queue retrieved successfully", "orders", len(queue))
+	writeJSON(w, http.StatusOK, queue)
+}
+
+// StreamQueue pushes the order events to the client as Server-Sent Events
+// until the client goes away or the server shuts down.
+func (h *QueueHandler) StreamQueue(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		slog.Error("Handler Error in StreamQueue: the response cannot be streamed")
+		writeError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	slog.Info("Queue stream opened", "remote", r.RemoteAddr)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.Info("Queue stream closed by the client", "remote", r.RemoteAddr)
+			return
+
+		case event, open := <-events:
+			if !open {
+				slog.Info("Queue stream closed by the server", "remote", r.RemoteAddr)
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.Error("Handler Error in StreamQueue: encoding JSON data", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"hot-coffee/internal/customErrors"
 	"hot-coffee/internal/models"
 	"log/slog"
 	"net/http"
@@ -8,7 +10,9 @@ import (
 
 type ReportsService interface {
 	TotalSalesReportService() (models.TotalPrice, error)
-	PopularItemsReportService() ([]models.PopularItem, error)
+	PopularItemsReportService(groupBy string) ([]models.PopularItem, error)
+	TaxSummaryReportService(from, to string) (models.TaxSummary, error)
+	RefundsReportService(from, to string) (models.RefundReport, error)
 }
 
 type ReportsHandler struct {
@@ -31,12 +35,61 @@ func (rp *ReportsHandler) TotalSalesReportsHandler(w http.ResponseWriter, r *htt
 }
 
 func (rp *ReportsHandler) PopularItemsReportsHandler(w http.ResponseWriter, r *http.Request) {
-	popularItems, err := rp.reportsService.PopularItemsReportService()
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = models.GroupByProduct
+	}
+
+	popularItems, err := rp.reportsService.PopularItemsReportService(groupBy)
 	if err != nil {
-		writeError(w, err.Error(), http.StatusInternalServerError)
+		var status int
+		if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, err.Error(), status)
 		return
 	}
 
 	slog.Info("Get popular items successful")
 	writeJSON(w, http.StatusOK, map[string][]models.PopularItem{"the most popular item:": popularItems})
 }
+
+func (rp *ReportsHandler) TaxSummaryReportsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	summary, err := rp.reportsService.TaxSummaryReportService(query.Get("from"), query.Get("to"))
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Get tax summary successful")
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (rp *ReportsHandler) RefundsReportsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	report, err := rp.reportsService.RefundsReportService(query.Get("from"), query.Get("to"))
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Get refunds report successful")
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+type SettingsServ interface {
+	GetTaxSettingsServ() (models.TaxSettings, error)
+	UpdateTaxSettingsServ(tax models.TaxSettings) error
+}
+
+type SettingsHandler struct {
+	settingsServ SettingsServ
+}
+
+func NewSettingsHandler(sS SettingsServ) *SettingsHandler {
+	return &SettingsHandler{settingsServ: sS}
+}
+
+func (h *SettingsHandler) GetTaxSettings(w http.ResponseWriter, r *http.Request) {
+	tax, err := h.settingsServ.GetTaxSettingsServ()
+	if err != nil {
+		slog.Error("Handler Error in GetTaxSettings: retrieving tax settings", "error", err)
+		writeError(w, "Failed to retrieve tax settings", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Tax settings retrieved successfully")
+	writeJSON(w, http.StatusOK, tax)
+}
+
+func (h *SettingsHandler) UpdateTaxSettings(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input models.TaxSettings
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in UpdateTaxSettings: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	tax, err := models.NewTaxSettings(input)
+	if err != nil {
+		slog.Error("Handler Error in UpdateTaxSettings: Invalid input data", "error", err)
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.settingsServ.UpdateTaxSettingsServ(*tax); err != nil {
+		slog.Error("Handler Error in UpdateTaxSettings: updating tax settings", "error", err)
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Tax settings updated successfully")
+	writeJSON(w, http.StatusOK, tax)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+type SnapshotServ interface {
+	CreateSnapshotServ(note string) (models.Snapshot, error)
+	GetSnapshotsServ() ([]models.Snapshot, error)
+	RestoreSnapshotServ(id string) (models.Snapshot, error)
+}
+
+type SnapshotHandler struct {
+	snapshotServ SnapshotServ
+}
+
+func NewSnapshotHandler(sS SnapshotServ) *SnapshotHandler {
+	return &SnapshotHandler{snapshotServ: sS}
+}
+
+// CreateSnapshot takes an optional body {"note": "..."} describing why the
+// snapshot was taken.
+func (h *SnapshotHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if !isJSONFile(w, r) {
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			slog.Error("Handler Error in CreateSnapshot: decoding JSON data ", "error", err)
+			writeError(w, "Invalid JSON data", http.StatusBadRequest)
+			return
+		}
+	}
+
+	snapshot, err := h.snapshotServ.CreateSnapshotServ(input.Note)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotSupported) {
+			status = http.StatusNotImplemented
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in CreateSnapshot: creating snapshot", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Snapshot created successfully", "snapshotID", snapshot.ID)
+	writeJSON(w, http.StatusCreated, snapshot)
+}
+
+func (h *SnapshotHandler) GetSnapshots(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := h.snapshotServ.GetSnapshotsServ()
+	if err != nil {
+		slog.Error("Handler Error in GetSnapshots: retrieving snapshots", "error", err)
+		writeError(w, "Failed to retrieve snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Snapshots retrieved successfully")
+	writeJSON(w, http.StatusOK, snapshots)
+}
+
+func (h *SnapshotHandler) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snapshot, err := h.snapshotServ.RestoreSnapshotServ(id)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, customErrors.ErrSchemaVersion) || errors.Is(err, customErrors.ErrInvalidInput) {
+			status = http.StatusUnprocessableEntity
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in RestoreSnapshot: restoring snapshot", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Snapshot restored successfully", "snapshotID", snapshot.ID)
+	writeJSON(w, http.StatusOK, snapshot)
+}
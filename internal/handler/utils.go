@@ -2,15 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"hot-coffee/internal/models"
 	"log/slog"
 	"net/http"
-	"regexp"
 	"strings"
 )
 
-func isValidID(w http.ResponseWriter, id string, place, ops string) bool {
-	ValidBucketPath := regexp.MustCompile(`^order[1-9][0-9]*$`)
-	if !ValidBucketPath.MatchString(id) {
+func isValidID(w http.ResponseWriter, id, strategy string, place, ops string) bool {
+	if !models.ValidOrderID(strategy, id) {
 		s := "Invalid ID in: " + place
 		slog.Error(s)
 		s = "Failed to " + ops + " order"
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+type WebhookServ interface {
+	CreateWebhookServ(webhook models.Webhook) (models.Webhook, error)
+	GetWebhooksServ() ([]models.Webhook, error)
+	GetWebhookServ(id string) (models.Webhook, error)
+	UpdateWebhookServ(webhook models.Webhook) (models.Webhook, error)
+	DeleteWebhookServ(id string) error
+	GetDeliveriesServ(id, status string) ([]models.WebhookDelivery, error)
+}
+
+type WebhookHandler struct {
+	webhookServ WebhookServ
+}
+
+func NewWebhookHandler(wS WebhookServ) *WebhookHandler {
+	return &WebhookHandler{webhookServ: wS}
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in CreateWebhook: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := models.NewWebhook(input)
+	if err != nil {
+		slog.Error("Handler Error in CreateWebhook: Invalid input data", "error", err)
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.webhookServ.CreateWebhookServ(*webhook)
+	if err != nil {
+		slog.Error("Handler Error in CreateWebhook: creating webhook", "error", err)
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Webhook created successfully", "webhookID", created.ID)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookServ.GetWebhooksServ()
+	if err != nil {
+		slog.Error("Handler Error in GetWebhooks: retrieving all webhooks", "error", err)
+		writeError(w, "Failed to retrieve all webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("All webhooks retrieved successfully")
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := h.webhookServ.GetWebhookServ(r.PathValue("id"))
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in GetWebhook: retrieving webhook by ID", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Webhook retrieved successfully", "webhookID", webhook.ID)
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !isJSONFile(w, r) {
+		return
+	}
+
+	var input models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Error("Handler Error in UpdateWebhook: decoding JSON data", "error", err)
+		writeError(w, "Invalid JSON data", http.StatusBadRequest)
+		return
+	}
+	input.ID = r.PathValue("id")
+
+	webhook, err := models.NewWebhook(input)
+	if err != nil {
+		slog.Error("Handler Error in UpdateWebhook: Invalid input data", "error", err)
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.webhookServ.UpdateWebhookServ(*webhook)
+	if err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in UpdateWebhook: updating webhook", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	slog.Info("Webhook updated successfully", "webhookID", updated.ID)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhookServ.DeleteWebhookServ(r.PathValue("id")); err != nil {
+		var status int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			status = http.StatusNotFound
+		} else {
+			status = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in DeleteWebhook: deleting webhook by ID", "error", err)
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	slog.Info("Webhook deleted successfully")
+}
+
+// GetDeliveries lists the deliveries to a webhook, newest first. ?status=
+// narrows them down to pending, delivered or failed ones.
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != models.DeliveryPending && status != models.DeliveryDelivered && status != models.DeliveryFailed {
+		slog.Error("Handler Error in GetDeliveries: unknown status", "status", status)
+		writeError(w, "status is one of pending, delivered or failed", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.webhookServ.GetDeliveriesServ(r.PathValue("id"), status)
+	if err != nil {
+		var code int
+		if errors.Is(err, customErrors.ErrNotExistConflict) {
+			code = http.StatusNotFound
+		} else {
+			code = http.StatusInternalServerError
+		}
+		slog.Error("Handler Error in GetDeliveries: retrieving deliveries", "error", err)
+		writeError(w, err.Error(), code)
+		return
+	}
+
+	slog.Info("Webhook deliveries retrieved successfully", "deliveries", len(deliveries))
+	writeJSON(w, http.StatusOK, deliveries)
+}
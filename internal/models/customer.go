@@ -0,0 +1,161 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"math"
+	"strings"
+	"time"
+)
+
+// The loyalty program.
+const (
+	// PointsPerCurrencyUnit are the points a customer earns for every 1.00 of
+	// the total of a closed order.
+	PointsPerCurrencyUnit = 1
+	// PointValue is what each redeemed point takes off an order.
+	PointValue = 0.05
+	// LoyaltyDiscountCode is the code of the discounts redeemed points give.
+	// It is lower case, so no promo code can take it.
+	LoyaltyDiscountCode = "loyalty"
+)
+
+// Points ledger entry types.
+const (
+	// PointsEarned are earned with a closed order.
+	PointsEarned = "earn"
+	// PointsRedeemed are taken off an order.
+	PointsRedeemed = "redeem"
+	// PointsReturned are redeemed points given back, as when the order is
+	// cancelled or redeems fewer points.
+	PointsReturned = "return"
+	// PointsReversed are earned points taken back by a refund.
+	PointsReversed = "reverse"
+	// PointsAdjusted are added or taken by hand.
+	PointsAdjusted = "adjust"
+)
+
+// Customer is a customer orders can be linked to. Points is the balance of
+// the loyalty points in Ledger.
+type Customer struct {
+	ID        string        `json:"customer_id"`
+	Name      string        `json:"name"`
+	Email     string        `json:"email,omitempty"`
+	Phone     string        `json:"phone,omitempty"`
+	Points    int           `json:"points"`
+	Ledger    []PointsEntry `json:"ledger,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// PointsEntry is a change to the points of a customer. Points is negative for
+// points taken, and Balance what the customer has after the change.
+type PointsEntry struct {
+	ID        string    `json:"entry_id"`
+	Type      string    `json:"type"`
+	Points    int       `json:"points"`
+	Balance   int       `json:"balance"`
+	OrderID   string    `json:"order_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PointsLedger is the points balance of a customer with its ledger, newest
+// first.
+type PointsLedger struct {
+	CustomerID string        `json:"customer_id"`
+	Points     int           `json:"points"`
+	Entries    []PointsEntry `json:"entries"`
+}
+
+// NewCustomer checks c and returns it with its email normalized and no
+// points.
+func NewCustomer(c Customer) (*Customer, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Email = NormalizeEmail(c.Email)
+	c.Phone = strings.TrimSpace(c.Phone)
+	c.Points, c.Ledger = 0, nil
+	if c.Name == "" {
+		return nil, fmt.Errorf("%w: name", customErrors.ErrInvalidInput)
+	}
+	if c.Email != "" && !strings.Contains(c.Email, "@") {
+		return nil, fmt.Errorf("%w: %q is not an email address", customErrors.ErrInvalidInput, c.Email)
+	}
+	return &c, nil
+}
+
+// NormalizeEmail returns email the way customers are stored: addresses are not
+// case sensitive.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Summary returns the customer without its ledger.
+func (c Customer) Summary() Customer {
+	c.Ledger = nil
+	return c
+}
+
+// Matches reports whether the name, email or phone of the customer contain
+// search, ignoring case.
+func (c Customer) Matches(search string) bool {
+	search = strings.ToLower(strings.TrimSpace(search))
+	return strings.Contains(strings.ToLower(c.Name), search) || strings.Contains(c.Email, search) || strings.Contains(c.Phone, search)
+}
+
+// OrderPoints are the points the customer earned with the order, less those
+// taken back by its refunds.
+func (c Customer) OrderPoints(orderID string) int {
+	var points int
+	for _, entry := range c.Ledger {
+		if entry.OrderID == orderID && (entry.Type == PointsEarned || entry.Type == PointsReversed) {
+			points += entry.Points
+		}
+	}
+	return points
+}
+
+// AddPoints adds entry to the ledger of the customer, numbered, dated now and
+// with the balance after it. The balance cannot go below zero.
+func (c *Customer) AddPoints(entry PointsEntry, now time.Time) (PointsEntry, error) {
+	if c.Points+entry.Points < 0 {
+		return PointsEntry{}, fmt.Errorf("%w: customer %s has %d points, %d are needed", customErrors.ErrInsufficientPoints, c.ID, c.Points, -entry.Points)
+	}
+
+	entry.ID = fmt.Sprintf("%s-pts%d", c.ID, len(c.Ledger)+1)
+	entry.Balance = c.Points + entry.Points
+	entry.CreatedAt = now
+	c.Points = entry.Balance
+	c.Ledger = append(append([]PointsEntry(nil), c.Ledger...), entry)
+	return entry, nil
+}
+
+// EarnedPoints are the points an amount spent earns.
+func EarnedPoints(amount float64) int {
+	return int(math.Floor(RoundMoney(amount) * PointsPerCurrencyUnit))
+}
+
+// RedeemablePoints is the most points that can be redeemed on the order: as
+// many as it takes to bring what is left after its other discounts to zero.
+func RedeemablePoints(order Order) int {
+	left := order.Subtotal()
+	for _, discount := range order.Discounts {
+		if discount.Code != LoyaltyDiscountCode {
+			left -= discount.Amount
+		}
+	}
+	return int(math.Ceil(RoundMoney(max(left, 0)) / PointValue))
+}
+
+// LoyaltyDiscount is the discount points redeemed on the order give, no more
+// than what is left after its other discounts.
+func LoyaltyDiscount(order Order, points int) Discount {
+	left := order.Subtotal()
+	for _, discount := range order.Discounts {
+		left -= discount.Amount
+	}
+	return Discount{
+		Code:        LoyaltyDiscountCode,
+		Description: fmt.Sprintf("%d loyalty points", points),
+		Amount:      RoundMoney(min(float64(points)*PointValue, max(left, 0))),
+	}
+}
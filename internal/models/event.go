@@ -0,0 +1,232 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is one entry of the append-only journal. Data holds the payload
+// struct that matches Type.
+type Event struct {
+	Seq  int64           `json:"seq"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+const (
+	EventStateImported = "StateImported"
+	EventStateRestored = "StateRestored"
+	EventOrderCreated  = "OrderCreated"
+	// EventItemsAdded was recorded when updating an order added to its
+	// items; an update now replaces the order and is an OrderUpdated event.
+	EventItemsAdded         = "ItemsAdded"
+	EventOrderUpdated       = "OrderUpdated"
+	EventOrderItemsChanged  = "OrderItemsChanged"
+	EventOrderStatusChanged = "OrderStatusChanged"
+	EventOrderPaid          = "OrderPaid"
+	EventOrderRefunded      = "OrderRefunded"
+	// EventOrderClosed was recorded before orders had a lifecycle; closing
+	// is now an OrderStatusChanged event.
+	EventOrderClosed           = "OrderClosed"
+	EventOrderDeleted          = "OrderDeleted"
+	EventMenuItemCreated       = "MenuItemCreated"
+	EventMenuItemUpdated       = "MenuItemUpdated"
+	EventMenuItemDeleted       = "MenuItemDeleted"
+	EventInventoryCreated      = "InventoryItemCreated"
+	EventInventoryUpdated      = "InventoryItemUpdated"
+	EventInventoryAdjusted     = "InventoryAdjusted"
+	EventInventoryDeleted      = "InventoryItemDeleted"
+	EventPromotionCreated      = "PromotionCreated"
+	EventPromotionUpdated      = "PromotionUpdated"
+	EventPromotionDeleted      = "PromotionDeleted"
+	EventTaxSettingsUpdated    = "TaxSettingsUpdated"
+	EventWebhookCreated        = "WebhookCreated"
+	EventWebhookUpdated        = "WebhookUpdated"
+	EventWebhookDeleted        = "WebhookDeleted"
+	EventCustomerCreated       = "CustomerCreated"
+	EventCustomerUpdated       = "CustomerUpdated"
+	EventCustomerDeleted       = "CustomerDeleted"
+	EventCustomerPointsChanged = "CustomerPointsChanged"
+)
+
+// StateImported records the data that existed before the journal was
+// started, so a replay begins from it instead of from nothing.
+type StateImported struct {
+	Orders     []Order         `json:"orders"`
+	MenuItems  []MenuItem      `json:"menu_items"`
+	Inventory  []InventoryItem `json:"inventory"`
+	Promotions []Promotion     `json:"promotions,omitempty"`
+	Settings   []TaxSettings   `json:"settings,omitempty"`
+	Webhooks   []Webhook       `json:"webhooks,omitempty"`
+	Customers  []Customer      `json:"customers,omitempty"`
+}
+
+// StateRestored records that the data was replaced by the content of a
+// snapshot.
+type StateRestored struct {
+	SnapshotID string          `json:"snapshot_id"`
+	Orders     []Order         `json:"orders"`
+	MenuItems  []MenuItem      `json:"menu_items"`
+	Inventory  []InventoryItem `json:"inventory"`
+	Promotions []Promotion     `json:"promotions,omitempty"`
+	Settings   []TaxSettings   `json:"settings,omitempty"`
+	Webhooks   []Webhook       `json:"webhooks,omitempty"`
+	Customers  []Customer      `json:"customers,omitempty"`
+}
+
+type OrderCreated struct {
+	Order Order `json:"order"`
+}
+
+type ItemsAdded struct {
+	OrderID      string      `json:"order_id"`
+	CustomerName string      `json:"customer_name"`
+	Items        []OrderItem `json:"items"`
+}
+
+// OrderUpdated replaces an order as a whole.
+type OrderUpdated struct {
+	Order Order `json:"order"`
+}
+
+// OrderItemsChanged records line-item operations on an order together with the
+// items, discounts and taxes they left it with.
+type OrderItemsChanged struct {
+	OrderID       string               `json:"order_id"`
+	Operations    []OrderItemOperation `json:"operations"`
+	Items         []OrderItem          `json:"items"`
+	Discounts     []Discount           `json:"discounts,omitempty"`
+	Taxes         []TaxLine            `json:"taxes,omitempty"`
+	TaxInclusive  bool                 `json:"tax_inclusive,omitempty"`
+	ServiceCharge float64              `json:"service_charge,omitempty"`
+	RedeemPoints  int                  `json:"redeem_points,omitempty"`
+}
+
+func NewOrderItemsChanged(order Order, ops []OrderItemOperation) OrderItemsChanged {
+	return OrderItemsChanged{
+		OrderID:       order.ID,
+		Operations:    ops,
+		Items:         order.Items,
+		Discounts:     order.Discounts,
+		Taxes:         order.Taxes,
+		TaxInclusive:  order.TaxInclusive,
+		ServiceCharge: order.ServiceCharge,
+		RedeemPoints:  order.RedeemPoints,
+	}
+}
+
+type OrderStatusChanged struct {
+	OrderID string    `json:"order_id"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	At      time.Time `json:"at"`
+	// Reason is the cancel reason when To is cancelled.
+	Reason string `json:"reason,omitempty"`
+	// Order is the order as it was closed, when To is closed.
+	Order *Order `json:"order,omitempty"`
+}
+
+// OrderPaid records payments taken for an order.
+type OrderPaid struct {
+	OrderID  string    `json:"order_id"`
+	Payments []Payment `json:"payments"`
+}
+
+// OrderRefunded records a refund of a closed order. Restocked ingredients are
+// recorded as InventoryAdjusted events of their own.
+type OrderRefunded struct {
+	Refund Refund `json:"refund"`
+}
+
+type OrderClosed struct {
+	OrderID string `json:"order_id"`
+}
+
+type OrderDeleted struct {
+	OrderID string `json:"order_id"`
+}
+
+type MenuItemCreated struct {
+	MenuItem MenuItem `json:"menu_item"`
+}
+
+type MenuItemUpdated struct {
+	MenuItem MenuItem `json:"menu_item"`
+}
+
+type MenuItemDeleted struct {
+	ProductID string `json:"product_id"`
+}
+
+type InventoryItemCreated struct {
+	InventoryItem InventoryItem `json:"inventory_item"`
+}
+
+type InventoryItemUpdated struct {
+	InventoryItem InventoryItem `json:"inventory_item"`
+}
+
+// InventoryAdjusted is a change in stock caused by something other than an
+// edit of the inventory item, such as an order using ingredients up. Quantity
+// and Unit are those of the item after the change.
+type InventoryAdjusted struct {
+	IngredientID string  `json:"ingredient_id"`
+	Delta        float64 `json:"delta"`
+	Quantity     float64 `json:"quantity"`
+	Unit         string  `json:"unit,omitempty"`
+	OrderID      string  `json:"order_id,omitempty"`
+}
+
+type InventoryItemDeleted struct {
+	IngredientID string `json:"ingredient_id"`
+}
+
+type PromotionCreated struct {
+	Promotion Promotion `json:"promotion"`
+}
+
+// PromotionUpdated replaces a promotion, including when an order takes or
+// gives back one of its uses.
+type PromotionUpdated struct {
+	Promotion Promotion `json:"promotion"`
+}
+
+type PromotionDeleted struct {
+	Code string `json:"code"`
+}
+
+type TaxSettingsUpdated struct {
+	Settings TaxSettings `json:"settings"`
+}
+
+type WebhookCreated struct {
+	Webhook Webhook `json:"webhook"`
+}
+
+type WebhookUpdated struct {
+	Webhook Webhook `json:"webhook"`
+}
+
+type WebhookDeleted struct {
+	WebhookID string `json:"webhook_id"`
+}
+
+type CustomerCreated struct {
+	Customer Customer `json:"customer"`
+}
+
+// CustomerUpdated records a change to the name, email or phone of a customer;
+// its points change with CustomerPointsChanged.
+type CustomerUpdated struct {
+	Customer Customer `json:"customer"`
+}
+
+type CustomerDeleted struct {
+	CustomerID string `json:"customer_id"`
+}
+
+type CustomerPointsChanged struct {
+	CustomerID string      `json:"customer_id"`
+	Entry      PointsEntry `json:"entry"`
+}
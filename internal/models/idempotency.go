@@ -0,0 +1,43 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key accepted.
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyRecord is the response to a request sent with an Idempotency-Key,
+// kept until ExpiresAt to be replayed when the request is retried. Fingerprint
+// identifies the request, so that a key reused for another one is caught. A
+// record without a Status is the claim on the key saved before the request
+// runs.
+type IdempotencyRecord struct {
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// RequestFingerprint is the hex SHA-256 of the method, URI and body of a
+// request.
+func RequestFingerprint(method, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (r IdempotencyRecord) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// Answered reports whether the record holds a response rather than a claim.
+func (r IdempotencyRecord) Answered() bool {
+	return r.Status != 0
+}
@@ -0,0 +1,24 @@
+package models
+
+const (
+	IssueDanglingReference = "dangling_reference"
+	IssueDuplicateID       = "duplicate_id"
+	IssueNegativeStock     = "negative_stock"
+	IssueMalformedID       = "malformed_id"
+)
+
+// IntegrityIssue is one problem found in the data. Fix describes what the
+// fix mode does about it, and is empty when it has to be resolved by hand.
+type IntegrityIssue struct {
+	Kind       string `json:"kind"`
+	Collection string `json:"collection"`
+	ID         string `json:"id"`
+	Detail     string `json:"detail"`
+	Fix        string `json:"fix,omitempty"`
+	Fixed      bool   `json:"fixed"`
+}
+
+type IntegrityReport struct {
+	Issues []IntegrityIssue `json:"issues"`
+	Fixed  int              `json:"fixed"`
+}
@@ -2,14 +2,22 @@ package models
 
 import (
 	"hot-coffee/internal/customErrors"
+	"strings"
 )
 
 type MenuItem struct {
-	ID          string               `json:"product_id"`
-	Name        string               `json:"name"`
-	Description string               `json:"description"`
-	Price       float64              `json:"price"`
+	ID          string  `json:"product_id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	// Category decides the tax rate of the item.
+	Category    string               `json:"category,omitempty"`
 	Ingredients []MenuItemIngredient `json:"ingredients"`
+	// Variants are the sizes the item comes in. An item with variants is
+	// ordered as one of them.
+	Variants []MenuItemVariant `json:"variants,omitempty"`
+	// ModifierGroups are the choices a customer makes when ordering the item.
+	ModifierGroups []ModifierGroup `json:"modifier_groups,omitempty"`
 }
 
 type MenuItemIngredient struct {
@@ -24,7 +32,7 @@ func NewMenuItemIngredient(ingId string, quantity float64) *MenuItemIngredient {
 	}
 }
 
-func NewMenuItem(id, name, description string, price float64, ingredients []MenuItemIngredient) (*MenuItem, error) {
+func NewMenuItem(id, name, description, category string, price float64, ingredients []MenuItemIngredient, variants []MenuItemVariant, modifierGroups []ModifierGroup) (*MenuItem, error) {
 	if name == "" || price <= 0 {
 		return nil, customErrors.ErrInvalidInput
 	}
@@ -37,14 +45,23 @@ func NewMenuItem(id, name, description string, price float64, ingredients []Menu
 			return nil, customErrors.ErrInvalidInput
 		}
 	}
+	if err := validateVariants(variants); err != nil {
+		return nil, err
+	}
+	if err := validateModifierGroups(modifierGroups, ingredients); err != nil {
+		return nil, err
+	}
 	if id == "" {
 		id = fromNameToID(name)
 	}
 	return &MenuItem{
-		ID:          id,
-		Name:        name,
-		Description: description,
-		Price:       price,
-		Ingredients: ingredients,
+		ID:             id,
+		Name:           name,
+		Description:    description,
+		Price:          price,
+		Category:       strings.TrimSpace(category),
+		Ingredients:    ingredients,
+		Variants:       variants,
+		ModifierGroups: modifierGroups,
 	}, nil
 }
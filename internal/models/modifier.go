@@ -0,0 +1,198 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"sort"
+	"strings"
+)
+
+// ModifierGroup is a choice a customer makes about a menu item, such as the
+// milk type or extra shots. A required group needs an option chosen; only a
+// multiple group allows more than one.
+type ModifierGroup struct {
+	ID       string           `json:"group_id"`
+	Name     string           `json:"name"`
+	Required bool             `json:"required"`
+	Multiple bool             `json:"multiple"`
+	Options  []ModifierOption `json:"options"`
+}
+
+// ModifierOption is one option of a modifier group. Its price delta is added
+// to the unit price and its ingredients change the recipe.
+type ModifierOption struct {
+	ID          string               `json:"option_id"`
+	Name        string               `json:"name"`
+	PriceDelta  float64              `json:"price_delta"`
+	Ingredients []ModifierIngredient `json:"ingredients"`
+}
+
+// ModifierIngredient adds Quantity of an ingredient to the recipe. With
+// Replaces set it substitutes that recipe ingredient instead, taking its
+// quantity unless Quantity is given.
+type ModifierIngredient struct {
+	IngredientID string  `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"`
+	Replaces     string  `json:"replaces,omitempty"`
+}
+
+// OrderItemModifier is an option chosen on an order line. The name and price
+// delta are those of the option when the line was placed.
+type OrderItemModifier struct {
+	GroupID    string  `json:"group_id"`
+	OptionID   string  `json:"option_id"`
+	Name       string  `json:"name"`
+	PriceDelta float64 `json:"price_delta"`
+}
+
+func validateModifierGroups(groups []ModifierGroup, ingredients []MenuItemIngredient) error {
+	recipe := make(map[string]bool)
+	for _, ingredient := range ingredients {
+		recipe[ingredient.IngredientID] = true
+	}
+
+	groupIDs := make(map[string]bool)
+	for _, group := range groups {
+		if group.ID == "" || group.Name == "" || len(group.Options) == 0 || groupIDs[group.ID] {
+			return fmt.Errorf("%w: modifier group %q", customErrors.ErrInvalidInput, group.ID)
+		}
+		groupIDs[group.ID] = true
+
+		optionIDs := make(map[string]bool)
+		for _, option := range group.Options {
+			if option.ID == "" || option.Name == "" || optionIDs[option.ID] {
+				return fmt.Errorf("%w: modifier option %q of group %s", customErrors.ErrInvalidInput, option.ID, group.ID)
+			}
+			optionIDs[option.ID] = true
+
+			for _, ingredient := range option.Ingredients {
+				if ingredient.IngredientID == "" || ingredient.Quantity < 0 || (ingredient.Quantity == 0 && ingredient.Replaces == "") {
+					return fmt.Errorf("%w: ingredient %q of modifier option %s", customErrors.ErrInvalidInput, ingredient.IngredientID, option.ID)
+				}
+				if ingredient.Replaces != "" && !recipe[ingredient.Replaces] {
+					return fmt.Errorf("%w: modifier option %s replaces %s, which is not in the recipe", customErrors.ErrInvalidInput, option.ID, ingredient.Replaces)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// IngredientIDs returns the ingredients the recipe, the variants and the
+// modifier options of the menu item use.
+func (m MenuItem) IngredientIDs() []string {
+	var ids []string
+	for _, ingredient := range m.Ingredients {
+		ids = append(ids, ingredient.IngredientID)
+	}
+	for _, variant := range m.Variants {
+		for _, ingredient := range variant.Ingredients {
+			ids = append(ids, ingredient.IngredientID)
+		}
+	}
+	for _, group := range m.ModifierGroups {
+		for _, option := range group.Options {
+			for _, ingredient := range option.Ingredients {
+				ids = append(ids, ingredient.IngredientID)
+			}
+		}
+	}
+	return ids
+}
+
+// ResolveModifiers checks chosen against the modifier groups of the menu item
+// and returns them with the name and price delta of each option, sorted by
+// group and option.
+func (m MenuItem) ResolveModifiers(chosen []OrderItemModifier) ([]OrderItemModifier, error) {
+	counts := make(map[string]int)
+	var resolved []OrderItemModifier
+	for _, choice := range chosen {
+		group, option, exists := m.modifierOption(choice.GroupID, choice.OptionID)
+		if !exists {
+			return nil, fmt.Errorf("%w: %s has no modifier option %s/%s", customErrors.ErrInvalidInput, m.ID, choice.GroupID, choice.OptionID)
+		}
+		counts[group.ID]++
+		if counts[group.ID] > 1 && !group.Multiple {
+			return nil, fmt.Errorf("%w: only one option of %s can be chosen", customErrors.ErrInvalidInput, group.ID)
+		}
+		resolved = append(resolved, OrderItemModifier{
+			GroupID:    group.ID,
+			OptionID:   option.ID,
+			Name:       option.Name,
+			PriceDelta: option.PriceDelta,
+		})
+	}
+
+	for _, group := range m.ModifierGroups {
+		if group.Required && counts[group.ID] == 0 {
+			return nil, fmt.Errorf("%w: an option of %s has to be chosen for %s", customErrors.ErrInvalidInput, group.ID, m.ID)
+		}
+	}
+
+	sortModifiers(resolved)
+	return resolved, nil
+}
+
+// UnitIngredients returns the ingredients one unit of an order line for the
+// menu item takes: the recipe of its variant with its modifiers applied.
+// Variants and options no longer on the menu item are skipped.
+func (m MenuItem) UnitIngredients(item OrderItem) map[string]float64 {
+	quantities := m.variantRecipe(item.Variant)
+	for _, choice := range item.Modifiers {
+		_, option, exists := m.modifierOption(choice.GroupID, choice.OptionID)
+		if !exists {
+			continue
+		}
+		for _, ingredient := range option.Ingredients {
+			quantity := ingredient.Quantity
+			if ingredient.Replaces != "" {
+				if quantity == 0 {
+					quantity = quantities[ingredient.Replaces]
+				}
+				delete(quantities, ingredient.Replaces)
+			}
+			quantities[ingredient.IngredientID] += quantity
+		}
+	}
+	return quantities
+}
+
+func (m MenuItem) modifierOption(groupID, optionID string) (ModifierGroup, ModifierOption, bool) {
+	for _, group := range m.ModifierGroups {
+		if group.ID != groupID {
+			continue
+		}
+		for _, option := range group.Options {
+			if option.ID == optionID {
+				return group, option, true
+			}
+		}
+	}
+	return ModifierGroup{}, ModifierOption{}, false
+}
+
+func sortModifiers(modifiers []OrderItemModifier) {
+	sort.Slice(modifiers, func(i, j int) bool {
+		if modifiers[i].GroupID != modifiers[j].GroupID {
+			return modifiers[i].GroupID < modifiers[j].GroupID
+		}
+		return modifiers[i].OptionID < modifiers[j].OptionID
+	})
+}
+
+// LineKey identifies the line of an order an item belongs to: lines are per
+// product, variant and set of chosen modifiers.
+func (item OrderItem) LineKey() string {
+	modifiers := append([]OrderItemModifier(nil), item.Modifiers...)
+	sortModifiers(modifiers)
+
+	var b strings.Builder
+	b.WriteString(item.ProductID)
+	if item.Variant != "" {
+		b.WriteString("/" + item.Variant)
+	}
+	for _, modifier := range modifiers {
+		b.WriteString("|" + modifier.GroupID + ":" + modifier.OptionID)
+	}
+	return b.String()
+}
@@ -1,21 +1,117 @@
 package models
 
 import (
+	"fmt"
 	"hot-coffee/internal/customErrors"
+	"math"
 	"time"
 )
 
 type Order struct {
-	ID           string      `json:"order_id"`
-	CustomerName string      `json:"customer_name"`
-	Items        []OrderItem `json:"items"`
-	Status       string      `json:"status"`
-	CreatedAt    string      `json:"created_at"`
+	ID           string `json:"order_id"`
+	CustomerName string `json:"customer_name"`
+	// CustomerID links the order to a customer account, which earns points
+	// when the order closes.
+	CustomerID string      `json:"customer_id,omitempty"`
+	Items      []OrderItem `json:"items"`
+	Status     string      `json:"status"`
+	CreatedAt  time.Time   `json:"created_at"`
+	// Priority puts the order ahead of those with a lower one in the barista
+	// queue.
+	Priority int `json:"priority,omitempty"`
+	// StatusHistory records every status the order entered, oldest first.
+	StatusHistory []StatusChange `json:"status_history"`
+	// CancelReason is why a cancelled order was cancelled.
+	CancelReason string `json:"cancel_reason,omitempty"`
+	// PromoCode is the promotion attached to the order, and Discounts what it
+	// took off the items.
+	PromoCode string     `json:"promo_code,omitempty"`
+	Discounts []Discount `json:"discounts,omitempty"`
+	// RedeemPoints are the loyalty points of the customer taken off the
+	// order, as a discount after that of the promo code.
+	RedeemPoints int `json:"redeem_points,omitempty"`
+	// Taxes, TaxInclusive and ServiceCharge are worked out from the tax
+	// settings whenever the items or discounts change.
+	Taxes         []TaxLine `json:"taxes,omitempty"`
+	TaxInclusive  bool      `json:"tax_inclusive,omitempty"`
+	ServiceCharge float64   `json:"service_charge,omitempty"`
+	// Payments are the payments taken for the order, oldest first.
+	Payments []Payment `json:"payments,omitempty"`
+	// Refunds are the refunds made for the order after it closed.
+	Refunds []Refund `json:"refunds,omitempty"`
 }
 
+// OrderTotals is the price breakdown of an order.
+type OrderTotals struct {
+	OrderID       string     `json:"order_id"`
+	Subtotal      float64    `json:"subtotal"`
+	Discounts     []Discount `json:"discounts"`
+	DiscountTotal float64    `json:"discount_total"`
+	Taxes         []TaxLine  `json:"taxes"`
+	TaxTotal      float64    `json:"tax_total"`
+	TaxInclusive  bool       `json:"tax_inclusive"`
+	ServiceCharge float64    `json:"service_charge"`
+	Total         float64    `json:"total"`
+	Paid          float64    `json:"paid"`
+	Balance       float64    `json:"balance"`
+}
+
+func NewOrderTotals(order Order) OrderTotals {
+	discounts := order.Discounts
+	if discounts == nil {
+		discounts = []Discount{}
+	}
+	taxes := order.Taxes
+	if taxes == nil {
+		taxes = []TaxLine{}
+	}
+	return OrderTotals{
+		OrderID:       order.ID,
+		Subtotal:      order.Subtotal(),
+		Discounts:     discounts,
+		DiscountTotal: order.DiscountTotal(),
+		Taxes:         taxes,
+		TaxTotal:      order.TaxTotal(),
+		TaxInclusive:  order.TaxInclusive,
+		ServiceCharge: order.ServiceCharge,
+		Total:         order.Total(),
+		Paid:          order.Paid(),
+		Balance:       order.Balance(),
+	}
+}
+
+// OrderView is an order as the API returns it, together with its price
+// breakdown.
+type OrderView struct {
+	Order
+	Totals OrderTotals `json:"totals"`
+}
+
+func NewOrderView(order Order) OrderView {
+	return OrderView{Order: order, Totals: NewOrderTotals(order)}
+}
+
+// OrderItem is a line of an order. The name and unit price are those of the
+// menu item when the line was placed, so later menu changes do not change what
+// the order cost.
 type OrderItem struct {
-	ProductID string `json:"product_id"`
-	Quantity  int    `json:"quantity"`
+	ProductID string  `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	Name      string  `json:"name"`
+	UnitPrice float64 `json:"unit_price"`
+	LineTotal float64 `json:"line_total"`
+	// Variant is the variant of the product the line is for, if it has any.
+	Variant     string `json:"variant_id,omitempty"`
+	VariantName string `json:"variant_name,omitempty"`
+	// Category is that of the menu item, for the tax rate of the line.
+	Category string `json:"category,omitempty"`
+	// Modifiers are the options chosen for the line; their price deltas are
+	// part of the unit price.
+	Modifiers []OrderItemModifier `json:"modifiers,omitempty"`
+	// Ingredients are what all the units of the line took from the
+	// inventory, by the recipes they were ordered with. Cancelling and
+	// refunding give these back, whatever the menu says now.
+	Ingredients map[string]float64 `json:"ingredients,omitempty"`
 }
 
 func NewOrderItem(productId string, quantity int) *OrderItem {
@@ -25,10 +121,15 @@ func NewOrderItem(productId string, quantity int) *OrderItem {
 	}
 }
 
-func NewOrder(name string, createdTime time.Time, items []OrderItem) (*Order, error) {
-	if name == "" {
+// NewOrder returns an order for the customer name, or for the customer
+// account customerID, whose name is filled in when name is left out.
+func NewOrder(name, customerID string, createdTime time.Time, items []OrderItem) (*Order, error) {
+	if name == "" && customerID == "" {
 		return nil, customErrors.ErrInvalidInput
 	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: the order has no items", customErrors.ErrInvalidInput)
+	}
 
 	for _, orderItem := range items {
 		if orderItem.ProductID == "" || orderItem.Quantity <= 0 {
@@ -37,7 +138,145 @@ func NewOrder(name string, createdTime time.Time, items []OrderItem) (*Order, er
 	}
 	return &Order{
 		CustomerName: name,
+		CustomerID:   customerID,
 		Items:        items,
-		CreatedAt:    createdTime.Format("2006-01-02 15:04:05"),
+		CreatedAt:    createdTime,
 	}, nil
 }
+
+// Subtotal is the sum of the line totals of the order.
+func (o Order) Subtotal() float64 {
+	var subtotal float64
+	for _, item := range o.Items {
+		subtotal += item.LineTotal
+	}
+	return RoundMoney(subtotal)
+}
+
+// DiscountTotal is the sum of the discounts of the order.
+func (o Order) DiscountTotal() float64 {
+	var discounts float64
+	for _, discount := range o.Discounts {
+		discounts += discount.Amount
+	}
+	return RoundMoney(discounts)
+}
+
+// TaxTotal is the sum of the tax lines of the order.
+func (o Order) TaxTotal() float64 {
+	var taxes float64
+	for _, tax := range o.Taxes {
+		taxes += tax.Amount
+	}
+	return RoundMoney(taxes)
+}
+
+// Total is what the order costs: its subtotal less its discounts, plus the
+// service charge and, unless prices include it, the tax.
+func (o Order) Total() float64 {
+	total := max(o.Subtotal()-o.DiscountTotal(), 0) + o.ServiceCharge
+	if !o.TaxInclusive {
+		total += o.TaxTotal()
+	}
+	return RoundMoney(total)
+}
+
+// NetSales is what the order sold: its subtotal less its discounts, without
+// the tax or the service charge, less the same share of its refunds.
+func (o Order) NetSales() float64 {
+	sales := max(o.Subtotal()-o.DiscountTotal(), 0)
+	if o.TaxInclusive {
+		sales -= o.TaxTotal()
+	}
+	if total, refunded := o.Total(), o.Refunded(); total > 0 && refunded > 0 {
+		sales -= refunded * sales / total
+	}
+	return RoundMoney(sales)
+}
+
+// PriceOrderItems fills in the names, unit price, modifiers and line total of
+// items. A line that was already on the order, in previous, keeps the price it
+// was placed at; other lines take the current price of their variant and the
+// modifier price deltas from the menu, and are checked against it. Items for
+// the same line are merged into one, so an order has one line per LineKey.
+func PriceOrderItems(items, previous []OrderItem, menu map[string]MenuItem) ([]OrderItem, error) {
+	placed := make(map[string]OrderItem)
+	for _, item := range previous {
+		if _, exists := placed[item.LineKey()]; !exists {
+			placed[item.LineKey()] = item
+		}
+	}
+
+	priced := make([]OrderItem, len(items))
+	for i, item := range items {
+		if prev, exists := placed[item.LineKey()]; exists {
+			item.Name, item.VariantName, item.UnitPrice, item.Modifiers = prev.Name, prev.VariantName, prev.UnitPrice, prev.Modifiers
+			item.Category = prev.Category
+		} else {
+			menuItem, exists := menu[item.ProductID]
+			if !exists {
+				return nil, fmt.Errorf("%w: product %s is not on the menu", customErrors.ErrNotExistConflict, item.ProductID)
+			}
+			modifiers, err := menuItem.ResolveModifiers(item.Modifiers)
+			if err != nil {
+				return nil, err
+			}
+			item.Name, item.UnitPrice, item.Modifiers = menuItem.Name, menuItem.Price, modifiers
+			item.Category = menuItem.Category
+			if item.Variant != "" || len(menuItem.Variants) != 0 {
+				if item.Variant == "" {
+					return nil, fmt.Errorf("%w: a variant of %s has to be chosen", customErrors.ErrInvalidInput, item.ProductID)
+				}
+				variant, exists := menuItem.Variant(item.Variant)
+				if !exists {
+					return nil, fmt.Errorf("%w: %s has no variant %q", customErrors.ErrInvalidInput, item.ProductID, item.Variant)
+				}
+				item.VariantName, item.UnitPrice = variant.Name, variant.Price
+			}
+			for _, modifier := range modifiers {
+				item.UnitPrice += modifier.PriceDelta
+			}
+			item.UnitPrice = RoundMoney(item.UnitPrice)
+		}
+		priced[i] = item
+	}
+
+	priced = MergeOrderItems(priced)
+	for i := range priced {
+		priced[i].LineTotal = RoundMoney(priced[i].UnitPrice * float64(priced[i].Quantity))
+	}
+	return priced, nil
+}
+
+// UnitsIngredients returns the share of the ingredients of the line that units
+// of it took.
+func (item OrderItem) UnitsIngredients(units int) map[string]float64 {
+	quantities := make(map[string]float64, len(item.Ingredients))
+	if item.Quantity <= 0 {
+		return quantities
+	}
+	for ingredientID, quantity := range item.Ingredients {
+		if units == item.Quantity {
+			quantities[ingredientID] = quantity
+		} else {
+			quantities[ingredientID] = quantity * float64(units) / float64(item.Quantity)
+		}
+	}
+	return quantities
+}
+
+// ItemsIngredients adds up the ingredients items took.
+func ItemsIngredients(items []OrderItem) map[string]float64 {
+	quantities := make(map[string]float64)
+	for _, item := range items {
+		for ingredientID, quantity := range item.Ingredients {
+			quantities[ingredientID] += quantity
+		}
+	}
+	return quantities
+}
+
+// RoundMoney rounds an amount to whole cents.
+func RoundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
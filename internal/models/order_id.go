@@ -0,0 +1,39 @@
+package models
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Order ID strategies: how new orders are numbered.
+const (
+	// OrderIDSequential numbers orders order1, order2, ... for good.
+	OrderIDSequential = "orderN"
+	// OrderIDULID gives every order a ULID, sortable by creation time.
+	OrderIDULID = "ulid"
+	// OrderIDDaily numbers orders like tickets, starting again every day:
+	// 20241001-001, 20241001-002, ...
+	OrderIDDaily = "daily"
+)
+
+var orderIDPatterns = map[string]*regexp.Regexp{
+	OrderIDSequential: regexp.MustCompile(`^order[1-9][0-9]*$`),
+	OrderIDULID:       regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+	OrderIDDaily:      regexp.MustCompile(`^[0-9]{8}-[0-9]{3,}$`),
+}
+
+// OrderIDStrategies lists the order ID strategies.
+func OrderIDStrategies() []string {
+	names := make([]string, 0, len(orderIDPatterns))
+	for name := range orderIDPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidOrderID reports whether id is an order ID of the given strategy.
+func ValidOrderID(strategy, id string) bool {
+	pattern, exists := orderIDPatterns[strategy]
+	return exists && pattern.MatchString(id)
+}
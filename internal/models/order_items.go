@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+)
+
+// Operations on the lines of an order.
+const (
+	ItemOpAdd         = "add"
+	ItemOpRemove      = "remove"
+	ItemOpSetQuantity = "set_quantity"
+)
+
+// OrderItemOperation changes the line of an order for one product, variant and
+// set of modifiers. Add increases its quantity, adding the line if the order has none;
+// remove drops the line; set_quantity replaces its quantity.
+type OrderItemOperation struct {
+	Op        string              `json:"op"`
+	ProductID string              `json:"product_id"`
+	Quantity  int                 `json:"quantity,omitempty"`
+	Variant   string              `json:"variant_id,omitempty"`
+	Modifiers []OrderItemModifier `json:"modifiers,omitempty"`
+}
+
+// ApplyItemOperations returns items with ops applied in order, with one line
+// per product, variant and set of modifiers. items is left untouched.
+func ApplyItemOperations(items []OrderItem, ops []OrderItemOperation) ([]OrderItem, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no operations", customErrors.ErrInvalidInput)
+	}
+
+	result := MergeOrderItems(items)
+	for i, op := range ops {
+		if op.ProductID == "" {
+			return nil, fmt.Errorf("%w: operation %d has no product_id", customErrors.ErrInvalidInput, i)
+		}
+
+		opItem := OrderItem{ProductID: op.ProductID, Quantity: op.Quantity, Variant: op.Variant, Modifiers: op.Modifiers}
+		line := -1
+		for j, item := range result {
+			if item.LineKey() == opItem.LineKey() {
+				line = j
+				break
+			}
+		}
+
+		switch op.Op {
+		case ItemOpAdd:
+			if op.Quantity <= 0 {
+				return nil, fmt.Errorf("%w: operation %d needs a positive quantity", customErrors.ErrInvalidInput, i)
+			}
+			if line == -1 {
+				result = append(result, opItem)
+			} else {
+				result[line].Quantity += op.Quantity
+			}
+
+		case ItemOpRemove:
+			if line == -1 {
+				return nil, fmt.Errorf("%w: the order has no line %s", customErrors.ErrInvalidInput, opItem.LineKey())
+			}
+			result = append(result[:line], result[line+1:]...)
+
+		case ItemOpSetQuantity:
+			if op.Quantity <= 0 {
+				return nil, fmt.Errorf("%w: operation %d needs a positive quantity, use remove to drop the line", customErrors.ErrInvalidInput, i)
+			}
+			if line == -1 {
+				return nil, fmt.Errorf("%w: the order has no line %s", customErrors.ErrInvalidInput, opItem.LineKey())
+			}
+			result[line].Quantity = op.Quantity
+
+		default:
+			return nil, fmt.Errorf("%w: unknown operation %q", customErrors.ErrInvalidInput, op.Op)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: the order would have no items left, cancel it instead", customErrors.ErrInvalidInput)
+	}
+	return result, nil
+}
+
+// MergeOrderItems returns items with the lines for the same product, variant
+// and modifiers merged into one, in the order each line first appears. The
+// quantities and ingredients of merged lines are added up.
+func MergeOrderItems(items []OrderItem) []OrderItem {
+	merged := []OrderItem{}
+	lines := make(map[string]int)
+	for _, item := range items {
+		if i, exists := lines[item.LineKey()]; exists {
+			merged[i].Quantity += item.Quantity
+			if len(item.Ingredients) != 0 {
+				merged[i].Ingredients = ItemsIngredients([]OrderItem{merged[i], item})
+			}
+			continue
+		}
+		lines[item.LineKey()] = len(merged)
+		merged = append(merged, item)
+	}
+	return merged
+}
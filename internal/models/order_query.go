@@ -0,0 +1,285 @@
+package models
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sorts of the order list.
+const (
+	// OrderSortID lists the orders by ID, with the numbers in them compared
+	// as numbers, so order2 comes before order10.
+	OrderSortID        = "id"
+	OrderSortCreatedAt = "created_at"
+	OrderSortTotal     = "total"
+)
+
+const (
+	DefaultOrderPageSize = 50
+	MaxOrderPageSize     = 200
+)
+
+// orderQueryParams are the query parameters GET /orders takes.
+var orderQueryParams = []string{"status", "customer", "from", "to", "product", "min_total", "sort", "order", "limit", "cursor"}
+
+// OrderQuery selects, sorts and pages the order list. Zero fields select
+// everything; To is exclusive.
+type OrderQuery struct {
+	Statuses []string
+	// Customer is a customer ID or a customer name, ignoring case.
+	Customer string
+	From     time.Time
+	To       time.Time
+	Product  string
+	MinTotal float64
+	Sort     string
+	Desc     bool
+	Limit    int
+	// Cursor is where the page starts: after the last order of the previous
+	// one.
+	Cursor *OrderCursor
+}
+
+// OrderCursor is the position of an order in the order list sorted by Sort.
+// It is handed out encoded by EncodeOrderCursor.
+type OrderCursor struct {
+	Sort      string     `json:"sort"`
+	Desc      bool       `json:"desc,omitempty"`
+	ID        string     `json:"id"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Total     float64    `json:"total,omitempty"`
+}
+
+// OrderPage is a page of the order list. NextCursor and Next, the link to the
+// next page, are left out on the last page.
+type OrderPage struct {
+	Orders     []OrderView `json:"orders"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Next       string      `json:"next,omitempty"`
+}
+
+// NewOrderQuery reads an order query from the query parameters of GET
+// /orders, and checks them. A status given more than once is kept once.
+func NewOrderQuery(values url.Values) (*OrderQuery, error) {
+	for param := range values {
+		if !slices.Contains(orderQueryParams, param) {
+			return nil, fmt.Errorf("%w: unknown query parameter %q; the parameters are %s", customErrors.ErrInvalidQuery, param, strings.Join(orderQueryParams, ", "))
+		}
+	}
+
+	q := &OrderQuery{
+		Customer: strings.TrimSpace(values.Get("customer")),
+		Product:  values.Get("product"),
+		Sort:     OrderSortID,
+		Limit:    DefaultOrderPageSize,
+	}
+
+	for _, statuses := range values["status"] {
+		for _, status := range strings.Split(statuses, ",") {
+			if !ValidOrderStatus(status) {
+				return nil, fmt.Errorf("%w: unknown order status %q", customErrors.ErrInvalidQuery, status)
+			}
+			if !slices.Contains(q.Statuses, status) {
+				q.Statuses = append(q.Statuses, status)
+			}
+		}
+	}
+
+	var err error
+	if q.From, err = parseQueryTime(values.Get("from"), false); err != nil {
+		return nil, err
+	}
+	if q.To, err = parseQueryTime(values.Get("to"), true); err != nil {
+		return nil, err
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from is after to", customErrors.ErrInvalidQuery)
+	}
+
+	if minTotal := values.Get("min_total"); minTotal != "" {
+		if q.MinTotal, err = strconv.ParseFloat(minTotal, 64); err != nil || q.MinTotal < 0 || math.IsInf(q.MinTotal, 0) {
+			return nil, fmt.Errorf("%w: min_total %q is not an amount", customErrors.ErrInvalidQuery, minTotal)
+		}
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		if sort != OrderSortID && sort != OrderSortCreatedAt && sort != OrderSortTotal {
+			return nil, fmt.Errorf("%w: sort is one of %s, %s or %s", customErrors.ErrInvalidQuery, OrderSortID, OrderSortCreatedAt, OrderSortTotal)
+		}
+		q.Sort = sort
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, fmt.Errorf("%w: order is asc or desc", customErrors.ErrInvalidQuery)
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 1 || q.Limit > MaxOrderPageSize {
+			return nil, fmt.Errorf("%w: limit is a number from 1 to %d", customErrors.ErrInvalidQuery, MaxOrderPageSize)
+		}
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		if q.Cursor, err = decodeOrderCursor(cursor); err != nil {
+			return nil, err
+		}
+		if q.Cursor.Sort != q.Sort || q.Cursor.Desc != q.Desc {
+			return nil, fmt.Errorf("%w: the cursor is for another sort of the orders", customErrors.ErrInvalidQuery)
+		}
+	}
+
+	return q, nil
+}
+
+// parseQueryTime reads a date like 2006-01-02 or a time in RFC 3339. A date
+// stands for the start of the day, or with end for the start of the next day,
+// and a time with end for the instant after it, so that to includes it.
+func parseQueryTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q is not a date like 2006-01-02 or a time like 2006-01-02T15:04:05Z", customErrors.ErrInvalidQuery, value)
+	}
+	if end {
+		t = t.Add(time.Nanosecond)
+	}
+	return t, nil
+}
+
+// Matches reports whether order is selected by the filters of the query.
+func (q OrderQuery) Matches(order Order) bool {
+	if len(q.Statuses) != 0 && !slices.Contains(q.Statuses, order.Status) {
+		return false
+	}
+	if q.Customer != "" && order.CustomerID != q.Customer && !strings.EqualFold(strings.TrimSpace(order.CustomerName), q.Customer) {
+		return false
+	}
+	if (!q.From.IsZero() && order.CreatedAt.Before(q.From)) || (!q.To.IsZero() && !order.CreatedAt.Before(q.To)) {
+		return false
+	}
+	if q.Product != "" && !slices.ContainsFunc(order.Items, func(item OrderItem) bool { return item.ProductID == q.Product }) {
+		return false
+	}
+	return q.MinTotal == 0 || order.Total() >= q.MinTotal
+}
+
+// Position returns the cursor of order in the sort of the query.
+func (q OrderQuery) Position(order Order) OrderCursor {
+	cursor := OrderCursor{Sort: q.Sort, Desc: q.Desc, ID: order.ID}
+	switch q.Sort {
+	case OrderSortCreatedAt:
+		cursor.CreatedAt = &order.CreatedAt
+	case OrderSortTotal:
+		cursor.Total = order.Total()
+	}
+	return cursor
+}
+
+// Before reports whether the order at a comes before the one at b in the sort
+// of the query. Orders that sort the same are ordered by ID.
+func (q OrderQuery) Before(a, b OrderCursor) bool {
+	var c int
+	switch q.Sort {
+	case OrderSortCreatedAt:
+		c = createdAt(a).Compare(createdAt(b))
+	case OrderSortTotal:
+		c = cmp.Compare(a.Total, b.Total)
+	}
+	if c == 0 {
+		c = CompareNatural(a.ID, b.ID)
+	}
+	if q.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+func createdAt(cursor OrderCursor) time.Time {
+	if cursor.CreatedAt == nil {
+		return time.Time{}
+	}
+	return *cursor.CreatedAt
+}
+
+// EncodeOrderCursor returns cursor as the opaque string clients hand back.
+func EncodeOrderCursor(cursor OrderCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeOrderCursor(value string) (*OrderCursor, error) {
+	var cursor OrderCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("%w: the cursor is not one handed out by GET /orders", customErrors.ErrInvalidQuery)
+	}
+	return &cursor, nil
+}
+
+// CompareNatural compares a and b like strings, except that runs of digits
+// are compared as numbers: order2 comes before order10. It returns -1, 0 or 1.
+func CompareNatural(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			numA, restA := digitRun(a)
+			numB, restB := digitRun(b)
+			trimmedA, trimmedB := strings.TrimLeft(numA, "0"), strings.TrimLeft(numB, "0")
+			if len(trimmedA) != len(trimmedB) {
+				return cmp.Compare(len(trimmedA), len(trimmedB))
+			}
+			if c := strings.Compare(trimmedA, trimmedB); c != 0 {
+				return c
+			}
+			// The same number: fewer leading zeros first.
+			if len(numA) != len(numB) {
+				return cmp.Compare(len(numA), len(numB))
+			}
+			a, b = restA, restB
+			continue
+		}
+		if a[0] != b[0] {
+			return cmp.Compare(int(a[0]), int(b[0]))
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digitRun splits s after its leading digits.
+func digitRun(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
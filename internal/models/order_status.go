@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+// Order statuses, in the order an order normally goes through them.
+const (
+	StatusPending   = "pending"
+	StatusAccepted  = "accepted"
+	StatusPreparing = "preparing"
+	StatusReady     = "ready"
+	StatusServed    = "served"
+	StatusClosed    = "closed"
+	StatusCancelled = "cancelled"
+)
+
+// orderTransitions lists the statuses each status can change to. Closed and
+// cancelled orders are final.
+var orderTransitions = map[string][]string{
+	StatusPending:   {StatusAccepted, StatusCancelled},
+	StatusAccepted:  {StatusPreparing, StatusCancelled},
+	StatusPreparing: {StatusReady, StatusCancelled},
+	StatusReady:     {StatusServed, StatusCancelled},
+	StatusServed:    {StatusClosed},
+	StatusClosed:    {},
+	StatusCancelled: {},
+}
+
+// Reasons an order can be cancelled for.
+const (
+	CancelReasonCustomerRequest = "customer_request"
+	CancelReasonOutOfStock      = "out_of_stock"
+	CancelReasonMistake         = "mistake"
+	CancelReasonDuplicate       = "duplicate"
+	CancelReasonOther           = "other"
+)
+
+// CancelReasons returns the reasons an order can be cancelled for.
+func CancelReasons() []string {
+	return []string{CancelReasonCustomerRequest, CancelReasonOutOfStock, CancelReasonMistake, CancelReasonDuplicate, CancelReasonOther}
+}
+
+// ValidCancelReason reports whether reason is one of the cancel reasons.
+func ValidCancelReason(reason string) bool {
+	for _, r := range CancelReasons() {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusChange is one entry of an order's status history: the status and when
+// the order entered it.
+type StatusChange struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+// ValidOrderStatus reports whether status is one of the order statuses.
+func ValidOrderStatus(status string) bool {
+	_, exists := orderTransitions[status]
+	return exists
+}
+
+// NextOrderStatuses returns the statuses an order in status can change to.
+func NextOrderStatuses(status string) []string {
+	return append([]string{}, orderTransitions[status]...)
+}
+
+// CanTransition reports whether an order can change from one status to the
+// other.
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderEditable reports whether the items of an order in status can still be
+// changed: only until the kitchen starts preparing it.
+func OrderEditable(status string) bool {
+	return status == StatusPending || status == StatusAccepted
+}
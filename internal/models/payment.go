@@ -0,0 +1,221 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"time"
+)
+
+// Payment methods.
+const (
+	PaymentCash    = "cash"
+	PaymentCard    = "card"
+	PaymentVoucher = "voucher"
+)
+
+// Payment is money taken for an order. Amount goes towards the order total and
+// Tip on top of it. A payment for Items pays for those units of the order's
+// lines, and its amount is their share of the total. Tendered is the cash the
+// customer handed over, and Change what they get back.
+type Payment struct {
+	ID       string        `json:"payment_id"`
+	Method   string        `json:"method"`
+	Amount   float64       `json:"amount"`
+	Tip      float64       `json:"tip,omitempty"`
+	Tendered float64       `json:"tendered,omitempty"`
+	Change   float64       `json:"change,omitempty"`
+	Items    []PaymentItem `json:"items,omitempty"`
+	PaidAt   time.Time     `json:"paid_at"`
+}
+
+// PaymentItem is a number of units of an order line that a payment is for.
+// The line is found like in line-item operations.
+type PaymentItem struct {
+	ProductID string              `json:"product_id"`
+	Variant   string              `json:"variant_id,omitempty"`
+	Modifiers []OrderItemModifier `json:"modifiers,omitempty"`
+	Quantity  int                 `json:"quantity"`
+}
+
+// OrderBill is what an order costs and what was paid for it. Change is the
+// change due on the payments just taken.
+type OrderBill struct {
+	OrderID  string    `json:"order_id"`
+	Status   string    `json:"status"`
+	Total    float64   `json:"total"`
+	Paid     float64   `json:"paid"`
+	Tips     float64   `json:"tips"`
+	Balance  float64   `json:"balance"`
+	Change   float64   `json:"change"`
+	Payments []Payment `json:"payments"`
+}
+
+func NewOrderBill(order Order, taken []Payment) OrderBill {
+	var change float64
+	for _, payment := range taken {
+		change += payment.Change
+	}
+	payments := order.Payments
+	if payments == nil {
+		payments = []Payment{}
+	}
+	return OrderBill{
+		OrderID:  order.ID,
+		Status:   order.Status,
+		Total:    order.Total(),
+		Paid:     order.Paid(),
+		Tips:     order.Tips(),
+		Balance:  order.Balance(),
+		Change:   RoundMoney(change),
+		Payments: payments,
+	}
+}
+
+// PaymentMethods returns the accepted payment methods.
+func PaymentMethods() []string {
+	return []string{PaymentCash, PaymentCard, PaymentVoucher}
+}
+
+// ValidPaymentMethod reports whether method is an accepted payment method.
+func ValidPaymentMethod(method string) bool {
+	for _, m := range PaymentMethods() {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Paid is the sum of the amounts paid for the order, without tips.
+func (o Order) Paid() float64 {
+	var paid float64
+	for _, payment := range o.Payments {
+		paid += payment.Amount
+	}
+	return RoundMoney(paid)
+}
+
+// Tips is the sum of the tips given with the payments of the order.
+func (o Order) Tips() float64 {
+	var tips float64
+	for _, payment := range o.Payments {
+		tips += payment.Tip
+	}
+	return RoundMoney(tips)
+}
+
+// Balance is what is still due on the order.
+func (o Order) Balance() float64 {
+	return RoundMoney(max(o.Total()-o.Paid(), 0))
+}
+
+// TakePayments checks payments against what is due on order and adds them to
+// it, numbered and dated now. A payment without an amount or items pays the
+// balance, or for cash as much of it as the tendered cash covers.
+func TakePayments(order *Order, payments []Payment, now time.Time) ([]Payment, error) {
+	lines := orderLines(order.Items)
+	paidUnits := make(map[string]int)
+	for _, payment := range order.Payments {
+		for _, item := range payment.Items {
+			paidUnits[item.lineKey()] += item.Quantity
+		}
+	}
+
+	taken := make([]Payment, 0, len(payments))
+	for _, p := range payments {
+		if !ValidPaymentMethod(p.Method) {
+			return nil, fmt.Errorf("%w: unknown payment method %q, available: %v", customErrors.ErrInvalidInput, p.Method, PaymentMethods())
+		}
+		if p.Amount < 0 || p.Tip < 0 || p.Tendered < 0 {
+			return nil, fmt.Errorf("%w: payment amounts cannot be negative", customErrors.ErrInvalidInput)
+		}
+		if p.Method != PaymentCash && p.Tendered != 0 {
+			return nil, fmt.Errorf("%w: only cash is tendered", customErrors.ErrInvalidInput)
+		}
+
+		balance := order.Balance()
+		if balance == 0 {
+			return nil, fmt.Errorf("%w: order %s is already paid", customErrors.ErrInvalidInput, order.ID)
+		}
+
+		switch {
+		case len(p.Items) != 0:
+			if p.Amount != 0 {
+				return nil, fmt.Errorf("%w: a payment is either for an amount or for items", customErrors.ErrInvalidInput)
+			}
+			var share float64
+			for _, item := range p.Items {
+				line, exists := lines[item.lineKey()]
+				if !exists || item.Quantity <= 0 {
+					return nil, fmt.Errorf("%w: order %s has no line %s", customErrors.ErrInvalidInput, order.ID, item.lineKey())
+				}
+				if paidUnits[item.lineKey()]+item.Quantity > line.Quantity {
+					return nil, fmt.Errorf("%w: only %d of %s are left to pay for", customErrors.ErrInvalidInput, line.Quantity-paidUnits[item.lineKey()], item.lineKey())
+				}
+				paidUnits[item.lineKey()] += item.Quantity
+				share += line.UnitPrice * float64(item.Quantity)
+			}
+			// Discounts, taxes and the service charge are shared out in
+			// proportion to the price of the items; the last items paid for
+			// take what is left, so rounding never leaves a cent due.
+			if subtotal := order.Subtotal(); subtotal > 0 {
+				p.Amount = RoundMoney(share / subtotal * order.Total())
+			}
+			if allUnitsPaid(lines, paidUnits) {
+				p.Amount = balance
+			}
+			p.Amount = min(p.Amount, balance)
+
+		case p.Amount == 0:
+			p.Amount = balance
+			if p.Method == PaymentCash && p.Tendered != 0 {
+				p.Amount = RoundMoney(min(p.Tendered-p.Tip, balance))
+			}
+		}
+
+		if p.Amount <= 0 {
+			return nil, fmt.Errorf("%w: a payment has to be for a positive amount", customErrors.ErrInvalidInput)
+		}
+		if p.Amount > balance {
+			return nil, fmt.Errorf("%w: %.2f is more than the %.2f still due", customErrors.ErrInvalidInput, p.Amount, balance)
+		}
+		if p.Method == PaymentCash {
+			if p.Tendered == 0 {
+				p.Tendered = RoundMoney(p.Amount + p.Tip)
+			}
+			if p.Tendered < RoundMoney(p.Amount+p.Tip) {
+				return nil, fmt.Errorf("%w: %.2f tendered does not cover %.2f", customErrors.ErrInvalidInput, p.Tendered, p.Amount+p.Tip)
+			}
+			p.Change = RoundMoney(p.Tendered - p.Amount - p.Tip)
+		}
+
+		p.ID = fmt.Sprintf("%s-pay%d", order.ID, len(order.Payments)+1)
+		p.PaidAt = now
+		order.Payments = append(order.Payments, p)
+		taken = append(taken, p)
+	}
+	return taken, nil
+}
+
+func (item PaymentItem) lineKey() string {
+	return OrderItem{ProductID: item.ProductID, Variant: item.Variant, Modifiers: item.Modifiers}.LineKey()
+}
+
+// orderLines returns the lines of items by LineKey. Orders saved before lines
+// were merged can hold a line more than once; its quantities are added up.
+func orderLines(items []OrderItem) map[string]OrderItem {
+	lines := make(map[string]OrderItem)
+	for _, item := range MergeOrderItems(items) {
+		lines[item.LineKey()] = item
+	}
+	return lines
+}
+
+func allUnitsPaid(lines map[string]OrderItem, paidUnits map[string]int) bool {
+	for key, line := range lines {
+		if paidUnits[key] < line.Quantity {
+			return false
+		}
+	}
+	return true
+}
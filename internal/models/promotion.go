@@ -0,0 +1,174 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Promotion rule types.
+const (
+	// PromoPercentage takes Value percent off the eligible lines.
+	PromoPercentage = "percentage"
+	// PromoFixedAmount takes Value off the eligible lines, down to 0.
+	PromoFixedAmount = "fixed_amount"
+	// PromoBOGO makes Free of every Buy+Free units of an eligible line free.
+	PromoBOGO = "bogo"
+	// PromoItem takes Value off every unit of the listed products.
+	PromoItem = "item"
+)
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{1,32}$`)
+
+// Promotion is a discount customers get by attaching its code to an order.
+// ProductIDs limits it to lines for those products; without them every line
+// is eligible. Used counts the orders the code is attached to.
+type Promotion struct {
+	Code       string     `json:"code"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Value      float64    `json:"value,omitempty"`
+	ProductIDs []string   `json:"product_ids,omitempty"`
+	Buy        int        `json:"buy,omitempty"`
+	Free       int        `json:"free,omitempty"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	UsageLimit int        `json:"usage_limit,omitempty"`
+	Used       int        `json:"used"`
+}
+
+// Discount is what a promotion took off an order, for the whole order or, with
+// ProductID set, for one line.
+type Discount struct {
+	Code        string  `json:"code"`
+	Description string  `json:"description"`
+	ProductID   string  `json:"product_id,omitempty"`
+	Variant     string  `json:"variant_id,omitempty"`
+	Amount      float64 `json:"amount"`
+}
+
+// PromotionTypes returns the promotion rule types.
+func PromotionTypes() []string {
+	return []string{PromoPercentage, PromoFixedAmount, PromoBOGO, PromoItem}
+}
+
+// NormalizePromoCode returns code the way promotions are stored: codes are
+// not case sensitive.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// NewPromotion checks the rules of p and returns it with its code normalized
+// and no uses.
+func NewPromotion(p Promotion) (*Promotion, error) {
+	p.Code = NormalizePromoCode(p.Code)
+	p.Used = 0
+	if !promoCodePattern.MatchString(p.Code) || p.Name == "" {
+		return nil, customErrors.ErrInvalidInput
+	}
+
+	switch p.Type {
+	case PromoPercentage:
+		if p.Value <= 0 || p.Value > 100 {
+			return nil, fmt.Errorf("%w: a percentage has to be in (0, 100]", customErrors.ErrInvalidInput)
+		}
+	case PromoFixedAmount:
+		if p.Value <= 0 {
+			return nil, fmt.Errorf("%w: the amount has to be positive", customErrors.ErrInvalidInput)
+		}
+	case PromoBOGO:
+		if p.Buy <= 0 || p.Free <= 0 {
+			return nil, fmt.Errorf("%w: buy and free have to be positive", customErrors.ErrInvalidInput)
+		}
+	case PromoItem:
+		if p.Value <= 0 || len(p.ProductIDs) == 0 {
+			return nil, fmt.Errorf("%w: an item promotion needs a positive value and product_ids", customErrors.ErrInvalidInput)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown promotion type %q, available: %v", customErrors.ErrInvalidInput, p.Type, PromotionTypes())
+	}
+
+	if p.ValidFrom != nil && p.ValidUntil != nil && !p.ValidUntil.After(*p.ValidFrom) {
+		return nil, fmt.Errorf("%w: valid_until has to be after valid_from", customErrors.ErrInvalidInput)
+	}
+	if p.UsageLimit < 0 {
+		return nil, fmt.Errorf("%w: usage_limit cannot be negative", customErrors.ErrInvalidInput)
+	}
+	return &p, nil
+}
+
+// Available reports why the promotion cannot be attached to another order at
+// now, if it cannot.
+func (p Promotion) Available(now time.Time) error {
+	if p.ValidFrom != nil && now.Before(*p.ValidFrom) {
+		return fmt.Errorf("%w: %s is valid from %s", customErrors.ErrInvalidPromotion, p.Code, p.ValidFrom.Format(time.RFC3339))
+	}
+	if p.ValidUntil != nil && !now.Before(*p.ValidUntil) {
+		return fmt.Errorf("%w: %s expired at %s", customErrors.ErrInvalidPromotion, p.Code, p.ValidUntil.Format(time.RFC3339))
+	}
+	if p.UsageLimit != 0 && p.Used >= p.UsageLimit {
+		return fmt.Errorf("%w: %s has been used %d times, its limit", customErrors.ErrInvalidPromotion, p.Code, p.Used)
+	}
+	return nil
+}
+
+// Discounts returns what the promotion takes off an order with items.
+func (p Promotion) Discounts(items []OrderItem) []Discount {
+	eligible := func(item OrderItem) bool {
+		if len(p.ProductIDs) == 0 {
+			return true
+		}
+		for _, id := range p.ProductIDs {
+			if id == item.ProductID {
+				return true
+			}
+		}
+		return false
+	}
+
+	var discounts []Discount
+	switch p.Type {
+	case PromoPercentage, PromoFixedAmount:
+		var subtotal float64
+		for _, item := range items {
+			if eligible(item) {
+				subtotal += item.LineTotal
+			}
+		}
+		amount := p.Value
+		if p.Type == PromoPercentage {
+			amount = subtotal * p.Value / 100
+		}
+		amount = RoundMoney(min(amount, subtotal))
+		if amount > 0 {
+			discounts = append(discounts, Discount{Code: p.Code, Description: p.Name, Amount: amount})
+		}
+
+	case PromoBOGO, PromoItem:
+		for _, item := range items {
+			if !eligible(item) {
+				continue
+			}
+			var amount float64
+			if p.Type == PromoBOGO {
+				free := item.Quantity / (p.Buy + p.Free) * p.Free
+				amount = float64(free) * item.UnitPrice
+			} else {
+				amount = min(p.Value, item.UnitPrice) * float64(item.Quantity)
+			}
+			amount = RoundMoney(amount)
+			if amount > 0 {
+				discounts = append(discounts, Discount{
+					Code:        p.Code,
+					Description: p.Name,
+					ProductID:   item.ProductID,
+					Variant:     item.Variant,
+					Amount:      amount,
+				})
+			}
+		}
+	}
+	return discounts
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Orders of the barista queue.
+const (
+	// QueueFIFO lists the orders oldest first.
+	QueueFIFO = "fifo"
+	// QueuePriority lists the orders with the highest priority first, and
+	// orders of the same priority oldest first.
+	QueuePriority = "priority"
+)
+
+// Types of the order events pushed to the queue stream.
+const (
+	OrderEventCreated = "order_created"
+	OrderEventChanged = "order_changed"
+	OrderEventClosed  = "order_closed"
+	OrderEventDeleted = "order_deleted"
+)
+
+// OrderEvent is a change to an order, as the queue stream pushes it. Order is
+// the order after the change, and is left out once the order is deleted.
+type OrderEvent struct {
+	Type    string      `json:"type"`
+	OrderID string      `json:"order_id"`
+	Status  string      `json:"status,omitempty"`
+	Order   *QueueEntry `json:"order,omitempty"`
+	At      time.Time   `json:"at"`
+}
+
+// QueueEntry is an order as baristas see it in the queue.
+type QueueEntry struct {
+	OrderID      string      `json:"order_id"`
+	CustomerName string      `json:"customer_name"`
+	Status       string      `json:"status"`
+	Priority     int         `json:"priority"`
+	Items        []QueueItem `json:"items"`
+	CreatedAt    time.Time   `json:"created_at"`
+	// WaitingSeconds is how long ago the order was placed.
+	WaitingSeconds int `json:"waiting_seconds"`
+}
+
+// QueueItem is what to make for an order line.
+type QueueItem struct {
+	Name      string   `json:"name"`
+	Variant   string   `json:"variant,omitempty"`
+	Modifiers []string `json:"modifiers,omitempty"`
+	Quantity  int      `json:"quantity"`
+}
+
+// QueueOrders returns the ways the queue can be ordered.
+func QueueOrders() []string {
+	return []string{QueueFIFO, QueuePriority}
+}
+
+// QueueStatuses returns the statuses of the orders in the queue: open orders
+// and orders in progress, which are still to be made or handed over.
+func QueueStatuses() []string {
+	return []string{StatusPending, StatusAccepted, StatusPreparing, StatusReady}
+}
+
+func NewQueueEntry(order Order, now time.Time) QueueEntry {
+	items := make([]QueueItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		queueItem := QueueItem{Name: item.Name, Variant: item.VariantName, Quantity: item.Quantity}
+		if queueItem.Name == "" {
+			queueItem.Name = item.ProductID
+		}
+		for _, modifier := range item.Modifiers {
+			queueItem.Modifiers = append(queueItem.Modifiers, modifier.Name)
+		}
+		items = append(items, queueItem)
+	}
+
+	return QueueEntry{
+		OrderID:        order.ID,
+		CustomerName:   order.CustomerName,
+		Status:         order.Status,
+		Priority:       order.Priority,
+		Items:          items,
+		CreatedAt:      order.CreatedAt,
+		WaitingSeconds: int(max(now.Sub(order.CreatedAt), 0).Seconds()),
+	}
+}
+
+// SortQueue puts entries in the queue order by.
+func SortQueue(entries []QueueEntry, by string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if by == QueuePriority && entries[i].Priority != entries[j].Priority {
+			return entries[i].Priority > entries[j].Priority
+		}
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].OrderID < entries[j].OrderID
+	})
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"time"
+)
+
+// Refund reasons.
+const (
+	RefundWrongItem  = "wrong_item"
+	RefundQuality    = "quality"
+	RefundComplaint  = "customer_complaint"
+	RefundOvercharge = "overcharge"
+	RefundOther      = "other"
+)
+
+// What happens to the ingredients of refunded items.
+const (
+	// RefundRestock puts the ingredients back into the inventory.
+	RefundRestock = "restock"
+	// RefundWaste writes them off: the inventory stays as it is.
+	RefundWaste = "waste"
+)
+
+// Refund gives back money for units of the lines of a closed order. Amount is
+// their share of the order total. Ingredients are the share of what the lines
+// took that the units took, restocked or written off as waste as Inventory
+// says.
+type Refund struct {
+	ID          string             `json:"refund_id"`
+	OrderID     string             `json:"order_id"`
+	Reason      string             `json:"reason"`
+	Note        string             `json:"note,omitempty"`
+	Inventory   string             `json:"inventory"`
+	Items       []RefundItem       `json:"items"`
+	Amount      float64            `json:"amount"`
+	Ingredients map[string]float64 `json:"ingredients,omitempty"`
+	// PointsReversed are the loyalty points earned with the order that the
+	// refund took back from the customer.
+	PointsReversed int       `json:"points_reversed,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// RefundItem is a number of units of an order line that are refunded. The
+// line is found like in line-item operations.
+type RefundItem struct {
+	ProductID string              `json:"product_id"`
+	Variant   string              `json:"variant_id,omitempty"`
+	Modifiers []OrderItemModifier `json:"modifiers,omitempty"`
+	Quantity  int                 `json:"quantity"`
+	Amount    float64             `json:"amount"`
+}
+
+// RefundReport lists the refunds made between From and To.
+type RefundReport struct {
+	From     string             `json:"from,omitempty"`
+	To       string             `json:"to,omitempty"`
+	Count    int                `json:"count"`
+	Total    float64            `json:"total"`
+	ByReason map[string]float64 `json:"by_reason"`
+	Refunds  []Refund           `json:"refunds"`
+}
+
+// RefundReasons returns the reasons a refund can be made for.
+func RefundReasons() []string {
+	return []string{RefundWrongItem, RefundQuality, RefundComplaint, RefundOvercharge, RefundOther}
+}
+
+// ValidRefundReason reports whether reason is one of RefundReasons.
+func ValidRefundReason(reason string) bool {
+	for _, r := range RefundReasons() {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Refunded is the sum of the refunds of the order.
+func (o Order) Refunded() float64 {
+	var refunded float64
+	for _, refund := range o.Refunds {
+		refunded += refund.Amount
+	}
+	return RoundMoney(refunded)
+}
+
+// NewRefund checks refund against order and returns it for order, numbered
+// and dated now, with the amount of each item worked out. A refund without
+// items is for every unit not refunded yet.
+func NewRefund(order Order, refund Refund, now time.Time) (Refund, error) {
+	if !ValidRefundReason(refund.Reason) {
+		return Refund{}, fmt.Errorf("%w: unknown refund reason %q, available: %v", customErrors.ErrInvalidInput, refund.Reason, RefundReasons())
+	}
+	if refund.Inventory == "" {
+		refund.Inventory = RefundRestock
+	}
+	if refund.Inventory != RefundRestock && refund.Inventory != RefundWaste {
+		return Refund{}, fmt.Errorf("%w: inventory is either %s or %s", customErrors.ErrInvalidInput, RefundRestock, RefundWaste)
+	}
+	if order.Status != StatusClosed {
+		return Refund{}, fmt.Errorf("%w: order %s is %s, only closed orders are refunded", customErrors.ErrNotRefundable, order.ID, order.Status)
+	}
+
+	lines := orderLines(order.Items)
+	refundedUnits := make(map[string]int)
+	for _, previous := range order.Refunds {
+		for _, item := range previous.Items {
+			refundedUnits[item.lineKey()] += item.Quantity
+		}
+	}
+
+	if len(refund.Items) == 0 {
+		for _, item := range MergeOrderItems(order.Items) {
+			if left := item.Quantity - refundedUnits[item.LineKey()]; left > 0 {
+				refund.Items = append(refund.Items, RefundItem{
+					ProductID: item.ProductID,
+					Variant:   item.Variant,
+					Modifiers: item.Modifiers,
+					Quantity:  left,
+				})
+			}
+		}
+		if len(refund.Items) == 0 {
+			return Refund{}, fmt.Errorf("%w: order %s is refunded already", customErrors.ErrNotRefundable, order.ID)
+		}
+	}
+
+	// Like payments for items, each item is refunded its share of the total,
+	// and the last units take what is left of it.
+	remaining := RoundMoney(order.Total() - order.Refunded())
+	subtotal := order.Subtotal()
+	refund.Amount = 0
+	for i, item := range refund.Items {
+		line, exists := lines[item.lineKey()]
+		if !exists || item.Quantity <= 0 {
+			return Refund{}, fmt.Errorf("%w: order %s has no line %s", customErrors.ErrInvalidInput, order.ID, item.lineKey())
+		}
+		if refundedUnits[item.lineKey()]+item.Quantity > line.Quantity {
+			return Refund{}, fmt.Errorf("%w: only %d of %s are left to refund", customErrors.ErrNotRefundable, line.Quantity-refundedUnits[item.lineKey()], item.lineKey())
+		}
+		refundedUnits[item.lineKey()] += item.Quantity
+
+		item.Variant, item.Modifiers = line.Variant, line.Modifiers
+		item.Amount = 0
+		if subtotal > 0 {
+			item.Amount = RoundMoney(line.UnitPrice * float64(item.Quantity) / subtotal * order.Total())
+		}
+		refund.Items[i] = item
+		refund.Amount += item.Amount
+	}
+	refund.Amount = RoundMoney(refund.Amount)
+	if allUnitsPaid(lines, refundedUnits) || refund.Amount > remaining {
+		refund.Items[len(refund.Items)-1].Amount = RoundMoney(refund.Items[len(refund.Items)-1].Amount + remaining - refund.Amount)
+		refund.Amount = remaining
+	}
+
+	refund.ID = fmt.Sprintf("%s-ref%d", order.ID, len(order.Refunds)+1)
+	refund.OrderID = order.ID
+	refund.Ingredients = nil
+	refund.CreatedAt = now
+	return refund, nil
+}
+
+// OrderItems returns the refunded units as order lines of order.
+func (refund Refund) OrderItems(order Order) []OrderItem {
+	lines := orderLines(order.Items)
+
+	items := make([]OrderItem, 0, len(refund.Items))
+	for _, item := range refund.Items {
+		line := lines[item.lineKey()]
+		line.Ingredients = line.UnitsIngredients(item.Quantity)
+		line.Quantity = item.Quantity
+		items = append(items, line)
+	}
+	return items
+}
+
+func (item RefundItem) lineKey() string {
+	return OrderItem{ProductID: item.ProductID, Variant: item.Variant, Modifiers: item.Modifiers}.LineKey()
+}
@@ -4,8 +4,15 @@ type TotalPrice struct {
 	TotalSale float64 `json:"total-sales"`
 }
 
+// Ways to group the items of a report.
+const (
+	GroupByProduct = "product"
+	GroupByVariant = "variant"
+)
+
 type PopularItem struct {
 	ItemName        string `json:"item-name"`
+	Variant         string `json:"variant,omitempty"`
 	QuantityOfSales int    `json:"quantity_of_sales"`
 }
 
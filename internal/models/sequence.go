@@ -0,0 +1,10 @@
+package models
+
+// Sequence is a persisted counter, such as the number of the last event
+// written to the journal. A counter that starts again every period, like the
+// daily order numbers, also records the period its value belongs to.
+type Sequence struct {
+	Name   string `json:"name"`
+	Value  int64  `json:"value"`
+	Period string `json:"period,omitempty"`
+}
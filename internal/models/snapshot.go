@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Snapshot describes a point-in-time archive of the data directory.
+type Snapshot struct {
+	ID            string    `json:"snapshot_id"`
+	Note          string    `json:"note,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	Storage       string    `json:"storage"`
+	SchemaVersion int       `json:"schema_version"`
+	Files         []string  `json:"files"`
+	Size          int64     `json:"size"`
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"sort"
+)
+
+// TaxSettingsName is the key the tax settings are saved under.
+const TaxSettingsName = "tax"
+
+// TaxSettings are how orders are taxed. Rates are percentages; a menu item
+// whose category has no rate of its own is taxed at DefaultRate. With
+// Inclusive set, menu prices already include the tax, otherwise it is added
+// on top. ServiceCharge is a percentage of the discounted subtotal, charged
+// on top and not taxed.
+type TaxSettings struct {
+	Name          string    `json:"name"`
+	Inclusive     bool      `json:"inclusive"`
+	DefaultRate   float64   `json:"default_rate"`
+	DefaultName   string    `json:"default_name,omitempty"`
+	Rates         []TaxRate `json:"rates"`
+	ServiceCharge float64   `json:"service_charge"`
+}
+
+// TaxRate is the tax rate of a menu category.
+type TaxRate struct {
+	Category string  `json:"category"`
+	Name     string  `json:"name,omitempty"`
+	Rate     float64 `json:"rate"`
+}
+
+// TaxLine is the tax of an order, or of a report, for one category: Rate
+// percent of Taxable.
+type TaxLine struct {
+	Category string  `json:"category"`
+	Name     string  `json:"name"`
+	Rate     float64 `json:"rate"`
+	Taxable  float64 `json:"taxable"`
+	Amount   float64 `json:"amount"`
+}
+
+// NewTaxSettings checks the rates of t and returns it under TaxSettingsName.
+func NewTaxSettings(t TaxSettings) (*TaxSettings, error) {
+	t.Name = TaxSettingsName
+	if t.DefaultRate < 0 || t.DefaultRate > 100 || t.ServiceCharge < 0 || t.ServiceCharge > 100 {
+		return nil, fmt.Errorf("%w: rates have to be in [0, 100]", customErrors.ErrInvalidInput)
+	}
+
+	categories := make(map[string]bool)
+	for _, rate := range t.Rates {
+		if rate.Category == "" || rate.Rate < 0 || rate.Rate > 100 || categories[rate.Category] {
+			return nil, fmt.Errorf("%w: tax rate for category %q", customErrors.ErrInvalidInput, rate.Category)
+		}
+		categories[rate.Category] = true
+	}
+	if t.Rates == nil {
+		t.Rates = []TaxRate{}
+	}
+	return &t, nil
+}
+
+// rate returns the tax rate of category.
+func (t TaxSettings) rate(category string) TaxRate {
+	for _, rate := range t.Rates {
+		if rate.Category == category {
+			if rate.Name == "" {
+				rate.Name = "Tax " + category
+			}
+			return rate
+		}
+	}
+	name := t.DefaultName
+	if name == "" {
+		name = "Tax"
+	}
+	return TaxRate{Category: category, Name: name, Rate: t.DefaultRate}
+}
+
+// ApplyTaxes works out the tax lines and the service charge of order from its
+// items and discounts. Discounts for a line lower the taxable amount of that
+// line's category; discounts for the whole order are spread over the
+// categories in proportion to their subtotal.
+func (t TaxSettings) ApplyTaxes(order *Order) {
+	subtotals := make(map[string]float64)
+	for _, item := range order.Items {
+		subtotals[item.Category] += item.LineTotal
+	}
+
+	taxable := make(map[string]float64)
+	for category, subtotal := range subtotals {
+		taxable[category] = subtotal
+	}
+	subtotal := order.Subtotal()
+	for _, discount := range order.Discounts {
+		if discount.ProductID != "" {
+			for _, item := range order.Items {
+				if item.ProductID == discount.ProductID && item.Variant == discount.Variant {
+					taxable[item.Category] -= discount.Amount
+					break
+				}
+			}
+			continue
+		}
+		if subtotal == 0 {
+			continue
+		}
+		for category, categorySubtotal := range subtotals {
+			taxable[category] -= discount.Amount * categorySubtotal / subtotal
+		}
+	}
+
+	categories := make([]string, 0, len(taxable))
+	for category := range taxable {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	order.Taxes = nil
+	for _, category := range categories {
+		rate := t.rate(category)
+		base := RoundMoney(max(taxable[category], 0))
+		if rate.Rate == 0 || base == 0 {
+			continue
+		}
+
+		amount := base * rate.Rate / 100
+		if t.Inclusive {
+			amount = base - base/(1+rate.Rate/100)
+		}
+		order.Taxes = append(order.Taxes, TaxLine{
+			Category: category,
+			Name:     rate.Name,
+			Rate:     rate.Rate,
+			Taxable:  base,
+			Amount:   RoundMoney(amount),
+		})
+	}
+
+	order.TaxInclusive = t.Inclusive
+	order.ServiceCharge = RoundMoney(max(subtotal-order.DiscountTotal(), 0) * t.ServiceCharge / 100)
+}
+
+// TaxSummary is the tax report over the orders created between From and To.
+type TaxSummary struct {
+	From          string    `json:"from,omitempty"`
+	To            string    `json:"to,omitempty"`
+	Orders        int       `json:"orders"`
+	Subtotal      float64   `json:"subtotal"`
+	DiscountTotal float64   `json:"discount_total"`
+	Taxes         []TaxLine `json:"taxes"`
+	TaxTotal      float64   `json:"tax_total"`
+	ServiceCharge float64   `json:"service_charge"`
+	Total         float64   `json:"total"`
+}
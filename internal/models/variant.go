@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+)
+
+// MenuItemVariant is a size or other variant of a menu item with its own
+// price. Its recipe is the menu item's with every quantity multiplied by Scale,
+// after which Ingredients override the quantity of single ingredients; an
+// override of 0 leaves the ingredient out.
+type MenuItemVariant struct {
+	ID          string               `json:"variant_id"`
+	Name        string               `json:"name"`
+	Price       float64              `json:"price"`
+	Scale       float64              `json:"scale,omitempty"`
+	Ingredients []MenuItemIngredient `json:"ingredients,omitempty"`
+}
+
+func validateVariants(variants []MenuItemVariant) error {
+	ids := make(map[string]bool)
+	for _, variant := range variants {
+		if variant.ID == "" || variant.Name == "" || variant.Price <= 0 || variant.Scale < 0 || ids[variant.ID] {
+			return fmt.Errorf("%w: variant %q", customErrors.ErrInvalidInput, variant.ID)
+		}
+		ids[variant.ID] = true
+
+		for _, ingredient := range variant.Ingredients {
+			if ingredient.IngredientID == "" || ingredient.Quantity < 0 {
+				return fmt.Errorf("%w: ingredient %q of variant %s", customErrors.ErrInvalidInput, ingredient.IngredientID, variant.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// Variant returns the variant of the menu item with the ID.
+func (m MenuItem) Variant(id string) (MenuItemVariant, bool) {
+	for _, variant := range m.Variants {
+		if variant.ID == id {
+			return variant, true
+		}
+	}
+	return MenuItemVariant{}, false
+}
+
+// variantRecipe returns the recipe of one unit of the variant, or of the menu
+// item itself for no variant or a variant no longer on the menu item.
+func (m MenuItem) variantRecipe(variantID string) map[string]float64 {
+	quantities := make(map[string]float64)
+	variant, exists := m.Variant(variantID)
+	scale := 1.0
+	if exists && variant.Scale != 0 {
+		scale = variant.Scale
+	}
+
+	for _, ingredient := range m.Ingredients {
+		quantities[ingredient.IngredientID] += ingredient.Quantity * scale
+	}
+	for _, ingredient := range variant.Ingredients {
+		quantities[ingredient.IngredientID] = ingredient.Quantity
+		if ingredient.Quantity == 0 {
+			delete(quantities, ingredient.IngredientID)
+		}
+	}
+	return quantities
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"net/url"
+	"time"
+)
+
+// Webhook events.
+const (
+	WebhookOrderCreated       = "order.created"
+	WebhookOrderStatusChanged = "order.status_changed"
+	WebhookOrderClosed        = "order.closed"
+	WebhookInventoryChanged   = "inventory.changed"
+	// WebhookAllEvents subscribes to every event.
+	WebhookAllEvents = "*"
+)
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription of a URL to events. Deliveries are signed with
+// Secret.
+type Webhook struct {
+	ID        string    `json:"webhook_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is the sending of one event to one webhook, with the outcome
+// of its last attempt. Payload is the exact body sent on every attempt.
+type WebhookDelivery struct {
+	ID             string          `json:"delivery_id"`
+	WebhookID      string          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookPayload is the body of a delivery.
+type WebhookPayload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// InventoryChange is the data of an inventory.changed event. Quantity is the
+// stock of the ingredient when the event is sent.
+type InventoryChange struct {
+	IngredientID string  `json:"ingredient_id"`
+	Change       string  `json:"change"`
+	Delta        float64 `json:"delta,omitempty"`
+	Quantity     float64 `json:"quantity"`
+	Unit         string  `json:"unit,omitempty"`
+	OrderID      string  `json:"order_id,omitempty"`
+}
+
+// WebhookEvents returns the events a webhook can subscribe to.
+func WebhookEvents() []string {
+	return []string{WebhookOrderCreated, WebhookOrderStatusChanged, WebhookOrderClosed, WebhookInventoryChanged}
+}
+
+// NewWebhook checks the URL and events of w, subscribing it to every event
+// when none are given.
+func NewWebhook(w Webhook) (*Webhook, error) {
+	target, err := url.Parse(w.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not an http or https URL", customErrors.ErrInvalidInput, w.URL)
+	}
+
+	if len(w.Events) == 0 {
+		w.Events = []string{WebhookAllEvents}
+	}
+	for _, event := range w.Events {
+		if event != WebhookAllEvents && !contains(WebhookEvents(), event) {
+			return nil, fmt.Errorf("%w: unknown event %q, available: %v", customErrors.ErrInvalidInput, event, WebhookEvents())
+		}
+	}
+	return &w, nil
+}
+
+// NewWebhookSecret makes up a secret for a webhook created without one.
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Subscribes reports whether the webhook wants event.
+func (w Webhook) Subscribes(event string) bool {
+	return contains(w.Events, WebhookAllEvents) || contains(w.Events, event)
+}
+
+// Redacted returns the webhook without its secret, which is only shown when
+// the webhook is created.
+func (w Webhook) Redacted() Webhook {
+	w.Secret = ""
+	return w
+}
+
+// SignWebhook returns the signature of a delivery body sent at timestamp, in
+// Unix seconds: the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by secret.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const (
+	tmpSuffix    = ".tmp"
+	backupSuffix = ".bak"
+)
+
+// replaceFile writes data to a temp file next to filePath, fsyncs it,
+// renames it into place and fsyncs the directory.
+func replaceFile(filePath string, data []byte) error {
+	tmpPath, err := writeTempFile(filePath, data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return syncDir(filepath.Dir(filePath))
+}
+
+// writeTempFile writes data to filePath + ".tmp" and fsyncs it.
+func writeTempFile(filePath string, data []byte) (string, error) {
+	tmpPath := filePath + tmpSuffix
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	return tmpPath, nil
+}
+
+func backupFile(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Never overwrite the last good copy with a broken primary file.
+	if !json.Valid(data) {
+		return nil
+	}
+
+	return replaceFile(filePath+backupSuffix, data)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// RecoverFile repairs filePath after an unclean shutdown. A leftover temp file
+// is promoted when the primary file is missing or corrupt and removed
+// otherwise; a corrupt primary file is restored from its last good copy.
+func RecoverFile(filePath string) error {
+	primary, err := os.ReadFile(filePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("repo error: reading file for recovery", "filePath", filePath, "error", err)
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+	}
+	primaryOK := err == nil && json.Valid(primary)
+
+	if err := os.Remove(filePath + backupSuffix + tmpSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	tmpPath := filePath + tmpSuffix
+	if tmp, err := os.ReadFile(tmpPath); err == nil {
+		if !primaryOK && json.Valid(tmp) {
+			if err := os.Rename(tmpPath, filePath); err != nil {
+				return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+			}
+			slog.Warn("repo recovery: promoted leftover temp file", "filePath", filePath)
+			return syncDir(filepath.Dir(filePath))
+		}
+		if err := os.Remove(tmpPath); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+		}
+		slog.Warn("repo recovery: removed leftover temp file", "filePath", tmpPath)
+	}
+
+	if primaryOK {
+		return nil
+	}
+
+	backup, err := os.ReadFile(filePath + backupSuffix)
+	if errors.Is(err, os.ErrNotExist) && isEmpty(primary) {
+		// Missing or empty file without any history: a fresh data directory.
+		return nil
+	}
+	if err != nil || !json.Valid(backup) {
+		slog.Error("repo error: data file is corrupt and no good copy is available", "filePath", filePath)
+		return fmt.Errorf("%w: %s is corrupt and cannot be recovered", customErrors.ErrJsonUnmarshal, filePath)
+	}
+
+	if err := replaceFile(filePath, backup); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	slog.Warn("repo recovery: restored data file from last good copy", "filePath", filePath)
+
+	return nil
+}
+
+func isEmpty(data []byte) bool {
+	return len(bytes.TrimSpace(data)) == 0
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"maps"
+	"reflect"
+)
+
+// table is the type-independent view of a collection the store uses to load,
+// diff, apply and save it.
+type table interface {
+	name() string
+	fileName() string
+	// key returns the key of an item given as JSON.
+	key(raw json.RawMessage) (string, error)
+	// reset empties the collection.
+	reset()
+	values() any
+	diff(staged any) change
+	diffStaged(st any) change
+	full() change
+	apply(ch change) error
+}
+
+// change is what one transaction did to one collection. Values are kept as
+// raw JSON so a change can be written to and replayed from the change log.
+type change struct {
+	Put map[string]json.RawMessage `json:"put,omitempty"`
+	Del []string                   `json:"del,omitempty"`
+}
+
+func (ch change) empty() bool {
+	return len(ch.Put) == 0 && len(ch.Del) == 0
+}
+
+type collection[T any] struct {
+	tableName string
+	file      string
+	keyField  string
+	items     map[string]T
+	// onChange is called with the old and new value (nil when absent) every
+	// time an item is put or removed; the store keeps its indexes with it.
+	onChange func(id string, old, new *T)
+}
+
+func newCollection[T any](name, file, keyField string) *collection[T] {
+	return &collection[T]{
+		tableName: name,
+		file:      file,
+		keyField:  keyField,
+		items:     make(map[string]T),
+	}
+}
+
+func (c *collection[T]) name() string {
+	return c.tableName
+}
+
+func (c *collection[T]) fileName() string {
+	return c.file
+}
+
+// key reads the key field without decoding the item into T, so that it
+// works for items saved by older schema versions too.
+func (c *collection[T]) key(raw json.RawMessage) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return "", fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+	}
+
+	var key string
+	if err := json.Unmarshal(fields[c.keyField], &key); err != nil {
+		return "", fmt.Errorf("%w: %s: missing %s", customErrors.ErrJsonUnmarshal, c.tableName, c.keyField)
+	}
+	return key, nil
+}
+
+func (c *collection[T]) reset() {
+	for id := range c.items {
+		c.remove(id)
+	}
+}
+
+func (c *collection[T]) values() any {
+	return mapValues(c.items)
+}
+
+// all returns a copy of the collection. Items are copied shallowly, so
+// callers must replace nested slices rather than modify them in place.
+func (c *collection[T]) all() map[string]T {
+	return maps.Clone(c.items)
+}
+
+func (c *collection[T]) diff(staged any) change {
+	stagedMap := staged.(map[string]T)
+
+	ch := change{Put: make(map[string]json.RawMessage)}
+	for id, item := range stagedMap {
+		if old, exists := c.items[id]; exists && reflect.DeepEqual(old, item) {
+			continue
+		}
+		// Values come from decoded JSON, so encoding them cannot fail.
+		raw, _ := json.Marshal(item)
+		ch.Put[id] = raw
+	}
+	for id := range c.items {
+		if _, exists := stagedMap[id]; !exists {
+			ch.Del = append(ch.Del, id)
+		}
+	}
+
+	return ch
+}
+
+// diffStaged is the change the staging of a transaction makes to the
+// collection. Items put back as they were are left out.
+func (c *collection[T]) diffStaged(st any) change {
+	staged := st.(*staging[T])
+
+	ch := change{Put: make(map[string]json.RawMessage, len(staged.put))}
+	for id, item := range staged.put {
+		if old, exists := c.items[id]; exists && reflect.DeepEqual(old, item) {
+			continue
+		}
+		raw, _ := json.Marshal(item)
+		ch.Put[id] = raw
+	}
+	for id := range staged.del {
+		if _, exists := c.items[id]; exists {
+			ch.Del = append(ch.Del, id)
+		}
+	}
+
+	return ch
+}
+
+// full is the change that recreates the whole collection from nothing.
+func (c *collection[T]) full() change {
+	ch := change{Put: make(map[string]json.RawMessage, len(c.items))}
+	for id, item := range c.items {
+		raw, _ := json.Marshal(item)
+		ch.Put[id] = raw
+	}
+	return ch
+}
+
+func (c *collection[T]) apply(ch change) error {
+	for id, raw := range ch.Put {
+		var item T
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		c.put(id, item)
+	}
+	for _, id := range ch.Del {
+		c.remove(id)
+	}
+	return nil
+}
+
+func (c *collection[T]) put(id string, item T) {
+	old, exists := c.items[id]
+	c.items[id] = item
+
+	if c.onChange == nil {
+		return
+	}
+	if exists {
+		c.onChange(id, &old, &item)
+	} else {
+		c.onChange(id, nil, &item)
+	}
+}
+
+func (c *collection[T]) remove(id string) {
+	old, exists := c.items[id]
+	if !exists {
+		return
+	}
+	delete(c.items, id)
+
+	if c.onChange != nil {
+		c.onChange(id, &old, nil)
+	}
+}
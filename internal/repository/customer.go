@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"hot-coffee/internal/models"
+	"strings"
+	"time"
+)
+
+type CustomerRepoImpl struct {
+	store *Store
+}
+
+func NewCustomerRepoImpl(store *Store) *CustomerRepoImpl {
+	return &CustomerRepoImpl{
+		store: store,
+	}
+}
+
+func (r *CustomerRepoImpl) GetCustomersRepo() (map[string]models.Customer, error) {
+	return all(r.store, r.store.customers), nil
+}
+
+// NewCustomerIDRepo returns the ID for a new customer.
+func (tx *Tx) NewCustomerIDRepo() (string, error) {
+	id, err := newULID(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return "cus_" + strings.ToLower(id), nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"sort"
+)
+
+// driver persists the store's collections. The store keeps everything in
+// memory; a driver only has to load the saved state once and record each
+// committed transaction durably.
+type driver interface {
+	// load reads the persisted state of tables.
+	load(tables []table) (loaded, error)
+	// append durably records the changes of one committed transaction.
+	append(changes map[string]change) error
+	// pending is the number of records appended since the last compaction.
+	pending() int
+	// compact replaces the persisted state with the current tables, saved
+	// at SchemaVersion.
+	compact(tables []table) error
+	// files lists the paths that hold the persisted state right after a
+	// compaction, or nothing when the driver keeps no files.
+	files(tables []table) []string
+	// journalPath is where the event journal is kept, or "" to keep none.
+	journalPath() string
+	close() error
+}
+
+// loaded is the persisted state as a driver read it.
+type loaded struct {
+	data dataset
+	// version is the schema version the data was saved in.
+	version int
+	// duplicates lists the items, as "collection/key", that were saved more
+	// than once. Only the last copy is kept in data.
+	duplicates []string
+}
+
+type driverFactory func(dir string) (driver, error)
+
+var drivers = make(map[string]driverFactory)
+
+func registerDriver(name string, factory driverFactory) {
+	drivers[name] = factory
+}
+
+// DriverNames lists the storage drivers that can be passed to OpenStore.
+func DriverNames() []string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func openDriver(name, dir string) (driver, error) {
+	factory, exists := drivers[name]
+	if !exists {
+		return nil, fmt.Errorf("%w %q, available: %v", customErrors.ErrUnknownStorage, name, DriverNames())
+	}
+	return factory(dir)
+}
+
+// applyChanges applies one transaction to tables. Callers hold the store's
+// lock, or own the tables exclusively while loading.
+func applyChanges(tables []table, changes map[string]change) error {
+	for _, t := range tables {
+		if ch, exists := changes[t.name()]; exists {
+			if err := t.apply(ch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package repository_test
+
+import (
+	"hot-coffee/internal/models"
+	"hot-coffee/internal/repository"
+	"hot-coffee/internal/service"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The repositories are the same whatever the driver, and must satisfy what the
+// services expect of them.
+var (
+	_ service.OrderListRepo = (*repository.OrderRepoImpl)(nil)
+	_ service.MenuRepo      = (*repository.MenuRepoImpl)(nil)
+	_ service.InventRepo    = (*repository.InventRepoImpl)(nil)
+	_ service.Tx            = (*repository.Tx)(nil)
+)
+
+// legacyOrder is an order as saved before the schema was versioned.
+const legacyOrder = `{"order_id":"order1","customer_name":"Ann","items":[{"product_id":"latte","quantity":2}],"status":"open","created_at":"2024-01-02 10:00:00"}`
+
+// testDriver is a storage driver under test. persistent drivers keep what was
+// committed across a reopen; writeLegacy saves legacyOrder the way the driver
+// did before the schema was versioned, if it ever did.
+type testDriver struct {
+	name        string
+	persistent  bool
+	writeLegacy func(t *testing.T, dir string)
+}
+
+var testDrivers = []testDriver{
+	{
+		name:       "json",
+		persistent: true,
+		writeLegacy: func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "orders.json"), "["+legacyOrder+"]")
+		},
+	},
+	{
+		name:       "log",
+		persistent: true,
+		writeLegacy: func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "hot-coffee.db"), `{"orders":{"put":{"order1":`+legacyOrder+`}}}`+"\n")
+		},
+	},
+	{
+		name: "memory",
+	},
+}
+
+// TestDrivers runs the same cases against every storage driver.
+func TestDrivers(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, d testDriver, dir string)
+	}{
+		{name: "load", run: testLoad},
+		{name: "commit", run: testCommit},
+		{name: "reload", run: testReload},
+		{name: "rollback", run: testRollback},
+		{name: "migration", run: testMigration},
+		{name: "webhook secret", run: testWebhookSecret},
+		{name: "journal", run: testJournal},
+	}
+
+	for _, d := range testDrivers {
+		for _, tt := range tests {
+			t.Run(d.name+"/"+tt.name, func(t *testing.T) {
+				tt.run(t, d, t.TempDir())
+			})
+		}
+	}
+
+	names := repository.DriverNames()
+	if len(names) != len(testDrivers) {
+		t.Errorf("got drivers %v, want the %d under test", names, len(testDrivers))
+	}
+}
+
+func testLoad(t *testing.T, d testDriver, dir string) {
+	store := openStore(t, d, dir)
+	defer closeStore(t, store)
+
+	if orders, _ := repository.NewOrderRepoImpl(store).GetOrdersRepo(); len(orders) != 0 {
+		t.Errorf("got %d orders in a new store, want none", len(orders))
+	}
+	if invents, _ := repository.NewInventRepoImpl(store).GetInventsRepo(); len(invents) != 0 {
+		t.Errorf("got %d inventory items in a new store, want none", len(invents))
+	}
+}
+
+func testCommit(t *testing.T, d testDriver, dir string) {
+	store := openStore(t, d, dir)
+	defer closeStore(t, store)
+
+	commitSample(t, store)
+	checkSample(t, store)
+}
+
+func testReload(t *testing.T, d testDriver, dir string) {
+	store := openStore(t, d, dir)
+	commitSample(t, store)
+	closeStore(t, store)
+
+	store = openStore(t, d, dir)
+	defer closeStore(t, store)
+
+	if d.persistent {
+		checkSample(t, store)
+		return
+	}
+	if orders, _ := repository.NewOrderRepoImpl(store).GetOrdersRepo(); len(orders) != 0 {
+		t.Errorf("got %d orders after reopening, want none kept", len(orders))
+	}
+}
+
+func testRollback(t *testing.T, d testDriver, dir string) {
+	store := openStore(t, d, dir)
+
+	tx, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := tx.UpdateInventsRepo(map[string]models.InventoryItem{"milk": sampleMilk}); err != nil {
+		t.Fatalf("UpdateInventsRepo: %v", err)
+	}
+	if err := tx.RecordEvent(models.EventInventoryCreated, sampleMilk); err != nil {
+		t.Fatalf("RecordEvent: %v", err)
+	}
+	tx.Rollback()
+
+	if invents, _ := repository.NewInventRepoImpl(store).GetInventsRepo(); len(invents) != 0 {
+		t.Errorf("got %d inventory items after a rollback, want none", len(invents))
+	}
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Commit after Rollback succeeded, want an error")
+	}
+
+	// The rollback let go of the store.
+	commitSample(t, store)
+	closeStore(t, store)
+
+	store = openStore(t, d, dir)
+	defer closeStore(t, store)
+	if d.persistent {
+		checkSample(t, store)
+	}
+}
+
+func testMigration(t *testing.T, d testDriver, dir string) {
+	if d.writeLegacy == nil {
+		t.Skipf("the %s driver never saved unversioned data", d.name)
+	}
+	d.writeLegacy(t, dir)
+
+	version, steps, err := repository.PlanMigrations(d.name, dir)
+	if err != nil {
+		t.Fatalf("PlanMigrations: %v", err)
+	}
+	if version != 1 || len(steps) != repository.SchemaVersion-1 {
+		t.Errorf("got version %d with %d migrations to run, want version 1 with %d", version, len(steps), repository.SchemaVersion-1)
+	}
+
+	store := openStore(t, d, dir)
+	order, err := repository.NewOrderRepoImpl(store).GetOrdersRepo()
+	if err != nil {
+		t.Fatalf("GetOrdersRepo: %v", err)
+	}
+	got := order["order1"]
+	want := time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+	if got.Status != models.StatusPending || !got.CreatedAt.Equal(want) || len(got.StatusHistory) != 1 {
+		t.Errorf("got the order migrated to status %q created at %v with %d status changes, want %q at %v with 1", got.Status, got.CreatedAt, len(got.StatusHistory), models.StatusPending, want)
+	}
+	if len(got.Items) != 1 || got.Items[0].Quantity != 2 {
+		t.Errorf("got order lines %+v, want 2 of latte", got.Items)
+	}
+	if pending, _ := repository.NewOrderRepoImpl(store).GetOrdersByStatusRepo(models.StatusPending); len(pending) != 1 {
+		t.Errorf("got %d pending orders from the index, want 1", len(pending))
+	}
+	closeStore(t, store)
+
+	// The migrated data was saved, so there is nothing left to migrate.
+	version, steps, err = repository.PlanMigrations(d.name, dir)
+	if err != nil {
+		t.Fatalf("PlanMigrations after migrating: %v", err)
+	}
+	if version != repository.SchemaVersion || len(steps) != 0 {
+		t.Errorf("got version %d with %d migrations to run after migrating, want version %d with none", version, len(steps), repository.SchemaVersion)
+	}
+}
+
+// testWebhookSecret checks that a webhook secret is kept, across a reopen for
+// persistent drivers, but never in the webhooks or the journal.
+func testWebhookSecret(t *testing.T, d testDriver, dir string) {
+	const secret = "whsec_test"
+	webhook := models.Webhook{ID: "wh_1", URL: "http://example.com/hook", Events: []string{models.WebhookAllEvents}}
+
+	store := openStore(t, d, dir)
+	tx, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := tx.UpdateWebhooksRepo(map[string]models.Webhook{webhook.ID: webhook}); err != nil {
+		t.Fatalf("UpdateWebhooksRepo: %v", err)
+	}
+	if err := tx.SetWebhookSecretRepo(webhook.ID, secret); err != nil {
+		t.Fatalf("SetWebhookSecretRepo: %v", err)
+	}
+	if err := tx.RecordEvent(models.EventWebhookCreated, models.WebhookCreated{Webhook: webhook}); err != nil {
+		t.Fatalf("RecordEvent: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	closeStore(t, store)
+
+	store = openStore(t, d, dir)
+	defer closeStore(t, store)
+
+	webhookRepo := repository.NewWebhookRepoImpl(store)
+	got, exists, err := webhookRepo.GetWebhookSecretRepo(webhook.ID)
+	if err != nil {
+		t.Fatalf("GetWebhookSecretRepo: %v", err)
+	}
+	if d.persistent && (!exists || got != secret) {
+		t.Errorf("got secret %q after reopening, want %q", got, secret)
+	}
+	if webhooks, _ := webhookRepo.GetWebhooksRepo(); webhooks[webhook.ID].Secret != "" {
+		t.Errorf("got the secret saved with the webhook")
+	}
+
+	events, err := repository.NewJournalRepoImpl(store).GetEventsRepo()
+	if err != nil {
+		t.Fatalf("GetEventsRepo: %v", err)
+	}
+	for _, event := range events {
+		if strings.Contains(string(event.Data), secret) {
+			t.Errorf("got the secret in the journal event %s", event.Type)
+		}
+	}
+}
+
+// testJournal reads the journal from a seq, before and after a reopen.
+func testJournal(t *testing.T, d testDriver, dir string) {
+	store := openStore(t, d, dir)
+
+	for _, delta := range []float64{-100, -200, 50} {
+		tx, err := store.Begin()
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		if err := tx.RecordEvent(models.EventInventoryAdjusted, models.InventoryAdjusted{IngredientID: "milk", Delta: delta}); err != nil {
+			t.Fatalf("RecordEvent: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+	}
+
+	checkEvents := func(store *repository.Store) {
+		t.Helper()
+
+		journalRepo := repository.NewJournalRepoImpl(store)
+		all, err := journalRepo.GetEventsRepo()
+		if err != nil {
+			t.Fatalf("GetEventsRepo: %v", err)
+		}
+		if !d.persistent {
+			return
+		}
+		if len(all) != 3 {
+			t.Fatalf("got %d events, want 3", len(all))
+		}
+
+		after, err := journalRepo.GetEventsAfterRepo(all[0].Seq)
+		if err != nil {
+			t.Fatalf("GetEventsAfterRepo: %v", err)
+		}
+		if len(after) != 2 || after[0].Seq != all[1].Seq || after[1].Seq != all[2].Seq {
+			t.Errorf("got %v after seq %d, want the last two events", after, all[0].Seq)
+		}
+		if after, _ := journalRepo.GetEventsAfterRepo(all[2].Seq); len(after) != 0 {
+			t.Errorf("got %d events after the last one, want none", len(after))
+		}
+	}
+
+	checkEvents(store)
+	closeStore(t, store)
+
+	store = openStore(t, d, dir)
+	defer closeStore(t, store)
+	checkEvents(store)
+}
+
+var (
+	sampleMilk  = models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 1000, Unit: "ml"}
+	sampleOrder = models.Order{
+		ID:            "order1",
+		CustomerName:  "Ann",
+		Items:         []models.OrderItem{{ProductID: "latte", Quantity: 1}},
+		Status:        models.StatusPending,
+		CreatedAt:     time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+		StatusHistory: []models.StatusChange{},
+	}
+)
+
+// commitSample commits sampleMilk and sampleOrder in one transaction.
+func commitSample(t *testing.T, store *repository.Store) {
+	t.Helper()
+
+	tx, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.UpdateInventsRepo(map[string]models.InventoryItem{"milk": sampleMilk}); err != nil {
+		t.Fatalf("UpdateInventsRepo: %v", err)
+	}
+	if err := tx.UpdateOrdersRepo(map[string]models.Order{sampleOrder.ID: sampleOrder}); err != nil {
+		t.Fatalf("UpdateOrdersRepo: %v", err)
+	}
+	if err := tx.RecordEvent(models.EventInventoryCreated, sampleMilk); err != nil {
+		t.Fatalf("RecordEvent: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
+
+// checkSample checks that what commitSample committed is in store, and found
+// by the order indexes.
+func checkSample(t *testing.T, store *repository.Store) {
+	t.Helper()
+
+	invents, err := repository.NewInventRepoImpl(store).GetInventsRepo()
+	if err != nil {
+		t.Fatalf("GetInventsRepo: %v", err)
+	}
+	if invents["milk"] != sampleMilk || len(invents) != 1 {
+		t.Errorf("got inventory %+v, want only %+v", invents, sampleMilk)
+	}
+
+	orderRepo := repository.NewOrderRepoImpl(store)
+	orders, err := orderRepo.GetOrdersRepo()
+	if err != nil {
+		t.Fatalf("GetOrdersRepo: %v", err)
+	}
+	if got := orders[sampleOrder.ID]; len(orders) != 1 || got.CustomerName != sampleOrder.CustomerName || !got.CreatedAt.Equal(sampleOrder.CreatedAt) {
+		t.Errorf("got orders %+v, want only %+v", orders, sampleOrder)
+	}
+	if pending, _ := orderRepo.GetOrdersByStatusRepo(models.StatusPending); len(pending) != 1 {
+		t.Errorf("got %d pending orders from the index, want 1", len(pending))
+	}
+	if closed, _ := orderRepo.GetOrdersByStatusRepo(models.StatusClosed); len(closed) != 0 {
+		t.Errorf("got %d closed orders from the index, want none", len(closed))
+	}
+}
+
+func openStore(t *testing.T, d testDriver, dir string) *repository.Store {
+	t.Helper()
+	store, err := repository.OpenStore(d.name, dir, models.OrderIDSequential)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	return store
+}
+
+func closeStore(t *testing.T, store *repository.Store) {
+	t.Helper()
+	if err := store.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func writeFile(t *testing.T, filePath, data string) {
+	t.Helper()
+	if err := os.WriteFile(filePath, []byte(data), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", filePath, err)
+	}
+}
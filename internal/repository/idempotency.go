@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const idempotencyLogFile = "idempotency.jsonl"
+
+// IdempotencyLogImpl keeps the responses stored for idempotency keys. Like the
+// webhook delivery log it appends every record to a file, next to the data of
+// a store with a journal, and keeps it in memory only otherwise. Expired
+// records are dropped when the file is opened and every compactEvery saves.
+type IdempotencyLogImpl struct {
+	mu      sync.Mutex
+	log     *lineLog
+	records map[string]models.IdempotencyRecord
+	// saves counts the records saved since the last compaction.
+	saves int
+}
+
+// OpenIdempotencyLog loads the idempotency records kept next to the data of
+// store.
+func OpenIdempotencyLog(store *Store) (*IdempotencyLogImpl, error) {
+	il := &IdempotencyLogImpl{
+		records: make(map[string]models.IdempotencyRecord),
+	}
+	if store.driver.journalPath() == "" {
+		return il, nil
+	}
+
+	log, err := openLineLog(filepath.Join(store.dir, idempotencyLogFile))
+	if err != nil {
+		return nil, err
+	}
+	err = log.replay(func(line []byte, end int64) error {
+		var record models.IdempotencyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		il.records[record.Key] = record
+		return nil
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+	il.log = log
+
+	if err := il.compact(time.Now()); err != nil {
+		log.close()
+		return nil, err
+	}
+	return il, nil
+}
+
+// GetIdempotencyRepo returns the record of key, expired or not.
+func (l *IdempotencyLogImpl) GetIdempotencyRepo(key string) (models.IdempotencyRecord, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, exists := l.records[key]
+	return record, exists, nil
+}
+
+// SaveIdempotencyRepo records record, replacing any earlier record of its key.
+func (l *IdempotencyLogImpl) SaveIdempotencyRepo(record models.IdempotencyRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.log != nil {
+		if err := l.log.append(record); err != nil {
+			return err
+		}
+	}
+	l.records[record.Key] = record
+
+	if l.saves++; l.saves >= compactEvery {
+		// A failed compaction leaves the log as it was; the record is
+		// saved either way.
+		if err := l.compact(time.Now()); err != nil {
+			slog.Error("Store: compacting the idempotency log", "error", err)
+		}
+	}
+	return nil
+}
+
+func (l *IdempotencyLogImpl) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.log == nil {
+		return nil
+	}
+	return l.log.close()
+}
+
+// compact drops the records expired at now, and rewrites the log when it holds
+// anything else than the live records.
+func (l *IdempotencyLogImpl) compact(now time.Time) error {
+	l.saves = 0
+	for key, record := range l.records {
+		if record.Expired(now) {
+			delete(l.records, key)
+		}
+	}
+	if l.log == nil || l.log.count == len(l.records) {
+		return nil
+	}
+
+	live := make([]models.IdempotencyRecord, 0, len(l.records))
+	for _, record := range l.records {
+		live = append(live, record)
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].CreatedAt.Before(live[j].CreatedAt)
+	})
+	records := make([]any, 0, len(live))
+	for _, record := range live {
+		records = append(records, record)
+	}
+	return l.log.rewrite(records...)
+}
@@ -0,0 +1,36 @@
+package repository
+
+import "sort"
+
+// index maps a secondary key (a status, a customer, a day) to the IDs of the
+// items that have it.
+type index map[string]map[string]struct{}
+
+func (ix index) add(key, id string) {
+	ids, exists := ix[key]
+	if !exists {
+		ids = make(map[string]struct{})
+		ix[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (ix index) remove(key, id string) {
+	ids, exists := ix[key]
+	if !exists {
+		return
+	}
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(ix, key)
+	}
+}
+
+func (ix index) ids(key string) []string {
+	ids := make([]string, 0, len(ix[key]))
+	for id := range ix[key] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,32 @@
+package repository
+
+import "slices"
+
+type IntegrityRepoImpl struct {
+	store *Store
+}
+
+func NewIntegrityRepoImpl(store *Store) *IntegrityRepoImpl {
+	return &IntegrityRepoImpl{
+		store: store,
+	}
+}
+
+// GetDuplicatesRepo returns the items, as "collection/key", that the data
+// files held more than once when the store was loaded. Only the last copy of
+// each was kept.
+func (r *IntegrityRepoImpl) GetDuplicatesRepo() ([]string, error) {
+	r.store.writer.Lock()
+	defer r.store.writer.Unlock()
+
+	return slices.Clone(r.store.duplicates), nil
+}
+
+// RewriteRepo saves the data files again from memory, which drops the
+// duplicate copies.
+func (r *IntegrityRepoImpl) RewriteRepo() error {
+	r.store.writer.Lock()
+	defer r.store.writer.Unlock()
+
+	return r.store.compact()
+}
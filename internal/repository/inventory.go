@@ -1,50 +1,34 @@
 package repository
 
 import (
-	"encoding/json"
-	"fmt"
-	"hot-coffee/internal/customErrors"
 	"hot-coffee/internal/models"
-	"log/slog"
 )
 
 type InventRepoImpl struct {
-	filePath string
+	store *Store
 }
 
-func NewInventRepoImpl(filepath string) *InventRepoImpl {
+func NewInventRepoImpl(store *Store) *InventRepoImpl {
 	return &InventRepoImpl{
-		filePath: filepath,
+		store: store,
 	}
 }
 
 func (r *InventRepoImpl) GetInventsRepo() (map[string]models.InventoryItem, error) {
-	data, err := readJSON(r.filePath)
-	if err != nil {
-		slog.Error("Inventory repository: GetInventsRepo method")
-		return nil, err
-	}
-
-	var invents []models.InventoryItem
-
-	if err := json.Unmarshal(data, &invents); err != nil {
-		slog.Error("Inventory repository in GetInventsRepo method: decoding JSON")
-		return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
-	}
-
-	inventoryMap := make(map[string]models.InventoryItem)
-	for _, item := range invents {
-		inventoryMap[item.IngredientID] = item
-	}
-
-	return inventoryMap, nil
+	return all(r.store, r.store.invents), nil
 }
 
+// UpdateInventsRepo replaces the inventory in a transaction of its own. It
+// must not be called while the caller holds another transaction.
 func (r *InventRepoImpl) UpdateInventsRepo(inventMap map[string]models.InventoryItem) error {
-	var invents []models.InventoryItem
-	for _, invent := range inventMap {
-		invents = append(invents, invent)
+	tx, err := r.store.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return saveJSONToFile(r.filePath, invents)
+	if err := tx.UpdateInventsRepo(inventMap); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
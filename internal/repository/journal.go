@@ -0,0 +1,340 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+const (
+	eventJournalFile = "events.jsonl"
+	journalSequence  = "journal"
+)
+
+// eventJournal is the append-only log of the domain events recorded by the
+// services, one models.Event per line. Without a log it only numbers the
+// events.
+//
+// Events are appended under the writer lock of the store, but read under mu
+// only, so reading the journal never holds up a transaction. The index maps
+// the seq of every committed event to its offset, so a read starts at the
+// first event it wants.
+type eventJournal struct {
+	log     *lineLog
+	lastSeq int64
+
+	// pending are the entries of the events appended by the commit in
+	// progress; they join index once the commit goes through.
+	pending []journalEntry
+
+	mu        sync.RWMutex
+	index     []journalEntry
+	committed int64
+}
+
+// journalEntry is where an event starts in the journal.
+type journalEntry struct {
+	seq    int64
+	offset int64
+}
+
+// openJournal opens the journal and drops every event after committedSeq:
+// those were written by a transaction whose state change never made it to
+// the store.
+func openJournal(filePath string, committedSeq int64) (*eventJournal, error) {
+	log, err := openLineLog(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &eventJournal{log: log}
+	var committedEnd int64
+	uncommitted := 0
+	secrets := false
+	err = log.replay(func(line []byte, end int64) error {
+		var event models.Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		if event.Seq <= committedSeq {
+			committedEnd = end
+			j.lastSeq = event.Seq
+			j.index = append(j.index, journalEntry{seq: event.Seq, offset: end - int64(len(line))})
+			if !secrets {
+				_, found, err := redactSecrets(event)
+				if err != nil {
+					return err
+				}
+				secrets = found
+			}
+		} else {
+			uncommitted++
+		}
+		return nil
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+
+	if uncommitted > 0 {
+		slog.Warn("repo recovery: dropping uncommitted journal events", "events", uncommitted)
+		if err := log.truncateAt(committedEnd); err != nil {
+			log.close()
+			return nil, err
+		}
+	}
+	if j.lastSeq < committedSeq {
+		slog.Warn("repo warning: event journal is missing events", "lastSeq", j.lastSeq, "committedSeq", committedSeq)
+		j.lastSeq = committedSeq
+	}
+	if secrets {
+		if err := j.dropSecrets(); err != nil {
+			log.close()
+			return nil, err
+		}
+	}
+	j.committed = j.log.size
+
+	return j, nil
+}
+
+// dropSecrets rewrites the journal without the webhook secrets that older
+// builds recorded in it.
+func (j *eventJournal) dropSecrets() error {
+	events, err := j.events()
+	if err != nil {
+		return err
+	}
+
+	records := make([]any, len(events))
+	index := make([]journalEntry, len(events))
+	var offset int64
+	redacted := 0
+	for i, event := range events {
+		event, found, err := redactSecrets(event)
+		if err != nil {
+			return err
+		}
+		if found {
+			redacted++
+		}
+		records[i] = event
+
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+		}
+		index[i] = journalEntry{seq: event.Seq, offset: offset}
+		offset += int64(len(line)) + 1
+	}
+	if err := j.log.rewrite(records...); err != nil {
+		return err
+	}
+	j.index = index
+	slog.Info("Store: removed webhook secrets from the event journal", "events", redacted)
+	return nil
+}
+
+// redactSecrets returns event without the webhook secrets in its data, and
+// whether there were any.
+func redactSecrets(event models.Event) (models.Event, bool, error) {
+	if !bytes.Contains(event.Data, []byte(`"secret"`)) {
+		return event, false, nil
+	}
+
+	var data any
+	found := false
+	switch event.Type {
+	case models.EventWebhookCreated, models.EventWebhookUpdated:
+		// Both events carry the webhook the same way.
+		var created models.WebhookCreated
+		if err := json.Unmarshal(event.Data, &created); err != nil {
+			return event, false, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		found = created.Webhook.Secret != ""
+		created.Webhook = created.Webhook.Redacted()
+		data = created
+
+	case models.EventStateImported:
+		var imported models.StateImported
+		if err := json.Unmarshal(event.Data, &imported); err != nil {
+			return event, false, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		found = redactWebhooks(imported.Webhooks)
+		data = imported
+
+	case models.EventStateRestored:
+		var restored models.StateRestored
+		if err := json.Unmarshal(event.Data, &restored); err != nil {
+			return event, false, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		found = redactWebhooks(restored.Webhooks)
+		data = restored
+	}
+	if !found {
+		return event, false, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return event, false, fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+	}
+	event.Data = raw
+	return event, true, nil
+}
+
+// redactWebhooks drops the secrets of webhooks and reports whether there were
+// any.
+func redactWebhooks(webhooks []models.Webhook) bool {
+	found := false
+	for i, webhook := range webhooks {
+		found = found || webhook.Secret != ""
+		webhooks[i] = webhook.Redacted()
+	}
+	return found
+}
+
+// append numbers events and writes them with a single fsync. Readers only see
+// them once commit is called.
+func (j *eventJournal) append(events []models.Event) error {
+	for i := range events {
+		events[i].Seq = j.lastSeq + int64(i) + 1
+	}
+
+	if j.log != nil {
+		var lines []byte
+		pending := make([]journalEntry, len(events))
+		for i, event := range events {
+			pending[i] = journalEntry{seq: event.Seq, offset: j.log.size + int64(len(lines))}
+			line, err := encodeLines([]any{event})
+			if err != nil {
+				return err
+			}
+			lines = append(lines, line...)
+		}
+		if err := j.log.appendLines(lines, len(events)); err != nil {
+			return err
+		}
+		j.pending = pending
+	}
+	j.lastSeq += int64(len(events))
+	return nil
+}
+
+// commit makes the events of the last append visible to readers.
+func (j *eventJournal) commit() {
+	if j.log == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.index = append(j.index, j.pending...)
+	j.committed = j.log.size
+	j.pending = nil
+}
+
+// size returns the size of the log, which undo cuts it back to.
+func (j *eventJournal) size() int64 {
+	if j.log == nil {
+		return 0
+	}
+	return j.log.size
+}
+
+// undo removes the last n events again after the transaction that wrote them
+// failed to commit.
+func (j *eventJournal) undo(n int, size int64) error {
+	if j.log != nil {
+		if err := j.log.truncateAt(size); err != nil {
+			return err
+		}
+	}
+	j.lastSeq -= int64(n)
+	j.pending = nil
+	return nil
+}
+
+func (j *eventJournal) events() ([]models.Event, error) {
+	if j.log == nil {
+		return nil, nil
+	}
+
+	var events []models.Event
+	err := j.log.replay(func(line []byte, end int64) error {
+		var event models.Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// eventsAfter returns the committed events after seq. It looks up where they
+// start under mu and reads them without it: the committed part of the log is
+// never written again.
+func (j *eventJournal) eventsAfter(seq int64) ([]models.Event, error) {
+	if j.log == nil {
+		return nil, nil
+	}
+
+	j.mu.RLock()
+	i := sort.Search(len(j.index), func(i int) bool { return j.index[i].seq > seq })
+	if i == len(j.index) {
+		j.mu.RUnlock()
+		return nil, nil
+	}
+	start, end, file := j.index[i].offset, j.committed, j.log.file
+	j.mu.RUnlock()
+
+	var events []models.Event
+	reader := bufio.NewReader(io.NewSectionReader(file, start, end-start))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+		}
+
+		var event models.Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		events = append(events, event)
+	}
+}
+
+type JournalRepoImpl struct {
+	store *Store
+}
+
+func NewJournalRepoImpl(store *Store) *JournalRepoImpl {
+	return &JournalRepoImpl{
+		store: store,
+	}
+}
+
+// GetEventsRepo returns every event in the journal, oldest first.
+func (r *JournalRepoImpl) GetEventsRepo() ([]models.Event, error) {
+	return r.GetEventsAfterRepo(0)
+}
+
+// GetEventsAfterRepo returns the events in the journal after seq, oldest
+// first.
+func (r *JournalRepoImpl) GetEventsAfterRepo(seq int64) ([]models.Event, error) {
+	return r.store.journal.eventsAfter(seq)
+}
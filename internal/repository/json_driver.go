@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"log/slog"
+	"path/filepath"
+)
+
+func init() {
+	registerDriver("json", newJSONDriver)
+}
+
+// jsonDriver keeps one JSON file per collection in the data directory plus a
+// change log with the transactions committed since the files were last
+// rewritten. Each file is an envelope holding the schema version and the
+// array of items; files written before versioning are bare arrays.
+type jsonDriver struct {
+	dir     string
+	changes *lineLog
+}
+
+func newJSONDriver(dir string) (driver, error) {
+	return &jsonDriver{dir: dir}, nil
+}
+
+func (d *jsonDriver) load(tables []table) (loaded, error) {
+	if err := RecoverTransaction(d.dir); err != nil {
+		slog.Error("JSON driver: recovering interrupted transaction", "error", err)
+		return loaded{}, err
+	}
+
+	ds := newDataset(tables)
+	var duplicates []string
+	// Files agree on their version, since compaction rewrites them all at
+	// once. Files without items say nothing about it, so a fresh data
+	// directory starts at the current version.
+	version := 0
+	for _, t := range tables {
+		filePath := filepath.Join(d.dir, t.fileName())
+		if err := RecoverFile(filePath); err != nil {
+			slog.Error("JSON driver: recovering data file", "filePath", filePath, "error", err)
+			return loaded{}, err
+		}
+
+		data, err := readJSON(filePath)
+		if err != nil {
+			return loaded{}, err
+		}
+		fileVersion, items, err := decodeDataFile(data)
+		if err != nil {
+			slog.Error("JSON driver: loading data file", "filePath", filePath, "error", err)
+			return loaded{}, err
+		}
+		if fileVersion != legacySchemaVersion || len(items) != 0 {
+			if version == 0 || fileVersion < version {
+				version = fileVersion
+			}
+		}
+
+		for _, raw := range items {
+			key, err := t.key(raw)
+			if err != nil {
+				slog.Error("JSON driver: loading data file", "filePath", filePath, "error", err)
+				return loaded{}, err
+			}
+			if _, exists := ds[t.name()][key]; exists {
+				slog.Warn("JSON driver: duplicate item, keeping the last one", "filePath", filePath, "key", key)
+				duplicates = append(duplicates, t.name()+"/"+key)
+			}
+			ds[t.name()][key] = raw
+		}
+	}
+	if version == 0 {
+		version = SchemaVersion
+	}
+
+	changes, err := openLineLog(filepath.Join(d.dir, changeLogFile))
+	if err != nil {
+		return loaded{}, err
+	}
+	d.changes = changes
+
+	if err := replayChanges(d.changes, ds); err != nil {
+		return loaded{}, err
+	}
+	return loaded{data: ds, version: version, duplicates: duplicates}, nil
+}
+
+// decodeDataFile returns the schema version and the items of a data file.
+func decodeDataFile(data []byte) (int, []json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+
+	var items []json.RawMessage
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return 0, nil, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		return legacySchemaVersion, items, nil
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+	}
+	if env.SchemaVersion <= 0 {
+		return 0, nil, fmt.Errorf("%w: missing schema_version", customErrors.ErrSchemaVersion)
+	}
+	if err := json.Unmarshal(env.Data, &items); err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+	}
+	return env.SchemaVersion, items, nil
+}
+
+func (d *jsonDriver) append(changes map[string]change) error {
+	return d.changes.append(changes)
+}
+
+func (d *jsonDriver) pending() int {
+	return d.changes.count
+}
+
+func (d *jsonDriver) compact(tables []table) error {
+	files := make(map[string]any, len(tables))
+	for _, t := range tables {
+		data, err := json.Marshal(t.values())
+		if err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+		}
+		files[filepath.Join(d.dir, t.fileName())] = envelope{SchemaVersion: SchemaVersion, Data: data}
+	}
+
+	if err := saveJSONFilesAtomic(d.dir, files); err != nil {
+		return err
+	}
+	return d.changes.truncate()
+}
+
+func (d *jsonDriver) files(tables []table) []string {
+	paths := make([]string, 0, len(tables))
+	for _, t := range tables {
+		paths = append(paths, filepath.Join(d.dir, t.fileName()))
+	}
+	return paths
+}
+
+func (d *jsonDriver) journalPath() string {
+	return filepath.Join(d.dir, eventJournalFile)
+}
+
+func (d *jsonDriver) close() error {
+	if d.changes == nil {
+		return nil
+	}
+	return d.changes.close()
+}
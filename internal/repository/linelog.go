@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const changeLogFile = "changes.log"
+
+// lineLog is an append-only file of JSON records, one per line. It backs the
+// change log of the storage drivers, the event journal and the webhook
+// delivery log.
+type lineLog struct {
+	file  *os.File
+	size  int64
+	count int
+}
+
+func openLineLog(filePath string) (*lineLog, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		slog.Error("repo error: opening log file", "filePath", filePath, "error", err)
+		return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonOpen, err)
+	}
+	return &lineLog{file: file}, nil
+}
+
+// replay calls fn for every record in the log together with the offset just
+// past it. A torn last record, left by a crash in the middle of an append, is
+// cut off.
+func (l *lineLog) replay(fn func(line []byte, end int64) error) error {
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+	}
+
+	l.count = 0
+	reader := bufio.NewReader(l.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) != 0 {
+				slog.Warn("repo recovery: dropping torn log record", "filePath", l.file.Name(), "offset", offset)
+				if err := l.truncateAt(offset); err != nil {
+					return err
+				}
+			}
+			l.size = offset
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+		}
+
+		offset += int64(len(line))
+		if err := fn(line, offset); err != nil {
+			slog.Error("repo error: corrupt log record", "filePath", l.file.Name(), "offset", offset-int64(len(line)), "error", err)
+			return err
+		}
+		l.count++
+	}
+}
+
+// encodeLines returns records as lines of JSON.
+func encodeLines(records []any) ([]byte, error) {
+	var lines []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	return lines, nil
+}
+
+// append writes records and fsyncs them; once it returns the records
+// survive a crash.
+func (l *lineLog) append(records ...any) error {
+	lines, err := encodeLines(records)
+	if err != nil {
+		return err
+	}
+	return l.appendLines(lines, len(records))
+}
+
+// appendLines is append for count records already encoded as lines.
+func (l *lineLog) appendLines(lines []byte, count int) error {
+	if _, err := l.file.Write(lines); err != nil {
+		slog.Error("repo error: appending to log file", "filePath", l.file.Name(), "error", err)
+		// Cut off whatever part of the record made it, so later records
+		// are not appended after a torn one.
+		l.file.Truncate(l.size)
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	if err := l.file.Sync(); err != nil {
+		slog.Error("repo error: syncing log file", "filePath", l.file.Name(), "error", err)
+		l.file.Truncate(l.size)
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	l.size += int64(len(lines))
+	l.count += count
+	return nil
+}
+
+// truncateAt drops every record past offset. It does not adjust count.
+func (l *lineLog) truncateAt(offset int64) error {
+	if err := l.file.Truncate(offset); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	l.size = offset
+	return nil
+}
+
+func (l *lineLog) truncate() error {
+	if err := l.truncateAt(0); err != nil {
+		return err
+	}
+
+	l.count = 0
+	return nil
+}
+
+// rewrite atomically replaces the whole log with records.
+func (l *lineLog) rewrite(records ...any) error {
+	lines, err := encodeLines(records)
+	if err != nil {
+		return err
+	}
+
+	filePath := l.file.Name()
+	if err := replaceFile(filePath, lines); err != nil {
+		slog.Error("repo error: rewriting log file", "filePath", filePath, "error", err)
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonOpen, err)
+	}
+	l.file.Close()
+	l.file = file
+
+	l.size = int64(len(lines))
+	l.count = len(records)
+	return nil
+}
+
+func (l *lineLog) close() error {
+	return l.file.Close()
+}
+
+// replayChanges applies every change record in l to ds.
+func replayChanges(l *lineLog, ds dataset) error {
+	return l.replay(func(line []byte, end int64) error {
+		var changes map[string]change
+		if err := json.Unmarshal(line, &changes); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		ds.apply(changes)
+		return nil
+	})
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+)
+
+var fileLocks sync.Map
+
+// fileLock returns the lock guarding filePath. Readers take it shared, so they
+// never observe a file in the middle of being backed up and replaced.
+func fileLock(filePath string) *sync.RWMutex {
+	lock, _ := fileLocks.LoadOrStore(filePath, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+// lockFiles write-locks several files in a fixed order, so two callers
+// locking overlapping sets cannot deadlock.
+func lockFiles(filePaths []string) (unlock func()) {
+	sorted := append([]string(nil), filePaths...)
+	sort.Strings(sorted)
+
+	locks := make([]*sync.RWMutex, 0, len(sorted))
+	for _, filePath := range sorted {
+		lock := fileLock(filePath)
+		lock.Lock()
+		locks = append(locks, lock)
+	}
+
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"os"
+	"path/filepath"
+)
+
+const logDriverFile = "hot-coffee.db"
+
+func init() {
+	registerDriver("log", newLogDriver)
+}
+
+// logDriver keeps all collections in a single append-only file of change
+// records. Compaction rewrites the file as one snapshot record: an envelope
+// holding the schema version and the full state as one change per
+// collection.
+type logDriver struct {
+	filePath string
+	changes  *lineLog
+}
+
+func newLogDriver(dir string) (driver, error) {
+	return &logDriver{filePath: filepath.Join(dir, logDriverFile)}, nil
+}
+
+func (d *logDriver) load(tables []table) (loaded, error) {
+	// A temp file is only left by a compaction that crashed before its
+	// rename, so the log itself is still complete.
+	if err := os.Remove(d.filePath + tmpSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return loaded{}, fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	changes, err := openLineLog(d.filePath)
+	if err != nil {
+		return loaded{}, err
+	}
+	d.changes = changes
+
+	ds := newDataset(tables)
+	version := 0
+	err = d.changes.replay(func(line []byte, end int64) error {
+		var snapshot envelope
+		if err := json.Unmarshal(line, &snapshot); err == nil && snapshot.SchemaVersion > 0 {
+			var full map[string]change
+			if err := json.Unmarshal(snapshot.Data, &full); err != nil {
+				return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+			}
+			ds = newDataset(tables)
+			ds.apply(full)
+			version = snapshot.SchemaVersion
+			return nil
+		}
+
+		var changes map[string]change
+		if err := json.Unmarshal(line, &changes); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		ds.apply(changes)
+		return nil
+	})
+	if err != nil {
+		return loaded{}, err
+	}
+
+	// Records without a snapshot envelope were written before the schema
+	// was versioned.
+	switch {
+	case version == 0 && d.changes.count > 0:
+		version = legacySchemaVersion
+	case version == 0:
+		version = SchemaVersion
+	}
+	return loaded{data: ds, version: version}, nil
+}
+
+func (d *logDriver) append(changes map[string]change) error {
+	return d.changes.append(changes)
+}
+
+// pending counts every record but the snapshot a compaction leaves behind.
+func (d *logDriver) pending() int {
+	return max(d.changes.count-1, 0)
+}
+
+func (d *logDriver) compact(tables []table) error {
+	snapshot := make(map[string]change, len(tables))
+	for _, t := range tables {
+		snapshot[t.name()] = t.full()
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+	}
+	return d.changes.rewrite(envelope{SchemaVersion: SchemaVersion, Data: data})
+}
+
+func (d *logDriver) files(tables []table) []string {
+	return []string{d.filePath}
+}
+
+// journalPath is kept apart from the json driver's journal: each journal is
+// only consistent with the store that committed its sequence.
+func (d *logDriver) journalPath() string {
+	return d.filePath + ".events.jsonl"
+}
+
+func (d *logDriver) close() error {
+	if d.changes == nil {
+		return nil
+	}
+	return d.changes.close()
+}
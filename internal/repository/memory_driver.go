@@ -0,0 +1,41 @@
+package repository
+
+func init() {
+	registerDriver("memory", newMemoryDriver)
+}
+
+// memoryDriver persists nothing: every start is an empty store. It is meant
+// for tests and demos.
+type memoryDriver struct{}
+
+func newMemoryDriver(dir string) (driver, error) {
+	return memoryDriver{}, nil
+}
+
+func (memoryDriver) load(tables []table) (loaded, error) {
+	return loaded{data: newDataset(tables), version: SchemaVersion}, nil
+}
+
+func (memoryDriver) append(changes map[string]change) error {
+	return nil
+}
+
+func (memoryDriver) pending() int {
+	return 0
+}
+
+func (memoryDriver) compact(tables []table) error {
+	return nil
+}
+
+func (memoryDriver) files(tables []table) []string {
+	return nil
+}
+
+func (memoryDriver) journalPath() string {
+	return ""
+}
+
+func (memoryDriver) close() error {
+	return nil
+}
@@ -1,49 +1,34 @@
 package repository
 
 import (
-	"encoding/json"
-	"fmt"
 	"hot-coffee/internal/models"
-	"log/slog"
 )
 
 type MenuRepoImpl struct {
-	filePath string
+	store *Store
 }
 
-func NewMenuRepoImpl(filepath string) *MenuRepoImpl {
+func NewMenuRepoImpl(store *Store) *MenuRepoImpl {
 	return &MenuRepoImpl{
-		filePath: filepath,
+		store: store,
 	}
 }
 
 func (r *MenuRepoImpl) GetMenusRepo() (map[string]models.MenuItem, error) {
-	data, err := readJSON(r.filePath)
-	if err != nil {
-		slog.Error("Menu repository: GetMenusRepo method")
-		return nil, err
-	}
-
-	var menus []models.MenuItem
-
-	if err := json.Unmarshal(data, &menus); err != nil {
-		slog.Error("Menu repository in GetMenusRepo method: decoding JSON")
-		return nil, fmt.Errorf("error unmarshaling JSON: %w", err)
-	}
-
-	menuMap := make(map[string]models.MenuItem)
-	for _, menu := range menus {
-		menuMap[menu.ID] = menu
-	}
-
-	return menuMap, nil
+	return all(r.store, r.store.menus), nil
 }
 
+// UpdateMenusRepo replaces the menu in a transaction of its own. It must not
+// be called while the caller holds another transaction.
 func (r *MenuRepoImpl) UpdateMenusRepo(menuMap map[string]models.MenuItem) error {
-	var menus []models.MenuItem
-	for _, menu := range menuMap {
-		menus = append(menus, menu)
+	tx, err := r.store.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return saveJSONToFile(r.filePath, menus)
+	if err := tx.UpdateMenusRepo(menuMap); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
@@ -1,49 +1,58 @@
 package repository
 
 import (
-	"encoding/json"
-	"fmt"
 	"hot-coffee/internal/models"
-	"log/slog"
+	"time"
 )
 
 type OrderRepoImpl struct {
-	filePath string
+	store *Store
 }
 
-func NewOrderRepoImpl(filepath string) *OrderRepoImpl {
+func NewOrderRepoImpl(store *Store) *OrderRepoImpl {
 	return &OrderRepoImpl{
-		filePath: filepath,
+		store: store,
 	}
 }
 
 func (r *OrderRepoImpl) GetOrdersRepo() (map[string]models.Order, error) {
-	data, err := readJSON(r.filePath)
-	if err != nil {
-		slog.Error("Order repository: GetOrdersRepo method")
-		return nil, err
-	}
+	return all(r.store, r.store.orders), nil
+}
 
-	var orders []models.Order
+// GetOrderRepo returns the order id, if there is one.
+func (r *OrderRepoImpl) GetOrderRepo(id string) (models.Order, bool, error) {
+	order, exists := one(r.store, r.store.orders, id)
+	return order, exists, nil
+}
 
-	if err := json.Unmarshal(data, &orders); err != nil {
-		slog.Error("Order repository in GetOrdersRepo method: decoding JSON")
-		return nil, fmt.Errorf("error unmarshaling JSON: %w", err)
+// UpdateOrdersRepo replaces the orders in a transaction of its own. It must
+// not be called while the caller holds another transaction.
+func (r *OrderRepoImpl) UpdateOrdersRepo(ordersMap map[string]models.Order) error {
+	tx, err := r.store.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	ordersMap := make(map[string]models.Order)
-	for _, order := range orders {
-		ordersMap[order.ID] = order
+	if err := tx.UpdateOrdersRepo(ordersMap); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	return ordersMap, nil
+func (r *OrderRepoImpl) GetOrdersByStatusRepo(status string) ([]models.Order, error) {
+	return r.store.ordersBy(r.store.ordersByStatus, status), nil
 }
 
-func (r *OrderRepoImpl) UpdateOrdersRepo(ordersMap map[string]models.Order) error {
-	var orders []models.Order
-	for _, order := range ordersMap {
-		orders = append(orders, order)
-	}
+// GetOrdersByCustomerRepo returns the orders of the customer with the given
+// name, ignoring case, or ID.
+func (r *OrderRepoImpl) GetOrdersByCustomerRepo(customer string) ([]models.Order, error) {
+	return r.store.ordersBy(r.store.ordersByCustomer, customer, customerKey(customer)), nil
+}
 
-	return saveJSONToFile(r.filePath, orders)
+// GetOrdersByDateRepo returns the orders created on the days, in UTC, from
+// from to to, either of which may be zero for no bound. The first and last
+// day may hold orders outside the bounds.
+func (r *OrderRepoImpl) GetOrdersByDateRepo(from, to time.Time) ([]models.Order, error) {
+	return r.store.ordersCreated(from, to), nil
 }
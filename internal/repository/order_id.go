@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hot-coffee/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	orderSequence      = "order"
+	dailyOrderSequence = "order_daily"
+)
+
+// isValidID reports whether id is an order ID of the active strategy.
+func (s *Store) isValidID(id string) bool {
+	return models.ValidOrderID(s.orderIDs, id)
+}
+
+// NextOrderIDRepo returns the ID for a new order under the active strategy.
+// The sequences behind it are committed with the transaction, so a number is
+// never handed out twice, not even after the order that had it is deleted.
+func (tx *Tx) NextOrderIDRepo() (string, error) {
+	switch tx.store.orderIDs {
+	case models.OrderIDULID:
+		return newULID(time.Now())
+	case models.OrderIDDaily:
+		day := time.Now()
+		n, err := tx.nextSequence(dailyOrderSequence, day.Format(time.DateOnly))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s-%03d", day.Format("20060102"), n), nil
+	default:
+		n, err := tx.nextSequence(orderSequence, "")
+		if err != nil {
+			return "", err
+		}
+		return "order" + strconv.FormatInt(n, 10), nil
+	}
+}
+
+// IsValidOrderIDRepo reports whether id is an order ID of the active strategy.
+func (tx *Tx) IsValidOrderIDRepo(id string) bool {
+	return tx.store.isValidID(id)
+}
+
+// nextSequence increments the named sequence and stages it. A sequence that
+// belongs to another period starts again from 1. A sequence that does not
+// exist yet continues from the highest number among the existing orders, so
+// data from before the sequence keeps its numbers.
+func (tx *Tx) nextSequence(name, period string) (int64, error) {
+	seq, exists, err := txGetOne(tx, tx.store.sequences, name)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		orders, err := txGet(tx, tx.store.orders)
+		if err != nil {
+			return 0, err
+		}
+		seq = models.Sequence{Name: name, Period: period, Value: highestOrderNumber(tx.store.orderIDs, orders, period)}
+	}
+	if seq.Period != period {
+		seq = models.Sequence{Name: name, Period: period}
+	}
+	seq.Value++
+
+	if err := txPut(tx, tx.store.sequences, name, seq); err != nil {
+		return 0, err
+	}
+	return seq.Value, nil
+}
+
+// highestOrderNumber is the highest number used by an order ID of the
+// strategy; for daily tickets only those of the given day count.
+func highestOrderNumber(strategy string, orders map[string]models.Order, day string) int64 {
+	var prefix string
+	switch strategy {
+	case models.OrderIDDaily:
+		prefix = strings.ReplaceAll(day, "-", "") + "-"
+	default:
+		prefix = "order"
+	}
+
+	var highest int64
+	for id := range orders {
+		if !models.ValidOrderID(strategy, id) || !strings.HasPrefix(id, prefix) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimPrefix(id, prefix), 10, 64)
+		if err == nil && n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: 48 bits of milliseconds since the epoch followed by
+// 80 random bits, as 26 characters of Crockford's base32.
+func newULID(t time.Time) (string, error) {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", fmt.Errorf("generating an order ID: %w", err)
+	}
+
+	// The 128 bits are encoded as 130, with two leading zero bits.
+	out := make([]byte, 26)
+	for i := range out {
+		var v byte
+		for j := 0; j < 5; j++ {
+			bit := 5*i + j - 2
+			v <<= 1
+			if bit >= 0 {
+				v |= (b[bit/8] >> (7 - bit%8)) & 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out), nil
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"hot-coffee/internal/models"
+)
+
+type PromotionRepoImpl struct {
+	store *Store
+}
+
+func NewPromotionRepoImpl(store *Store) *PromotionRepoImpl {
+	return &PromotionRepoImpl{
+		store: store,
+	}
+}
+
+func (r *PromotionRepoImpl) GetPromotionsRepo() (map[string]models.Promotion, error) {
+	return all(r.store, r.store.promotions), nil
+}
@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"sort"
+	"time"
+)
+
+// SchemaVersion is the version of the persisted data this build reads and
+// writes. Data saved by an older build is upgraded by the migrations at
+// startup.
+const SchemaVersion = 5
+
+// legacySchemaVersion is the version of data files saved as bare arrays,
+// before the schema was versioned.
+const legacySchemaVersion = 1
+
+// envelope is how a driver saves a collection, or the whole state, together
+// with the schema version it was written in.
+type envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// dataset is the persisted state before it is decoded: the JSON of every item
+// by key, for each collection. Drivers load into a dataset so that the
+// migrations can upgrade it before the typed collections ever see it.
+type dataset map[string]map[string]json.RawMessage
+
+func newDataset(tables []table) dataset {
+	ds := make(dataset, len(tables))
+	for _, t := range tables {
+		ds[t.name()] = make(map[string]json.RawMessage)
+	}
+	return ds
+}
+
+// apply applies one transaction to the raw state.
+func (ds dataset) apply(changes map[string]change) {
+	for name, ch := range changes {
+		items, exists := ds[name]
+		if !exists {
+			items = make(map[string]json.RawMessage)
+			ds[name] = items
+		}
+		for id, raw := range ch.Put {
+			items[id] = raw
+		}
+		for _, id := range ch.Del {
+			delete(items, id)
+		}
+	}
+}
+
+// rewrite calls fn with every item of the named collection decoded as a JSON
+// object, in key order, and saves the items fn reports as changed. It returns
+// the notes fn made about them.
+func (ds dataset) rewrite(name string, fn func(id string, item map[string]any) (note string, err error)) ([]string, error) {
+	items := ds[name]
+	ids := mapKeys(items)
+	sort.Strings(ids)
+
+	var notes []string
+	for _, id := range ids {
+		var item map[string]any
+		if err := json.Unmarshal(items[id], &item); err != nil {
+			return nil, fmt.Errorf("%w: %s/%s: %s", customErrors.ErrJsonUnmarshal, name, id, err)
+		}
+
+		note, err := fn(id, item)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", name, id, err)
+		}
+		if note == "" {
+			continue
+		}
+
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+		}
+		items[id] = raw
+		notes = append(notes, name+"/"+id+": "+note)
+	}
+	return notes, nil
+}
+
+// migration upgrades a dataset from the previous version to version.
+type migration struct {
+	version     int
+	description string
+	up          func(ds dataset) (notes []string, err error)
+}
+
+// migrations must stay sorted by version, one per version from
+// legacySchemaVersion+1 up to SchemaVersion.
+var migrations = []migration{
+	{
+		version:     2,
+		description: "store the order created_at as an RFC 3339 timestamp",
+		up:          migrateOrderCreatedAt,
+	},
+	{
+		version:     3,
+		description: "rename the open order status to pending and start the status history",
+		up:          migrateOrderStatus,
+	},
+	{
+		version:     4,
+		description: "record the name, unit price and line total on order lines, from the current menu",
+		up:          migrateOrderItemPrices,
+	},
+	{
+		version:     5,
+		description: "record the ingredients order lines took, from the current menu",
+		up:          migrateOrderItemIngredients,
+	},
+}
+
+// MigrationStep is a migration that was, or would be, applied to the data.
+type MigrationStep struct {
+	Version     int
+	Description string
+	// Changes lists every item the migration changed, one line each.
+	Changes []string
+}
+
+// migrate upgrades ds from version to SchemaVersion in place.
+func migrate(ds dataset, version int) ([]MigrationStep, error) {
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("%w: the data is at version %d, this build supports up to %d", customErrors.ErrSchemaVersion, version, SchemaVersion)
+	}
+
+	var steps []MigrationStep
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		notes, err := m.up(ds)
+		if err != nil {
+			return nil, fmt.Errorf("%w: migrating to version %d: %s", customErrors.ErrSchemaVersion, m.version, err)
+		}
+		steps = append(steps, MigrationStep{Version: m.version, Description: m.description, Changes: notes})
+	}
+	return steps, nil
+}
+
+// legacyTimeLayout is how created_at was written up to schema version 1, in
+// the server's local time.
+const legacyTimeLayout = "2006-01-02 15:04:05"
+
+func migrateOrderCreatedAt(ds dataset) ([]string, error) {
+	return ds.rewrite("orders", func(id string, item map[string]any) (string, error) {
+		createdAt, _ := item["created_at"].(string)
+		if _, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			return "", nil
+		}
+
+		var converted time.Time
+		if createdAt != "" {
+			t, err := time.ParseInLocation(legacyTimeLayout, createdAt, time.Local)
+			if err != nil {
+				return "", fmt.Errorf("unrecognized created_at %q", createdAt)
+			}
+			converted = t
+		}
+
+		item["created_at"] = converted.Format(time.RFC3339)
+		return fmt.Sprintf("created_at %q -> %q", createdAt, item["created_at"]), nil
+	})
+}
+
+// migrateOrderStatus moves orders to the lifecycle statuses. Open orders
+// become pending since the time they were created; closed orders keep their
+// status without a history, as when they were closed was never recorded.
+func migrateOrderStatus(ds dataset) ([]string, error) {
+	return ds.rewrite("orders", func(id string, item map[string]any) (string, error) {
+		if _, exists := item["status_history"]; exists {
+			return "", nil
+		}
+
+		status, _ := item["status"].(string)
+		switch status {
+		case "open":
+			item["status"] = models.StatusPending
+			item["status_history"] = []models.StatusChange{}
+			if createdAt, err := time.Parse(time.RFC3339, fmt.Sprint(item["created_at"])); err == nil {
+				item["status_history"] = []models.StatusChange{{Status: models.StatusPending, At: createdAt}}
+			}
+			return fmt.Sprintf("status %q -> %q", status, models.StatusPending), nil
+		case models.StatusClosed:
+			item["status_history"] = []models.StatusChange{}
+			return "status history started empty", nil
+		default:
+			return "", fmt.Errorf("unrecognized status %q", status)
+		}
+	})
+}
+
+// decodeMenu returns the menu items of ds by product ID.
+func decodeMenu(ds dataset) (map[string]models.MenuItem, error) {
+	menu := make(map[string]models.MenuItem)
+	for id, raw := range ds["menu_items"] {
+		var item models.MenuItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, fmt.Errorf("%w: menu_items/%s: %s", customErrors.ErrJsonUnmarshal, id, err)
+		}
+		menu[id] = item
+	}
+	return menu, nil
+}
+
+// migrateOrderItemPrices records prices on order lines saved before orders kept
+// them. The prices the orders were placed at are lost, so the current menu is
+// the best there is; lines for products no longer on the menu are priced at 0.
+func migrateOrderItemPrices(ds dataset) ([]string, error) {
+	menu, err := decodeMenu(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds.rewrite("orders", func(id string, item map[string]any) (string, error) {
+		lines, _ := item["items"].([]any)
+		var priced, missing int
+		for _, line := range lines {
+			fields, ok := line.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("malformed order line %v", line)
+			}
+			if _, exists := fields["unit_price"]; exists {
+				continue
+			}
+
+			productID, _ := fields["product_id"].(string)
+			quantity, _ := fields["quantity"].(float64)
+			menuItem, exists := menu[productID]
+			if !exists {
+				missing++
+			}
+			fields["name"] = menuItem.Name
+			fields["unit_price"] = menuItem.Price
+			fields["line_total"] = models.RoundMoney(menuItem.Price * quantity)
+			priced++
+		}
+
+		if priced == 0 {
+			return "", nil
+		}
+		if missing != 0 {
+			return fmt.Sprintf("priced %d lines, %d of them at 0 as the product is no longer on the menu", priced, missing), nil
+		}
+		return fmt.Sprintf("priced %d lines", priced), nil
+	})
+}
+
+// migrateOrderItemIngredients records the ingredients order lines took, saved
+// before lines kept them. What the recipes were when the lines were placed is
+// lost, so the current menu is the best there is; lines for products no longer
+// on the menu took nothing.
+func migrateOrderItemIngredients(ds dataset) ([]string, error) {
+	menu, err := decodeMenu(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds.rewrite("orders", func(id string, item map[string]any) (string, error) {
+		lines, _ := item["items"].([]any)
+		var recorded, missing int
+		for _, line := range lines {
+			fields, ok := line.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("malformed order line %v", line)
+			}
+			if _, exists := fields["ingredients"]; exists {
+				continue
+			}
+
+			raw, err := json.Marshal(fields)
+			if err != nil {
+				return "", fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+			}
+			var orderItem models.OrderItem
+			if err := json.Unmarshal(raw, &orderItem); err != nil {
+				return "", fmt.Errorf("malformed order line %v", line)
+			}
+
+			menuItem, exists := menu[orderItem.ProductID]
+			if !exists {
+				missing++
+			}
+			ingredients := make(map[string]any)
+			for ingredientID, quantity := range menuItem.UnitIngredients(orderItem) {
+				ingredients[ingredientID] = quantity * float64(orderItem.Quantity)
+			}
+			fields["ingredients"] = ingredients
+			recorded++
+		}
+
+		if recorded == 0 {
+			return "", nil
+		}
+		if missing != 0 {
+			return fmt.Sprintf("recorded the ingredients of %d lines, none for %d of them as the product is no longer on the menu", recorded, missing), nil
+		}
+		return fmt.Sprintf("recorded the ingredients of %d lines", recorded), nil
+	})
+}
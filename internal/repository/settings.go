@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"hot-coffee/internal/models"
+)
+
+type SettingsRepoImpl struct {
+	store *Store
+}
+
+func NewSettingsRepoImpl(store *Store) *SettingsRepoImpl {
+	return &SettingsRepoImpl{
+		store: store,
+	}
+}
+
+// GetTaxSettingsRepo returns the tax settings, which are empty until they are
+// first saved.
+func (r *SettingsRepoImpl) GetTaxSettingsRepo() (models.TaxSettings, error) {
+	if tax, exists := all(r.store, r.store.settings)[models.TaxSettingsName]; exists {
+		return tax, nil
+	}
+	return models.TaxSettings{Name: models.TaxSettingsName, Rates: []models.TaxRate{}}, nil
+}
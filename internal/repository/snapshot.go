@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotDir      = "snapshots"
+	snapshotSuffix   = ".tar.gz"
+	snapshotManifest = "snapshot.json"
+)
+
+type SnapshotRepoImpl struct {
+	store *Store
+}
+
+func NewSnapshotRepoImpl(store *Store) *SnapshotRepoImpl {
+	return &SnapshotRepoImpl{
+		store: store,
+	}
+}
+
+// CreateSnapshotRepo compacts the store and archives its files, together with
+// the event journal, as data/snapshots/<id>.tar.gz. Writers are blocked until
+// the archive is complete, so it holds a single point in time.
+func (r *SnapshotRepoImpl) CreateSnapshotRepo(note string) (models.Snapshot, error) {
+	s := r.store
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	files := s.driver.files(s.tables())
+	if len(files) == 0 {
+		return models.Snapshot{}, fmt.Errorf("%w: the %s driver keeps no files to snapshot", customErrors.ErrNotSupported, s.driverName)
+	}
+	if journalPath := s.driver.journalPath(); journalPath != "" {
+		files = append(files, journalPath)
+	}
+
+	if err := s.compact(); err != nil {
+		return models.Snapshot{}, err
+	}
+
+	dir := filepath.Join(s.dir, snapshotDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return models.Snapshot{}, fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	createdAt := time.Now().UTC()
+	snapshot := models.Snapshot{
+		ID:            newSnapshotID(dir, createdAt),
+		Note:          note,
+		CreatedAt:     createdAt,
+		Storage:       s.driverName,
+		SchemaVersion: SchemaVersion,
+	}
+	var existing []string
+	for _, filePath := range files {
+		if _, err := os.Stat(filePath); err == nil {
+			existing = append(existing, filePath)
+			snapshot.Files = append(snapshot.Files, filepath.Base(filePath))
+		}
+	}
+
+	archive, err := writeSnapshot(snapshot, existing)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	if err := replaceFile(filepath.Join(dir, snapshot.ID+snapshotSuffix), archive); err != nil {
+		return models.Snapshot{}, fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	snapshot.Size = int64(len(archive))
+
+	slog.Info("Store: snapshot created", "snapshotID", snapshot.ID, "size", snapshot.Size)
+	return snapshot, nil
+}
+
+// GetSnapshotsRepo returns the snapshots in the data directory, oldest first.
+func (r *SnapshotRepoImpl) GetSnapshotsRepo() ([]models.Snapshot, error) {
+	dir := filepath.Join(r.store.dir, snapshotDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []models.Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+	}
+
+	snapshots := []models.Snapshot{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), snapshotSuffix) {
+			continue
+		}
+		snapshot, err := readSnapshotManifest(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			slog.Warn("repo warning: skipping unreadable snapshot", "file", entry.Name(), "error", err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// RestoreSnapshotRepo replaces the orders, menu, inventory, promotions,
+// settings, webhooks, customers and sequences with the content of a snapshot
+// in a single commit, recorded in the journal as a StateRestored event.
+// Writers are blocked for the whole restore; readers see the old data until
+// the commit.
+func (r *SnapshotRepoImpl) RestoreSnapshotRepo(id string) (models.Snapshot, error) {
+	s := r.store
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	archivePath := filepath.Join(s.dir, snapshotDir, id+snapshotSuffix)
+	tmpDir, err := os.MkdirTemp(filepath.Join(s.dir, snapshotDir), ".restore-")
+	if errors.Is(err, os.ErrNotExist) {
+		return models.Snapshot{}, fmt.Errorf("%w: snapshot %s", customErrors.ErrNotExistConflict, id)
+	}
+	if err != nil {
+		return models.Snapshot{}, fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot, err := extractSnapshot(archivePath, tmpDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return models.Snapshot{}, fmt.Errorf("%w: snapshot %s", customErrors.ErrNotExistConflict, id)
+	}
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	if info, err := os.Stat(archivePath); err == nil {
+		snapshot.Size = info.Size()
+	}
+
+	// The snapshot is read with the driver that wrote it and migrated like
+	// any other data, so it may come from another driver or an older build.
+	d, err := openDriver(snapshot.Storage, tmpDir)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	l, err := d.load(s.tables())
+	d.close()
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	if _, err := migrate(l.data, l.version); err != nil {
+		return models.Snapshot{}, err
+	}
+
+	staged, err := s.decode(l.data)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	// The journal sequence belongs to the live journal, not the snapshot.
+	sequences := staged[s.sequences.name()].(map[string]models.Sequence)
+	delete(sequences, journalSequence)
+	if current, exists := s.sequences.items[journalSequence]; exists {
+		sequences[journalSequence] = current
+	}
+	// Snapshots of older builds hold the webhook secrets; restored webhooks
+	// without one keep the secret they have.
+	_, undoSecrets, err := s.takeSecrets(staged[s.webhooks.name()].(map[string]models.Webhook))
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	restored, err := newEvent(models.EventStateRestored, models.StateRestored{
+		SnapshotID: snapshot.ID,
+		Orders:     mapValues(staged[s.orders.name()].(map[string]models.Order)),
+		MenuItems:  mapValues(staged[s.menus.name()].(map[string]models.MenuItem)),
+		Inventory:  mapValues(staged[s.invents.name()].(map[string]models.InventoryItem)),
+		Promotions: mapValues(staged[s.promotions.name()].(map[string]models.Promotion)),
+		Settings:   mapValues(staged[s.settings.name()].(map[string]models.TaxSettings)),
+		Webhooks:   mapValues(staged[s.webhooks.name()].(map[string]models.Webhook)),
+		Customers:  mapValues(staged[s.customers.name()].(map[string]models.Customer)),
+	})
+	if err != nil {
+		undoSecrets()
+		return models.Snapshot{}, err
+	}
+
+	if err := s.commit(s.diff(staged), []models.Event{restored}); err != nil {
+		undoSecrets()
+		return models.Snapshot{}, err
+	}
+
+	slog.Info("Store: snapshot restored", "snapshotID", snapshot.ID)
+	return snapshot, nil
+}
+
+// newSnapshotID names a snapshot after the time it was taken, adding a counter
+// when another snapshot was taken in the same second.
+func newSnapshotID(dir string, createdAt time.Time) string {
+	base := "snap-" + createdAt.Format("20060102T150405Z")
+	id := base
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(dir, id+snapshotSuffix)); errors.Is(err, os.ErrNotExist) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// writeSnapshot builds the archive: the manifest first, then the files.
+func writeSnapshot(snapshot models.Snapshot, files []string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+	}
+	if err := writeTarFile(tw, snapshotManifest, manifest, snapshot.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	for _, filePath := range files {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+		}
+		if err := writeTarFile(tw, filepath.Base(filePath), data, snapshot.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	return nil
+}
+
+// readSnapshotManifest reads only the manifest at the start of an archive.
+func readSnapshotManifest(archivePath string) (models.Snapshot, error) {
+	var snapshot models.Snapshot
+	err := readSnapshot(archivePath, func(name string, r io.Reader) (bool, error) {
+		if name != snapshotManifest {
+			return false, fmt.Errorf("%w: the archive does not start with %s", customErrors.ErrJsonRead, snapshotManifest)
+		}
+		if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+			return false, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return models.Snapshot{}, fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+	}
+	snapshot.Size = info.Size()
+	return snapshot, nil
+}
+
+// extractSnapshot writes the files of an archive to dir and returns its
+// manifest.
+func extractSnapshot(archivePath, dir string) (models.Snapshot, error) {
+	var snapshot models.Snapshot
+	err := readSnapshot(archivePath, func(name string, r io.Reader) (bool, error) {
+		if name == snapshotManifest {
+			if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+				return false, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+			}
+			return true, nil
+		}
+		// Archives hold plain file names only; anything else would be
+		// written outside dir.
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return false, fmt.Errorf("%w: unexpected file %q in snapshot", customErrors.ErrInvalidInput, name)
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return false, fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return false, fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	if snapshot.ID == "" {
+		return models.Snapshot{}, fmt.Errorf("%w: the snapshot has no %s", customErrors.ErrJsonRead, snapshotManifest)
+	}
+	return snapshot, nil
+}
+
+// readSnapshot calls fn with every file of an archive in order until fn
+// returns false or an error.
+func readSnapshot(archivePath string, fn func(name string, r io.Reader) (bool, error)) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		next, err := fn(header.Name, tr)
+		if err != nil || !next {
+			return err
+		}
+	}
+}
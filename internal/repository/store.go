@@ -0,0 +1,583 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compactEvery is the number of change records after which the driver
+// rewrites its persisted state from memory.
+const compactEvery = 500
+
+// Store keeps every collection in memory. It is loaded once at startup by a
+// storage driver, which then durably records each committed transaction and
+// is compacted from memory every compactEvery records.
+type Store struct {
+	// writer is held by the running transaction, mu guards the collections
+	// and indexes against readers while a commit applies its changes.
+	writer sync.Mutex
+	mu     sync.RWMutex
+
+	orders     *collection[models.Order]
+	menus      *collection[models.MenuItem]
+	invents    *collection[models.InventoryItem]
+	promotions *collection[models.Promotion]
+	settings   *collection[models.TaxSettings]
+	webhooks   *collection[models.Webhook]
+	customers  *collection[models.Customer]
+	sequences  *collection[models.Sequence]
+
+	ordersByStatus   index
+	ordersByCustomer index
+	ordersByDate     index
+
+	dir        string
+	driverName string
+	// orderIDs is the strategy new order IDs follow.
+	orderIDs string
+	driver   driver
+	journal  *eventJournal
+	// webhookStates keeps the secrets and delivery seqs of the webhooks.
+	webhookStates *webhookStates
+	// duplicates are the items the driver found saved more than once at
+	// startup, until the next compaction rewrites them.
+	duplicates []string
+	// onCommit are told the events of every commit once it is applied.
+	onCommit []func([]models.Event)
+}
+
+// OpenStore loads the store from dir using the named storage driver, and
+// numbers new orders with the orderIDs strategy. Data saved at an older
+// schema version is migrated and saved again before the store is used.
+func OpenStore(driverName, dir, orderIDs string) (*Store, error) {
+	if !slices.Contains(models.OrderIDStrategies(), orderIDs) {
+		return nil, fmt.Errorf("%w: unknown order ID strategy %q", customErrors.ErrInvalidInput, orderIDs)
+	}
+
+	s, l, err := loadStore(driverName, dir)
+	if err != nil {
+		return nil, err
+	}
+	s.orderIDs = orderIDs
+	ds := l.data
+	s.duplicates = l.duplicates
+
+	steps, err := migrate(ds, l.version)
+	if err != nil {
+		s.driver.close()
+		return nil, err
+	}
+	for _, step := range steps {
+		slog.Info("Store: migrating data", "version", step.Version, "migration", step.Description, "changed", len(step.Changes))
+	}
+	if len(steps) > 0 {
+		if err := s.archiveJournal(ds, l.version); err != nil {
+			s.driver.close()
+			return nil, err
+		}
+	}
+
+	for _, t := range s.tables() {
+		t.reset()
+		if err := t.apply(change{Put: ds[t.name()]}); err != nil {
+			s.driver.close()
+			return nil, err
+		}
+	}
+
+	if pending := s.driver.pending(); pending > 0 || len(steps) > 0 {
+		slog.Info("Store: saving the loaded data", "driver", driverName, "replayed", pending, "migrations", len(steps))
+		if err := s.compact(); err != nil {
+			s.driver.close()
+			return nil, err
+		}
+	}
+
+	if err := s.openWebhookStates(); err != nil {
+		s.driver.close()
+		return nil, err
+	}
+	if err := s.openJournal(); err != nil {
+		s.webhookStates.close()
+		s.driver.close()
+		return nil, err
+	}
+	if err := s.webhookStates.clamp(s.journal.lastSeq); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// PlanMigrations reports the schema version of the data in dir and the
+// migrations OpenStore would apply to it, without saving anything.
+func PlanMigrations(driverName, dir string) (int, []MigrationStep, error) {
+	s, l, err := loadStore(driverName, dir)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer s.driver.close()
+
+	steps, err := migrate(l.data, l.version)
+	return l.version, steps, err
+}
+
+// loadStore opens the driver and reads the persisted data without decoding
+// it into the collections.
+func loadStore(driverName, dir string) (*Store, loaded, error) {
+	d, err := openDriver(driverName, dir)
+	if err != nil {
+		return nil, loaded{}, err
+	}
+
+	s := &Store{
+		dir:              dir,
+		driverName:       driverName,
+		driver:           d,
+		orders:           newCollection[models.Order]("orders", "orders.json", "order_id"),
+		menus:            newCollection[models.MenuItem]("menu_items", "menu_items.json", "product_id"),
+		invents:          newCollection[models.InventoryItem]("inventory", "inventory.json", "ingredient_id"),
+		promotions:       newCollection[models.Promotion]("promotions", "promotions.json", "code"),
+		settings:         newCollection[models.TaxSettings]("settings", "settings.json", "name"),
+		webhooks:         newCollection[models.Webhook]("webhooks", "webhooks.json", "webhook_id"),
+		customers:        newCollection[models.Customer]("customers", "customers.json", "customer_id"),
+		sequences:        newCollection[models.Sequence]("sequences", "sequences.json", "name"),
+		ordersByStatus:   make(index),
+		ordersByCustomer: make(index),
+		ordersByDate:     make(index),
+	}
+	s.orders.onChange = s.indexOrder
+
+	l, err := s.driver.load(s.tables())
+	if err != nil {
+		s.driver.close()
+		return nil, loaded{}, err
+	}
+	return s, l, nil
+}
+
+// archiveJournal sets the event journal aside before a migration: its events
+// hold data in the old schema, which a rebuild could no longer replay. The
+// journal then starts again from a StateImported event of the migrated data.
+func (s *Store) archiveJournal(ds dataset, version int) error {
+	filePath := s.driver.journalPath()
+	if filePath == "" {
+		return nil
+	}
+
+	archivePath := strings.TrimSuffix(filePath, ".jsonl") + fmt.Sprintf(".v%d.jsonl", version)
+	err := os.Rename(filePath, archivePath)
+	switch {
+	case err == nil:
+		slog.Info("Store: archived the event journal of the old schema", "filePath", archivePath)
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	delete(ds[s.sequences.name()], journalSequence)
+	return nil
+}
+
+// openWebhookStates opens the webhook states kept next to the data of a
+// persistent driver. Secrets that older builds saved with the webhooks are
+// moved into them.
+func (s *Store) openWebhookStates() error {
+	filePath := ""
+	if s.driver.journalPath() != "" {
+		filePath = filepath.Join(s.dir, webhookStateFile)
+	}
+	ws, err := openWebhookStates(filePath)
+	if err != nil {
+		return err
+	}
+	s.webhookStates = ws
+
+	moved, _, err := s.takeSecrets(s.webhooks.items)
+	if err != nil {
+		ws.close()
+		return err
+	}
+	if moved > 0 {
+		slog.Info("Store: moved webhook secrets out of the data", "webhooks", moved)
+		if err := s.compact(); err != nil {
+			ws.close()
+			return err
+		}
+		// The copy of the old file kept by the compaction still holds them.
+		for _, filePath := range s.driver.files([]table{s.webhooks}) {
+			if err := os.Remove(filePath + backupSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				ws.close()
+				return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+			}
+		}
+	}
+
+	err = ws.compact(func(id string) bool {
+		_, exists := s.webhooks.items[id]
+		return exists
+	})
+	if err != nil {
+		ws.close()
+		return err
+	}
+	return nil
+}
+
+// takeSecrets moves the secrets of webhooks into the webhook states, leaving
+// the webhooks without them. It returns how many it moved and a function that
+// puts the states back as they were.
+func (s *Store) takeSecrets(webhooks map[string]models.Webhook) (int, func(), error) {
+	secrets := make(map[string]string)
+	for id, webhook := range webhooks {
+		if webhook.Secret != "" {
+			secrets[id] = webhook.Secret
+		}
+	}
+	if len(secrets) == 0 {
+		return 0, func() {}, nil
+	}
+
+	undo, err := s.webhookStates.setSecrets(secrets, s.sequences.items[journalSequence].Value)
+	if err != nil {
+		return 0, nil, err
+	}
+	for id := range secrets {
+		webhooks[id] = webhooks[id].Redacted()
+	}
+	return len(secrets), undo, nil
+}
+
+// openJournal opens the event journal of a persistent driver; other drivers
+// only number their events. The first time it is opened for existing data, the
+// data is recorded as a StateImported event so that replaying the journal
+// reproduces it.
+func (s *Store) openJournal() error {
+	filePath := s.driver.journalPath()
+	if filePath == "" {
+		s.journal = &eventJournal{}
+		return nil
+	}
+
+	journal, err := openJournal(filePath, s.sequences.items[journalSequence].Value)
+	if err != nil {
+		return err
+	}
+	s.journal = journal
+
+	if journal.lastSeq != 0 || (len(s.orders.items) == 0 && len(s.menus.items) == 0 && len(s.invents.items) == 0 && len(s.promotions.items) == 0 && len(s.settings.items) == 0 && len(s.webhooks.items) == 0 && len(s.customers.items) == 0) {
+		return nil
+	}
+
+	baseline, err := newEvent(models.EventStateImported, models.StateImported{
+		Orders:     mapValues(s.orders.items),
+		MenuItems:  mapValues(s.menus.items),
+		Inventory:  mapValues(s.invents.items),
+		Promotions: mapValues(s.promotions.items),
+		Settings:   mapValues(s.settings.items),
+		Webhooks:   mapValues(s.webhooks.items),
+		Customers:  mapValues(s.customers.items),
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Store: starting event journal from the existing data")
+
+	return s.commit(nil, []models.Event{baseline})
+}
+
+// Close compacts the persisted state if anything was committed since the
+// last compaction, and releases the driver. It waits for a running
+// transaction to finish.
+func (s *Store) Close() error {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	if s.driver.pending() > 0 {
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+	if s.journal != nil && s.journal.log != nil {
+		if err := s.journal.log.close(); err != nil {
+			return err
+		}
+	}
+	if err := s.webhookStates.close(); err != nil {
+		return err
+	}
+	return s.driver.close()
+}
+
+// OnCommit registers fn to be called with the events of every commit once its
+// changes are applied. fn runs while the writer lock is held, so it must not
+// block or start a transaction. Register before the store is shared.
+func (s *Store) OnCommit(fn func([]models.Event)) {
+	s.onCommit = append(s.onCommit, fn)
+}
+
+func (s *Store) tables() []table {
+	return []table{s.orders, s.menus, s.invents, s.promotions, s.settings, s.webhooks, s.customers, s.sequences}
+}
+
+// diff returns the changes that replace the collections named in staged with
+// the maps given for them.
+func (s *Store) diff(staged map[string]any) map[string]change {
+	changes := make(map[string]change)
+	for _, t := range s.tables() {
+		stagedMap, exists := staged[t.name()]
+		if !exists {
+			continue
+		}
+		if ch := t.diff(stagedMap); !ch.empty() {
+			changes[t.name()] = ch
+		}
+	}
+	return changes
+}
+
+// stagedChanges returns the changes of the stagings of a transaction.
+func (s *Store) stagedChanges(staged map[string]any) map[string]change {
+	changes := make(map[string]change)
+	for _, t := range s.tables() {
+		st, exists := staged[t.name()]
+		if !exists {
+			continue
+		}
+		if ch := t.diffStaged(st); !ch.empty() {
+			changes[t.name()] = ch
+		}
+	}
+	return changes
+}
+
+// commit persists the changes and events of a transaction and applies them.
+// The events go to the journal first; the journal sequence they reach is
+// committed together with the state, so events of a transaction that failed
+// half-way are dropped again at the next startup. The caller holds the writer
+// lock.
+func (s *Store) commit(changes map[string]change, events []models.Event) error {
+	if changes == nil {
+		changes = make(map[string]change)
+	}
+
+	undoEvents := func() {}
+	if len(events) > 0 && s.journal != nil {
+		journalSize := s.journal.size()
+		if err := s.journal.append(events); err != nil {
+			return err
+		}
+		undoEvents = func() {
+			if err := s.journal.undo(len(events), journalSize); err != nil {
+				slog.Error("Store: removing events of a failed commit", "error", err)
+			}
+		}
+
+		seq, _ := json.Marshal(models.Sequence{Name: journalSequence, Value: s.journal.lastSeq})
+		ch := changes[s.sequences.name()]
+		if ch.Put == nil {
+			ch.Put = make(map[string]json.RawMessage)
+		}
+		ch.Put[journalSequence] = seq
+		changes[s.sequences.name()] = ch
+	}
+
+	if len(changes) == 0 {
+		s.notify(events)
+		return nil
+	}
+	if err := s.driver.append(changes); err != nil {
+		undoEvents()
+		return err
+	}
+	if s.journal != nil {
+		s.journal.commit()
+	}
+	if err := s.apply(changes); err != nil {
+		return err
+	}
+	s.notify(events)
+
+	if s.driver.pending() >= compactEvery {
+		// The changes are already durable in the log, so a failed
+		// compaction is retried on the next commit or at startup.
+		if err := s.compact(); err != nil {
+			slog.Error("Store: compacting change log", "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) apply(changes map[string]change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return applyChanges(s.tables(), changes)
+}
+
+func (s *Store) notify(events []models.Event) {
+	if len(events) == 0 {
+		return
+	}
+	for _, fn := range s.onCommit {
+		fn(events)
+	}
+}
+
+// compact replaces the persisted state with the current collections. The
+// caller holds the writer lock.
+func (s *Store) compact() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.driver.compact(s.tables()); err != nil {
+		return err
+	}
+	s.duplicates = nil
+	return nil
+}
+
+// indexOrder lists an order under its status, its customer name and, when it
+// is linked to one, its customer ID, and the day it was created on.
+func (s *Store) indexOrder(id string, old, new *models.Order) {
+	if old != nil {
+		s.ordersByStatus.remove(old.Status, id)
+		s.ordersByCustomer.remove(customerKey(old.CustomerName), id)
+		if old.CustomerID != "" {
+			s.ordersByCustomer.remove(old.CustomerID, id)
+		}
+		s.ordersByDate.remove(dateKey(old.CreatedAt), id)
+	}
+	if new != nil {
+		s.ordersByStatus.add(new.Status, id)
+		s.ordersByCustomer.add(customerKey(new.CustomerName), id)
+		if new.CustomerID != "" {
+			s.ordersByCustomer.add(new.CustomerID, id)
+		}
+		s.ordersByDate.add(dateKey(new.CreatedAt), id)
+	}
+}
+
+// ordersBy returns the orders listed under any of keys in ix.
+func (s *Store) ordersBy(ix index, keys ...string) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listOrders(ix, keys)
+}
+
+// ordersCreated returns the orders created on the days from from to to, either
+// of which may be zero for no bound.
+func (s *Store) ordersCreated(from, to time.Time) []models.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var days []string
+	for day := range s.ordersByDate {
+		if (from.IsZero() || day >= dateKey(from)) && (to.IsZero() || day <= dateKey(to)) {
+			days = append(days, day)
+		}
+	}
+	return s.listOrders(s.ordersByDate, days)
+}
+
+// listOrders returns the orders listed under any of keys in ix, once each. The
+// caller holds mu.
+func (s *Store) listOrders(ix index, keys []string) []models.Order {
+	var ids []string
+	for _, key := range keys {
+		ids = append(ids, ix.ids(key)...)
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	orders := make([]models.Order, 0, len(ids))
+	for _, id := range ids {
+		orders = append(orders, s.orders.items[id])
+	}
+	return orders
+}
+
+func customerKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// dateKey is the day an order was created on, as "2006-01-02" in UTC.
+func dateKey(createdAt time.Time) string {
+	return createdAt.UTC().Format(time.DateOnly)
+}
+
+// decode turns a dataset into the typed maps a transaction stages, keyed by
+// collection name.
+func (s *Store) decode(ds dataset) (map[string]any, error) {
+	staged := make(map[string]any)
+	var err error
+	if staged[s.orders.name()], err = decodeItems[models.Order](ds[s.orders.name()]); err != nil {
+		return nil, err
+	}
+	if staged[s.menus.name()], err = decodeItems[models.MenuItem](ds[s.menus.name()]); err != nil {
+		return nil, err
+	}
+	if staged[s.invents.name()], err = decodeItems[models.InventoryItem](ds[s.invents.name()]); err != nil {
+		return nil, err
+	}
+	if staged[s.promotions.name()], err = decodeItems[models.Promotion](ds[s.promotions.name()]); err != nil {
+		return nil, err
+	}
+	if staged[s.settings.name()], err = decodeItems[models.TaxSettings](ds[s.settings.name()]); err != nil {
+		return nil, err
+	}
+	if staged[s.webhooks.name()], err = decodeItems[models.Webhook](ds[s.webhooks.name()]); err != nil {
+		return nil, err
+	}
+	if staged[s.customers.name()], err = decodeItems[models.Customer](ds[s.customers.name()]); err != nil {
+		return nil, err
+	}
+	if staged[s.sequences.name()], err = decodeItems[models.Sequence](ds[s.sequences.name()]); err != nil {
+		return nil, err
+	}
+	return staged, nil
+}
+
+func decodeItems[T any](items map[string]json.RawMessage) (map[string]T, error) {
+	decoded := make(map[string]T, len(items))
+	for id, raw := range items {
+		var item T
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		decoded[id] = item
+	}
+	return decoded, nil
+}
+
+func all[T any](s *Store, c *collection[T]) map[string]T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return c.all()
+}
+
+// one returns the item id of c, if there is one.
+func one[T any](s *Store, c *collection[T], id string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, exists := c.items[id]
+	return item, exists
+}
+
+// OrderIDStrategy is the strategy new order IDs follow.
+func (s *Store) OrderIDStrategy() string {
+	return s.orderIDs
+}
@@ -0,0 +1,483 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+const txJournalFile = "transaction.journal"
+
+// Tx stages collection updates in memory until Commit. It implements the same
+// Get/Update methods as the repositories, so it can be passed wherever a
+// repository is expected. Only one transaction runs at a time, so a
+// read-modify-write inside a Tx never loses a concurrent update.
+type Tx struct {
+	store  *Store
+	staged map[string]any
+	events []models.Event
+	// secrets are the webhook secrets to save, an empty one to delete.
+	secrets map[string]string
+	done    bool
+}
+
+// Begin blocks until no other transaction is running. The caller must end the
+// transaction with Commit or Rollback.
+func (s *Store) Begin() (*Tx, error) {
+	s.writer.Lock()
+	return &Tx{
+		store:   s,
+		staged:  make(map[string]any),
+		secrets: make(map[string]string),
+	}, nil
+}
+
+func (tx *Tx) GetOrdersRepo() (map[string]models.Order, error) {
+	return txGet(tx, tx.store.orders)
+}
+
+func (tx *Tx) UpdateOrdersRepo(ordersMap map[string]models.Order) error {
+	return txUpdate(tx, tx.store.orders, ordersMap)
+}
+
+// GetOrderRepo returns the order id, if there is one.
+func (tx *Tx) GetOrderRepo(id string) (models.Order, bool, error) {
+	return txGetOne(tx, tx.store.orders, id)
+}
+
+// SaveOrderRepo stages order, adding it or replacing the order with its ID.
+func (tx *Tx) SaveOrderRepo(order models.Order) error {
+	return txPut(tx, tx.store.orders, order.ID, order)
+}
+
+func (tx *Tx) DeleteOrderRepo(id string) error {
+	return txDelete(tx, tx.store.orders, id)
+}
+
+func (tx *Tx) GetMenusRepo() (map[string]models.MenuItem, error) {
+	return txGet(tx, tx.store.menus)
+}
+
+func (tx *Tx) UpdateMenusRepo(menuMap map[string]models.MenuItem) error {
+	return txUpdate(tx, tx.store.menus, menuMap)
+}
+
+func (tx *Tx) GetInventsRepo() (map[string]models.InventoryItem, error) {
+	return txGet(tx, tx.store.invents)
+}
+
+func (tx *Tx) UpdateInventsRepo(inventMap map[string]models.InventoryItem) error {
+	return txUpdate(tx, tx.store.invents, inventMap)
+}
+
+func (tx *Tx) GetPromotionsRepo() (map[string]models.Promotion, error) {
+	return txGet(tx, tx.store.promotions)
+}
+
+func (tx *Tx) UpdatePromotionsRepo(promotionMap map[string]models.Promotion) error {
+	return txUpdate(tx, tx.store.promotions, promotionMap)
+}
+
+// GetTaxSettingsRepo returns the tax settings, which are empty until they are
+// first saved.
+func (tx *Tx) GetTaxSettingsRepo() (models.TaxSettings, error) {
+	settings, err := txGet(tx, tx.store.settings)
+	if err != nil {
+		return models.TaxSettings{}, err
+	}
+	if tax, exists := settings[models.TaxSettingsName]; exists {
+		return tax, nil
+	}
+	return models.TaxSettings{Name: models.TaxSettingsName, Rates: []models.TaxRate{}}, nil
+}
+
+func (tx *Tx) UpdateSettingsRepo(settingsMap map[string]models.TaxSettings) error {
+	return txUpdate(tx, tx.store.settings, settingsMap)
+}
+
+func (tx *Tx) UpdateTaxSettingsRepo(tax models.TaxSettings) error {
+	settings, err := txGet(tx, tx.store.settings)
+	if err != nil {
+		return err
+	}
+	settings[models.TaxSettingsName] = tax
+	return txUpdate(tx, tx.store.settings, settings)
+}
+
+func (tx *Tx) GetWebhooksRepo() (map[string]models.Webhook, error) {
+	return txGet(tx, tx.store.webhooks)
+}
+
+func (tx *Tx) UpdateWebhooksRepo(webhookMap map[string]models.Webhook) error {
+	return txUpdate(tx, tx.store.webhooks, webhookMap)
+}
+
+// SetWebhookSecretRepo saves the secret of a webhook when the transaction
+// commits. Secrets are kept apart from the webhooks, out of the journal and
+// snapshots.
+func (tx *Tx) SetWebhookSecretRepo(id, secret string) error {
+	if tx.done {
+		return customErrors.ErrTxDone
+	}
+	if secret == "" {
+		return fmt.Errorf("%w: empty secret for webhook %s", customErrors.ErrInvalidInput, id)
+	}
+	tx.secrets[id] = secret
+	return nil
+}
+
+// DeleteWebhookSecretRepo forgets the secret of a webhook when the
+// transaction commits.
+func (tx *Tx) DeleteWebhookSecretRepo(id string) error {
+	if tx.done {
+		return customErrors.ErrTxDone
+	}
+	tx.secrets[id] = ""
+	return nil
+}
+
+func (tx *Tx) GetCustomersRepo() (map[string]models.Customer, error) {
+	return txGet(tx, tx.store.customers)
+}
+
+func (tx *Tx) UpdateCustomersRepo(customerMap map[string]models.Customer) error {
+	return txUpdate(tx, tx.store.customers, customerMap)
+}
+
+// GetCustomerRepo returns the customer id, if there is one.
+func (tx *Tx) GetCustomerRepo(id string) (models.Customer, bool, error) {
+	return txGetOne(tx, tx.store.customers, id)
+}
+
+// SaveCustomerRepo stages customer, adding it or replacing the customer with
+// its ID.
+func (tx *Tx) SaveCustomerRepo(customer models.Customer) error {
+	return txPut(tx, tx.store.customers, customer.ID, customer)
+}
+
+// RecordEvent adds an event to the journal when the transaction commits.
+// data is the payload struct matching eventType.
+func (tx *Tx) RecordEvent(eventType string, data any) error {
+	if tx.done {
+		return customErrors.ErrTxDone
+	}
+
+	event, err := newEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+	tx.events = append(tx.events, event)
+	return nil
+}
+
+// Commit makes every staged update and event durable and visible at once. On
+// failure nothing is applied.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return customErrors.ErrTxDone
+	}
+	tx.done = true
+	defer tx.store.writer.Unlock()
+
+	// A webhook's first secret starts it from the events recorded so far.
+	undoSecrets, err := tx.store.webhookStates.setSecrets(tx.secrets, tx.store.journal.lastSeq)
+	if err != nil {
+		return err
+	}
+	if err := tx.store.commit(tx.store.stagedChanges(tx.staged), tx.events); err != nil {
+		undoSecrets()
+		return err
+	}
+	return nil
+}
+
+// Rollback discards the staged changes. It is a no-op after Commit, so it is
+// safe to defer right after Begin.
+func (tx *Tx) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.staged = nil
+	tx.events = nil
+	tx.secrets = nil
+	tx.store.writer.Unlock()
+}
+
+func newEvent(eventType string, data any) (models.Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return models.Event{}, fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+	}
+
+	return models.Event{
+		Type: eventType,
+		Time: time.Now(),
+		Data: raw,
+	}, nil
+}
+
+// staging is what a transaction changed in one collection: the items it put
+// and the IDs it deleted. Commit only looks at these, so its cost follows the
+// size of the change rather than that of the collection.
+type staging[T any] struct {
+	put map[string]T
+	del map[string]struct{}
+}
+
+func txStaging[T any](tx *Tx, c *collection[T]) *staging[T] {
+	st, exists := tx.staged[c.name()]
+	if !exists {
+		st = &staging[T]{put: make(map[string]T), del: make(map[string]struct{})}
+		tx.staged[c.name()] = st
+	}
+	return st.(*staging[T])
+}
+
+// txGet returns a copy of the whole collection as the transaction sees it.
+func txGet[T any](tx *Tx, c *collection[T]) (map[string]T, error) {
+	if tx.done {
+		return nil, customErrors.ErrTxDone
+	}
+
+	m := all(tx.store, c)
+	if st, exists := tx.staged[c.name()]; exists {
+		st := st.(*staging[T])
+		for id := range st.del {
+			delete(m, id)
+		}
+		for id, item := range st.put {
+			m[id] = item
+		}
+	}
+	return m, nil
+}
+
+// txGetOne returns the item id as the transaction sees it.
+func txGetOne[T any](tx *Tx, c *collection[T], id string) (T, bool, error) {
+	var zero T
+	if tx.done {
+		return zero, false, customErrors.ErrTxDone
+	}
+
+	if st, exists := tx.staged[c.name()]; exists {
+		st := st.(*staging[T])
+		if item, exists := st.put[id]; exists {
+			return item, true, nil
+		}
+		if _, deleted := st.del[id]; deleted {
+			return zero, false, nil
+		}
+	}
+	item, exists := one(tx.store, c, id)
+	return item, exists, nil
+}
+
+func txPut[T any](tx *Tx, c *collection[T], id string, item T) error {
+	if tx.done {
+		return customErrors.ErrTxDone
+	}
+
+	st := txStaging(tx, c)
+	st.put[id] = item
+	delete(st.del, id)
+	return nil
+}
+
+func txDelete[T any](tx *Tx, c *collection[T], id string) error {
+	if tx.done {
+		return customErrors.ErrTxDone
+	}
+
+	st := txStaging(tx, c)
+	delete(st.put, id)
+	st.del[id] = struct{}{}
+	return nil
+}
+
+// txUpdate stages m as the whole collection. It compares every item with what
+// the transaction sees, so single items are better staged with txPut and
+// txDelete.
+func txUpdate[T any](tx *Tx, c *collection[T], m map[string]T) error {
+	current, err := txGet(tx, c)
+	if err != nil {
+		return err
+	}
+
+	for id, item := range m {
+		if old, exists := current[id]; !exists || !reflect.DeepEqual(old, item) {
+			if err := txPut(tx, c, id, item); err != nil {
+				return err
+			}
+		}
+	}
+	for id := range current {
+		if _, exists := m[id]; !exists {
+			if err := txDelete(tx, c, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type previousFile struct {
+	data   []byte
+	exists bool
+}
+
+// saveJSONFilesAtomic replaces several files as one unit. All new contents are
+// written to fsynced temp files first; then a journal naming the files is
+// written, the temp files are renamed into place and the journal is removed.
+// A crash after the journal is written is rolled forward by RecoverTransaction.
+func saveJSONFilesAtomic(dir string, files map[string]any) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	unlock := lockFiles(mapKeys(files))
+	defer unlock()
+
+	encoded := make(map[string][]byte, len(files))
+	for filePath, data := range files {
+		jsonData, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			slog.Error("repo error: encoding JSON", "error", err, "filePath", filePath)
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+		}
+		encoded[filePath] = jsonData
+	}
+
+	previous := make(map[string]previousFile, len(encoded))
+	var tmpPaths []string
+	cleanup := func() {
+		for _, tmpPath := range tmpPaths {
+			os.Remove(tmpPath)
+		}
+	}
+
+	for filePath, jsonData := range encoded {
+		data, err := os.ReadFile(filePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			cleanup()
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+		}
+		previous[filePath] = previousFile{data: data, exists: err == nil}
+
+		if err := backupFile(filePath); err != nil {
+			cleanup()
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+		}
+
+		tmpPath, err := writeTempFile(filePath, jsonData)
+		if err != nil {
+			cleanup()
+			slog.Error("repo error: writing JSON to temp file", "error", err, "filePath", filePath)
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+		}
+		tmpPaths = append(tmpPaths, tmpPath)
+	}
+
+	journalPath := filepath.Join(dir, txJournalFile)
+	journal, err := json.Marshal(mapKeys(encoded))
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
+	}
+	if err := replaceFile(journalPath, journal); err != nil {
+		cleanup()
+		slog.Error("repo error: writing transaction journal", "error", err)
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	var renamed []string
+	for filePath := range encoded {
+		if err := os.Rename(filePath+tmpSuffix, filePath); err != nil {
+			slog.Error("repo error: committing transaction, rolling back", "error", err, "filePath", filePath)
+			rollbackFiles(renamed, previous)
+			cleanup()
+			os.Remove(journalPath)
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+		}
+		renamed = append(renamed, filePath)
+	}
+
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	if err := os.Remove(journalPath); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	return syncDir(dir)
+}
+
+func rollbackFiles(filePaths []string, previous map[string]previousFile) {
+	for _, filePath := range filePaths {
+		prev := previous[filePath]
+
+		var err error
+		if prev.exists {
+			err = replaceFile(filePath, prev.data)
+		} else {
+			err = os.Remove(filePath)
+		}
+		if err != nil {
+			slog.Error("repo error: restoring file during rollback", "error", err, "filePath", filePath)
+		}
+	}
+}
+
+// RecoverTransaction finishes a transaction that was interrupted after its
+// journal had been written. Every temp file it names is complete, so the
+// renames are simply redone.
+func RecoverTransaction(dir string) error {
+	journalPath := filepath.Join(dir, txJournalFile)
+	if err := os.Remove(journalPath + tmpSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	data, err := os.ReadFile(journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonRead, err)
+	}
+
+	var filePaths []string
+	if err := json.Unmarshal(data, &filePaths); err != nil {
+		slog.Error("repo error: decoding transaction journal", "error", err)
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+	}
+
+	for _, filePath := range filePaths {
+		tmp, err := os.ReadFile(filePath + tmpSuffix)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil || !json.Valid(tmp) {
+			return fmt.Errorf("%w: cannot roll forward %s", customErrors.ErrJsonRead, filePath)
+		}
+		if err := os.Rename(filePath+tmpSuffix, filePath); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+		}
+		slog.Warn("repo recovery: rolled forward interrupted transaction", "filePath", filePath)
+	}
+
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	if err := os.Remove(journalPath); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+
+	return syncDir(dir)
+}
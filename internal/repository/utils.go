@@ -1,16 +1,18 @@
 package repository
 
 import (
-	"encoding/json"
 	"fmt"
 	"hot-coffee/internal/customErrors"
 	"io"
 	"log/slog"
 	"os"
-	"regexp"
 )
 
 func readJSON(filePath string) ([]byte, error) {
+	lock := fileLock(filePath)
+	lock.RLock()
+	defer lock.RUnlock()
+
 	file, err := os.OpenFile(filePath, os.O_RDONLY|os.O_CREATE, 0o644)
 	if err != nil {
 		slog.Error("repo error: opening JSON", "filePath", filePath, "error", err)
@@ -33,31 +35,18 @@ func readJSON(filePath string) ([]byte, error) {
 	return data, nil
 }
 
-func saveJSONToFile(filePath string, data any) error {
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		slog.Error("repo error: encoding JSON", "error", err, "filePath", filePath)
-		return fmt.Errorf("%w: %s", customErrors.ErrJsonMarshal, err)
-	}
-
-	if err := os.WriteFile(filePath, jsonData, 0o644); err != nil {
-		slog.Error("repo error: writing JSON to file", "error", err, "filePath", filePath)
-		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+func mapValues[T any](m map[string]T) []T {
+	values := make([]T, 0, len(m))
+	for _, value := range m {
+		values = append(values, value)
 	}
-	return nil
-}
-
-func isValidID(id string) bool {
-	ValidBucketPath := regexp.MustCompile(`^order[1-9][0-9]*$`)
-	return ValidBucketPath.MatchString(id)
+	return values
 }
 
-func maxID(nums []int) int {
-	maxNum := nums[0]
-	for _, num := range nums[1:] {
-		if num > maxNum {
-			maxNum = num
-		}
+func mapKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-	return maxNum
+	return keys
 }
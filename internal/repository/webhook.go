@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"hot-coffee/internal/models"
+	"strings"
+	"time"
+)
+
+type WebhookRepoImpl struct {
+	store *Store
+}
+
+func NewWebhookRepoImpl(store *Store) *WebhookRepoImpl {
+	return &WebhookRepoImpl{
+		store: store,
+	}
+}
+
+func (r *WebhookRepoImpl) GetWebhooksRepo() (map[string]models.Webhook, error) {
+	return all(r.store, r.store.webhooks), nil
+}
+
+// GetWebhookSecretRepo returns the secret deliveries to a webhook are signed
+// with.
+func (r *WebhookRepoImpl) GetWebhookSecretRepo(id string) (string, bool, error) {
+	state, exists := r.store.webhookStates.get(id)
+	return state.Secret, exists, nil
+}
+
+// GetDeliveredSeqsRepo returns, for every webhook with a secret, the seq of
+// the last journal event turned into deliveries to it.
+func (r *WebhookRepoImpl) GetDeliveredSeqsRepo() (map[string]int64, error) {
+	return r.store.webhookStates.seqs(), nil
+}
+
+// SaveDeliveredSeqRepo records that the journal events up to seq were turned
+// into deliveries to a webhook. It does nothing for a webhook that is gone.
+func (r *WebhookRepoImpl) SaveDeliveredSeqRepo(id string, seq int64) error {
+	return r.store.webhookStates.setSeq(id, seq)
+}
+
+// NewWebhookIDRepo returns the ID for a new webhook.
+func (tx *Tx) NewWebhookIDRepo() (string, error) {
+	id, err := newULID(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return "wh_" + strings.ToLower(id), nil
+}
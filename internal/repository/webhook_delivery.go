@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const deliveryLogFile = "webhook_deliveries.jsonl"
+
+// DeliveryLogImpl records webhook deliveries. Every attempt appends the
+// delivery as it stands to an append-only file, and the latest record of a
+// delivery wins; the file is compacted when it is opened. Stores without a
+// journal keep their deliveries in memory only.
+type DeliveryLogImpl struct {
+	mu         sync.Mutex
+	log        *lineLog
+	deliveries map[string]models.WebhookDelivery
+}
+
+// OpenDeliveryLog loads the webhook deliveries recorded next to the data of
+// store.
+func OpenDeliveryLog(store *Store) (*DeliveryLogImpl, error) {
+	dl := &DeliveryLogImpl{
+		deliveries: make(map[string]models.WebhookDelivery),
+	}
+	if store.driver.journalPath() == "" {
+		return dl, nil
+	}
+
+	log, err := openLineLog(filepath.Join(store.dir, deliveryLogFile))
+	if err != nil {
+		return nil, err
+	}
+	err = log.replay(func(line []byte, end int64) error {
+		var delivery models.WebhookDelivery
+		if err := json.Unmarshal(line, &delivery); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		dl.deliveries[delivery.ID] = delivery
+		return nil
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+	dl.log = log
+
+	if log.count > len(dl.deliveries) {
+		records := make([]any, 0, len(dl.deliveries))
+		for _, delivery := range dl.sorted() {
+			records = append(records, delivery)
+		}
+		if err := log.rewrite(records...); err != nil {
+			log.close()
+			return nil, err
+		}
+		slog.Info("Store: compacted the webhook delivery log", "deliveries", len(records))
+	}
+	return dl, nil
+}
+
+// NewDeliveryIDRepo returns the ID for a new delivery.
+func (l *DeliveryLogImpl) NewDeliveryIDRepo() (string, error) {
+	id, err := newULID(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return "dl_" + strings.ToLower(id), nil
+}
+
+// SaveDeliveryRepo records delivery as it stands, replacing any earlier record
+// of it.
+func (l *DeliveryLogImpl) SaveDeliveryRepo(delivery models.WebhookDelivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.log != nil {
+		if err := l.log.append(delivery); err != nil {
+			return err
+		}
+	}
+	l.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// GetDeliveriesRepo returns every delivery, oldest first.
+func (l *DeliveryLogImpl) GetDeliveriesRepo() ([]models.WebhookDelivery, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sorted(), nil
+}
+
+func (l *DeliveryLogImpl) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.log == nil {
+		return nil
+	}
+	return l.log.close()
+}
+
+func (l *DeliveryLogImpl) sorted() []models.WebhookDelivery {
+	deliveries := make([]models.WebhookDelivery, 0, len(l.deliveries))
+	for _, delivery := range l.deliveries {
+		deliveries = append(deliveries, delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+)
+
+const webhookStateFile = "webhook_state.jsonl"
+
+// webhookState is what the store keeps for a webhook outside its collections,
+// so that it never ends up in the journal or a snapshot: the secret deliveries
+// are signed with, and the seq of the last journal event turned into
+// deliveries to the webhook.
+type webhookState struct {
+	WebhookID string `json:"webhook_id"`
+	Secret    string `json:"secret,omitempty"`
+	Seq       int64  `json:"seq"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// webhookStates records the state of every webhook. Every change appends the
+// state as it stands to a file readable by its owner only, and the latest
+// record of a webhook wins; the file is compacted when it is opened. Stores
+// without a journal file keep the states in memory only.
+type webhookStates struct {
+	mu     sync.Mutex
+	log    *lineLog
+	states map[string]webhookState
+}
+
+func openWebhookStates(filePath string) (*webhookStates, error) {
+	ws := &webhookStates{
+		states: make(map[string]webhookState),
+	}
+	if filePath == "" {
+		return ws, nil
+	}
+
+	log, err := openLineLog(filePath)
+	if err != nil {
+		return nil, err
+	}
+	err = log.replay(func(line []byte, end int64) error {
+		var state webhookState
+		if err := json.Unmarshal(line, &state); err != nil {
+			return fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+		}
+		if state.Deleted {
+			delete(ws.states, state.WebhookID)
+		} else {
+			ws.states[state.WebhookID] = state
+		}
+		return nil
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+	ws.log = log
+	return ws, nil
+}
+
+// compact drops the states of webhooks that are gone and rewrites the file
+// with the rest.
+func (ws *webhookStates) compact(exists func(id string) bool) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for id := range ws.states {
+		if !exists(id) {
+			delete(ws.states, id)
+		}
+	}
+	if ws.log == nil {
+		return nil
+	}
+
+	if ws.log.count > len(ws.states) {
+		ids := mapKeys(ws.states)
+		sort.Strings(ids)
+		records := make([]any, 0, len(ids))
+		for _, id := range ids {
+			records = append(records, ws.states[id])
+		}
+		if err := ws.log.rewrite(records...); err != nil {
+			return err
+		}
+		slog.Info("Store: compacted the webhook state", "webhooks", len(records))
+	}
+	if err := os.Chmod(ws.log.file.Name(), 0o600); err != nil {
+		return fmt.Errorf("%w: %s", customErrors.ErrJsonWrite, err)
+	}
+	return nil
+}
+
+func (ws *webhookStates) get(id string) (webhookState, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	state, exists := ws.states[id]
+	return state, exists
+}
+
+func (ws *webhookStates) seqs() map[string]int64 {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	seqs := make(map[string]int64, len(ws.states))
+	for id, state := range ws.states {
+		seqs[id] = state.Seq
+	}
+	return seqs
+}
+
+// setSecrets saves the secrets of webhooks, an empty one deleting the state of
+// its webhook. A webhook seen for the first time starts from seq, so it is only
+// sent what happens after it. setSecrets returns a function that puts the
+// states back as they were.
+func (ws *webhookStates) setSecrets(secrets map[string]string, seq int64) (func(), error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	previous := make(map[string]webhookState, len(secrets))
+	for id, secret := range secrets {
+		state, exists := ws.states[id]
+		if !exists {
+			state = webhookState{WebhookID: id, Deleted: true}
+		}
+		previous[id] = state
+
+		switch {
+		case secret == "":
+			state = webhookState{WebhookID: id, Deleted: true}
+		case !exists:
+			state = webhookState{WebhookID: id, Secret: secret, Seq: seq}
+		default:
+			state.Secret = secret
+		}
+		if err := ws.put(state); err != nil {
+			ws.putAll(previous)
+			return nil, err
+		}
+	}
+
+	return func() {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		ws.putAll(previous)
+	}, nil
+}
+
+// setSeq moves the seq of a webhook that still has a state.
+func (ws *webhookStates) setSeq(id string, seq int64) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	state, exists := ws.states[id]
+	if !exists || state.Seq == seq {
+		return nil
+	}
+	state.Seq = seq
+	return ws.put(state)
+}
+
+// clamp moves back the seqs past lastSeq, which a journal started over after a
+// migration has not reached yet.
+func (ws *webhookStates) clamp(lastSeq int64) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, state := range ws.states {
+		if state.Seq > lastSeq {
+			state.Seq = lastSeq
+			if err := ws.put(state); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// put records state. The caller holds mu.
+func (ws *webhookStates) put(state webhookState) error {
+	if ws.log != nil {
+		if err := ws.log.append(state); err != nil {
+			return err
+		}
+	}
+	if state.Deleted {
+		delete(ws.states, state.WebhookID)
+	} else {
+		ws.states[state.WebhookID] = state
+	}
+	return nil
+}
+
+// putAll records states, logging those it fails to. The caller holds mu.
+func (ws *webhookStates) putAll(states map[string]webhookState) {
+	for _, state := range states {
+		if err := ws.put(state); err != nil {
+			slog.Error("Store: putting back webhook state", "webhookID", state.WebhookID, "error", err)
+		}
+	}
+}
+
+func (ws *webhookStates) close() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.log == nil {
+		return nil
+	}
+	return ws.log.close()
+}
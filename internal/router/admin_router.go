@@ -0,0 +1,18 @@
+package router
+
+import (
+	"hot-coffee/internal/handler"
+	"net/http"
+)
+
+func AdminRouter(sh *handler.SnapshotHandler, ih *handler.IntegrityHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /admin/snapshots", sh.CreateSnapshot)
+	mux.HandleFunc("GET /admin/snapshots", sh.GetSnapshots)
+	mux.HandleFunc("POST /admin/snapshots/{id}/restore", sh.RestoreSnapshot)
+	mux.HandleFunc("GET /admin/integrity", ih.GetIntegrity)
+	mux.HandleFunc("POST /admin/integrity/fix", ih.FixIntegrity)
+
+	return mux
+}
@@ -0,0 +1,20 @@
+package router
+
+import (
+	"hot-coffee/internal/handler"
+	"net/http"
+)
+
+func CustomerRouter(h *handler.CustomerHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /customers", h.CreateCustomer)
+	mux.HandleFunc("GET /customers", h.GetCustomers)
+	mux.HandleFunc("GET /customers/{id}", h.GetCustomer)
+	mux.HandleFunc("PUT /customers/{id}", h.UpdateCustomer)
+	mux.HandleFunc("DELETE /customers/{id}", h.DeleteCustomer)
+	mux.HandleFunc("GET /customers/{id}/points", h.GetPoints)
+	mux.HandleFunc("POST /customers/{id}/points", h.AdjustPoints)
+
+	return mux
+}
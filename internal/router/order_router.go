@@ -12,8 +12,13 @@ func OrderRouter(h *handler.OrderHandler) *http.ServeMux {
 	mux.HandleFunc("GET /orders", h.GetOrders)
 	mux.HandleFunc("GET /orders/{id}", h.GetOrderId)
 	mux.HandleFunc("PUT /orders/{id}", h.UpdateOrderId)
+	mux.HandleFunc("PATCH /orders/{id}/items", h.UpdateOrderItems)
 	mux.HandleFunc("DELETE /orders/{id}", h.DeleteOrderId)
 	mux.HandleFunc("POST /orders/{id}/close", h.CloseOrderId)
+	mux.HandleFunc("POST /orders/{id}/payments", h.PayOrderId)
+	mux.HandleFunc("POST /orders/{id}/refunds", h.RefundOrderId)
+	mux.HandleFunc("POST /orders/{id}/transition", h.TransitionOrderId)
+	mux.HandleFunc("POST /orders/{id}/cancel", h.CancelOrderId)
 
 	return mux
 }
@@ -0,0 +1,18 @@
+package router
+
+import (
+	"hot-coffee/internal/handler"
+	"net/http"
+)
+
+func PromotionRouter(h *handler.PromotionHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /promotions", h.CreatePromotion)
+	mux.HandleFunc("GET /promotions", h.GetPromotions)
+	mux.HandleFunc("GET /promotions/{code}", h.GetPromotion)
+	mux.HandleFunc("PUT /promotions/{code}", h.UpdatePromotion)
+	mux.HandleFunc("DELETE /promotions/{code}", h.DeletePromotion)
+
+	return mux
+}
@@ -0,0 +1,15 @@
+package router
+
+import (
+	"hot-coffee/internal/handler"
+	"net/http"
+)
+
+func QueueRouter(h *handler.QueueHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /queue", h.GetQueue)
+	mux.HandleFunc("GET /queue/stream", h.StreamQueue)
+
+	return mux
+}
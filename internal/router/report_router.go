@@ -10,6 +10,8 @@ func ReportRouter(h *handler.ReportsHandler) *http.ServeMux {
 
 	mux.HandleFunc("GET /reports/total-sales", h.TotalSalesReportsHandler)
 	mux.HandleFunc("GET /reports/popular-items", h.PopularItemsReportsHandler)
+	mux.HandleFunc("GET /reports/tax-summary", h.TaxSummaryReportsHandler)
+	mux.HandleFunc("GET /reports/refunds", h.RefundsReportsHandler)
 
 	return mux
 }
@@ -1,48 +1,72 @@
 package router
 
 import (
-	"hot-coffee/internal/flags"
 	"hot-coffee/internal/handler"
 	"hot-coffee/internal/repository"
 	"hot-coffee/internal/service"
-	"log/slog"
 	"net/http"
-	"path/filepath"
+	"time"
 )
 
-func SetupRoutes() (*http.ServeMux, error) {
-	absDir, err := filepath.Abs(*flags.DIR)
-	if err != nil {
-		slog.Error("Error getting absolute path:", "error", err)
-		return nil, err
-	}
-	inventoryJSON := filepath.Join(absDir, "inventory.json")
-	menuJSON := filepath.Join(absDir, "menu_items.json")
-	orderJSON := filepath.Join(absDir, "orders.json")
-
-	inventRepo := repository.NewInventRepoImpl(inventoryJSON)
-	inventServ := service.NewInventServImpl(inventRepo)
+// SetupRoutes wires the handlers to the store and returns the routes, wrapped
+// to replay the responses kept in idempotency.
+func SetupRoutes(store *repository.Store, broadcaster *service.Broadcaster, deliveries service.DeliveryLog, idempotency service.IdempotencyRepo, idempotencyTTL time.Duration) http.Handler {
+	inventRepo := repository.NewInventRepoImpl(store)
+	menuRepo := repository.NewMenuRepoImpl(store)
+	orderRepo := repository.NewOrderRepoImpl(store)
+	uow := service.NewUnitOfWork(store.Begin)
+
+	inventServ := service.NewInventServImpl(inventRepo, uow)
 	inventHandler := handler.NewInventHandler(inventServ)
 
-	menuRepo := repository.NewMenuRepoImpl(menuJSON)
-	menuServ := service.NewMenuServImpl(menuRepo, inventRepo)
+	menuServ := service.NewMenuServImpl(menuRepo, uow)
 	menuHandler := handler.NewMenuHandler(menuServ)
 
-	orderRepo := repository.NewOrderRepoImpl(orderJSON)
-	orderServ := service.NewOrderServiceImpl(orderRepo, menuRepo, inventRepo)
-	orderHandler := handler.NewOrderHandler(orderServ)
+	promotionServ := service.NewPromotionServImpl(repository.NewPromotionRepoImpl(store), uow)
+	promotionHandler := handler.NewPromotionHandler(promotionServ)
+
+	settingsServ := service.NewSettingsServImpl(repository.NewSettingsRepoImpl(store), uow)
+	settingsHandler := handler.NewSettingsHandler(settingsServ)
+
+	webhookServ := service.NewWebhookServImpl(repository.NewWebhookRepoImpl(store), deliveries, uow)
+	webhookHandler := handler.NewWebhookHandler(webhookServ)
+
+	customerServ := service.NewCustomerServImpl(repository.NewCustomerRepoImpl(store), uow)
+	customerHandler := handler.NewCustomerHandler(customerServ)
+
+	orderServ := service.NewOrderServiceImpl(orderRepo, menuRepo, uow, broadcaster)
+	store.OnCommit(orderServ.PublishCommitted)
+	orderHandler := handler.NewOrderHandler(orderServ, store.OrderIDStrategy())
+
+	queueServ := service.NewQueueServiceImpl(orderRepo)
+	queueHandler := handler.NewQueueHandler(queueServ, broadcaster)
 
 	serviceReports := service.NewReportsService(orderRepo, menuRepo)
 	handlerReports := handler.NewReportsHandler(serviceReports)
 
+	snapshotServ := service.NewSnapshotServiceImpl(repository.NewSnapshotRepoImpl(store))
+	snapshotHandler := handler.NewSnapshotHandler(snapshotServ)
+
+	integrityServ := service.NewIntegrityServiceImpl(repository.NewIntegrityRepoImpl(store), uow)
+	integrityHandler := handler.NewIntegrityHandler(integrityServ)
+
+	idempotencyServ := service.NewIdempotencyServImpl(idempotency, idempotencyTTL)
+	idempotencyHandler := handler.NewIdempotencyHandler(idempotencyServ)
+
 	mux := http.NewServeMux()
 
 	addRoutes(mux, "/inventory", InventoryRouter(inventHandler))
 	addRoutes(mux, "/menu", MenuRouter(menuHandler))
 	addRoutes(mux, "/orders", OrderRouter(orderHandler))
+	addRoutes(mux, "/queue", QueueRouter(queueHandler))
+	addRoutes(mux, "/promotions", PromotionRouter(promotionHandler))
+	addRoutes(mux, "/settings", SettingsRouter(settingsHandler))
+	addRoutes(mux, "/webhooks", WebhookRouter(webhookHandler))
+	addRoutes(mux, "/customers", CustomerRouter(customerHandler))
 	addRoutes(mux, "/reports", ReportRouter(handlerReports))
+	addRoutes(mux, "/admin", AdminRouter(snapshotHandler, integrityHandler))
 
-	return mux, nil
+	return idempotencyHandler.Wrap(mux)
 }
 
 func addRoutes(mux *http.ServeMux, path string, router http.Handler) {
@@ -0,0 +1,15 @@
+package router
+
+import (
+	"hot-coffee/internal/handler"
+	"net/http"
+)
+
+func SettingsRouter(h *handler.SettingsHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /settings/tax", h.GetTaxSettings)
+	mux.HandleFunc("PUT /settings/tax", h.UpdateTaxSettings)
+
+	return mux
+}
@@ -0,0 +1,19 @@
+package router
+
+import (
+	"hot-coffee/internal/handler"
+	"net/http"
+)
+
+func WebhookRouter(h *handler.WebhookHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /webhooks", h.CreateWebhook)
+	mux.HandleFunc("GET /webhooks", h.GetWebhooks)
+	mux.HandleFunc("GET /webhooks/{id}", h.GetWebhook)
+	mux.HandleFunc("PUT /webhooks/{id}", h.UpdateWebhook)
+	mux.HandleFunc("DELETE /webhooks/{id}", h.DeleteWebhook)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", h.GetDeliveries)
+
+	return mux
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"hot-coffee/internal/models"
+	"log/slog"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber can fall behind by before
+// it starts missing them.
+const subscriberBuffer = 64
+
+// Broadcaster hands the order events published to it to every subscriber,
+// such as the clients of the queue stream. Publishing never waits for a
+// subscriber: one that falls too far behind misses events instead.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan models.OrderEvent]struct{}
+	closed      bool
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[chan models.OrderEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel of the events published from now on, and a
+// function that ends the subscription. The channel is closed when the
+// subscription ends or the broadcaster is closed.
+func (b *Broadcaster) Subscribe() (<-chan models.OrderEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan models.OrderEvent, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, exists := b.subscribers[ch]; exists {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *Broadcaster) Publish(event models.OrderEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Broadcaster: dropped an event for a slow subscriber", "type", event.Type, "orderID", event.OrderID)
+		}
+	}
+}
+
+// Close ends every subscription, so that streams end when the server shuts
+// down.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
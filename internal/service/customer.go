@@ -0,0 +1,399 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+type CustomerRepo interface {
+	GetCustomersRepo() (map[string]models.Customer, error)
+}
+
+type CustomerServImpl struct {
+	customerRepo CustomerRepo
+	uow          UnitOfWork
+}
+
+func NewCustomerServImpl(cR CustomerRepo, uow UnitOfWork) *CustomerServImpl {
+	return &CustomerServImpl{
+		customerRepo: cR,
+		uow:          uow,
+	}
+}
+
+// CreateCustomerServ adds a customer with no points. No two customers share
+// an email address.
+func (s *CustomerServImpl) CreateCustomerServ(customer models.Customer) (models.Customer, error) {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Customer Service in CreateCustomerServ")
+		return models.Customer{}, err
+	}
+	defer tx.Rollback()
+
+	customerMap, err := tx.GetCustomersRepo()
+	if err != nil {
+		slog.Error("Customer Service in CreateCustomerServ")
+		return models.Customer{}, err
+	}
+
+	if customer.ID, err = tx.NewCustomerIDRepo(); err != nil {
+		slog.Error("Customer Service in CreateCustomerServ: generating customer ID")
+		return models.Customer{}, err
+	}
+	if err := checkEmail(customerMap, customer); err != nil {
+		slog.Error("Customer Service in CreateCustomerServ")
+		return models.Customer{}, err
+	}
+	customer.CreatedAt = time.Now()
+
+	customerMap[customer.ID] = customer
+	if err := tx.UpdateCustomersRepo(customerMap); err != nil {
+		slog.Error("Customer Service in CreateCustomerServ")
+		return models.Customer{}, err
+	}
+
+	if err := tx.RecordEvent(models.EventCustomerCreated, models.CustomerCreated{Customer: customer}); err != nil {
+		slog.Error("Customer Service in CreateCustomerServ")
+		return models.Customer{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Customer Service in CreateCustomerServ")
+		return models.Customer{}, err
+	}
+	return customer, nil
+}
+
+// GetCustomersServ returns the customers whose name, email or phone contain
+// search, or all of them, ordered by name, without their ledgers.
+func (s *CustomerServImpl) GetCustomersServ(search string) ([]models.Customer, error) {
+	customerMap, err := s.customerRepo.GetCustomersRepo()
+	if err != nil {
+		slog.Error("Customer Service in GetCustomersServ")
+		return nil, err
+	}
+
+	customers := []models.Customer{}
+	for _, customer := range customerMap {
+		if search == "" || customer.Matches(search) {
+			customers = append(customers, customer.Summary())
+		}
+	}
+	sort.Slice(customers, func(i, j int) bool {
+		if customers[i].Name != customers[j].Name {
+			return customers[i].Name < customers[j].Name
+		}
+		return customers[i].ID < customers[j].ID
+	})
+
+	return customers, nil
+}
+
+// GetCustomerServ returns a customer without its ledger.
+func (s *CustomerServImpl) GetCustomerServ(id string) (models.Customer, error) {
+	customer, err := s.customer(id)
+	if err != nil {
+		slog.Error("Customer Service in GetCustomerServ")
+		return models.Customer{}, err
+	}
+	return customer.Summary(), nil
+}
+
+// UpdateCustomerServ replaces the name, email and phone of a customer. Its
+// points are kept.
+func (s *CustomerServImpl) UpdateCustomerServ(customer models.Customer) (models.Customer, error) {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Customer Service in UpdateCustomerServ")
+		return models.Customer{}, err
+	}
+	defer tx.Rollback()
+
+	customerMap, err := tx.GetCustomersRepo()
+	if err != nil {
+		slog.Error("Customer Service in UpdateCustomerServ")
+		return models.Customer{}, err
+	}
+
+	old, exists := customerMap[customer.ID]
+	if !exists {
+		slog.Error("Customer Service in UpdateCustomerServ: doesn't exist")
+		return models.Customer{}, fmt.Errorf("%w: customer %s", customErrors.ErrNotExistConflict, customer.ID)
+	}
+	if err := checkEmail(customerMap, customer); err != nil {
+		slog.Error("Customer Service in UpdateCustomerServ")
+		return models.Customer{}, err
+	}
+
+	customer.Points, customer.Ledger = old.Points, old.Ledger
+	customer.CreatedAt = old.CreatedAt
+	customerMap[customer.ID] = customer
+	if err := tx.UpdateCustomersRepo(customerMap); err != nil {
+		slog.Error("Customer Service in UpdateCustomerServ")
+		return models.Customer{}, err
+	}
+
+	if err := tx.RecordEvent(models.EventCustomerUpdated, models.CustomerUpdated{Customer: customer.Summary()}); err != nil {
+		slog.Error("Customer Service in UpdateCustomerServ")
+		return models.Customer{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Customer Service in UpdateCustomerServ")
+		return models.Customer{}, err
+	}
+	return customer.Summary(), nil
+}
+
+// DeleteCustomerServ deletes a customer and its points. Its orders keep the
+// customer ID, but earn and give back no points anymore.
+func (s *CustomerServImpl) DeleteCustomerServ(id string) error {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Customer Service in DeleteCustomerServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	customerMap, err := tx.GetCustomersRepo()
+	if err != nil {
+		slog.Error("Customer Service in DeleteCustomerServ")
+		return err
+	}
+
+	if _, exists := customerMap[id]; !exists {
+		slog.Error("Customer Service in DeleteCustomerServ: doesn't exist")
+		return fmt.Errorf("%w: customer %s", customErrors.ErrNotExistConflict, id)
+	}
+
+	delete(customerMap, id)
+	if err := tx.UpdateCustomersRepo(customerMap); err != nil {
+		slog.Error("Customer Service in DeleteCustomerServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventCustomerDeleted, models.CustomerDeleted{CustomerID: id}); err != nil {
+		slog.Error("Customer Service in DeleteCustomerServ")
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPointsServ returns the points balance of a customer and its ledger,
+// newest first.
+func (s *CustomerServImpl) GetPointsServ(id string) (models.PointsLedger, error) {
+	customer, err := s.customer(id)
+	if err != nil {
+		slog.Error("Customer Service in GetPointsServ")
+		return models.PointsLedger{}, err
+	}
+
+	entries := make([]models.PointsEntry, 0, len(customer.Ledger))
+	for i := len(customer.Ledger) - 1; i >= 0; i-- {
+		entries = append(entries, customer.Ledger[i])
+	}
+	return models.PointsLedger{CustomerID: customer.ID, Points: customer.Points, Entries: entries}, nil
+}
+
+// AdjustPointsServ adds points to a customer, or takes them when negative, for
+// reason. The balance cannot go below zero.
+func (s *CustomerServImpl) AdjustPointsServ(id string, points int, reason string) (models.PointsEntry, error) {
+	if points == 0 || reason == "" {
+		slog.Error("Customer Service in AdjustPointsServ")
+		return models.PointsEntry{}, fmt.Errorf("%w: an adjustment takes non-zero points and a reason", customErrors.ErrInvalidInput)
+	}
+
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Customer Service in AdjustPointsServ")
+		return models.PointsEntry{}, err
+	}
+	defer tx.Rollback()
+
+	entry, err := addPoints(tx, id, models.PointsEntry{Type: models.PointsAdjusted, Points: points, Reason: reason})
+	if err != nil {
+		slog.Error("Customer Service in AdjustPointsServ")
+		return models.PointsEntry{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Customer Service in AdjustPointsServ")
+		return models.PointsEntry{}, err
+	}
+	return entry, nil
+}
+
+func (s *CustomerServImpl) customer(id string) (models.Customer, error) {
+	customerMap, err := s.customerRepo.GetCustomersRepo()
+	if err != nil {
+		return models.Customer{}, err
+	}
+
+	customer, exists := customerMap[id]
+	if !exists {
+		return models.Customer{}, fmt.Errorf("%w: customer %s", customErrors.ErrNotExistConflict, id)
+	}
+	return customer, nil
+}
+
+// checkEmail fails when another customer than customer has its email.
+func checkEmail(customerMap map[string]models.Customer, customer models.Customer) error {
+	if customer.Email == "" {
+		return nil
+	}
+	for _, other := range customerMap {
+		if other.ID != customer.ID && other.Email == customer.Email {
+			return fmt.Errorf("%w: customer %s has the email %s", customErrors.ErrExistConflict, other.ID, customer.Email)
+		}
+	}
+	return nil
+}
+
+// CustomerTx is the part of a transaction the loyalty program works on.
+type CustomerTx interface {
+	GetCustomerRepo(id string) (models.Customer, bool, error)
+	SaveCustomerRepo(customer models.Customer) error
+	EventRecorder
+}
+
+// addPoints stages entry in the ledger of the customer customerID in tx and
+// returns it as recorded. Points given to a customer that was deleted are
+// dropped, as there is nobody left to give them to.
+func addPoints(tx CustomerTx, customerID string, entry models.PointsEntry) (models.PointsEntry, error) {
+	customer, exists, err := tx.GetCustomerRepo(customerID)
+	if err != nil {
+		return models.PointsEntry{}, err
+	}
+	if !exists {
+		if entry.Points >= 0 && entry.Type != models.PointsAdjusted {
+			return entry, nil
+		}
+		return models.PointsEntry{}, fmt.Errorf("%w: customer %s", customErrors.ErrNotExistConflict, customerID)
+	}
+
+	if entry, err = customer.AddPoints(entry, time.Now()); err != nil {
+		return models.PointsEntry{}, err
+	}
+	if err := tx.SaveCustomerRepo(customer); err != nil {
+		return models.PointsEntry{}, err
+	}
+
+	return entry, tx.RecordEvent(models.EventCustomerPointsChanged, models.CustomerPointsChanged{CustomerID: customerID, Entry: entry})
+}
+
+// linkCustomer checks that the customer the order is linked to exists, and
+// fills in the customer name of the order from it when left out.
+func linkCustomer(tx CustomerTx, order *models.Order) error {
+	if order.CustomerID == "" {
+		return nil
+	}
+
+	customer, exists, err := tx.GetCustomerRepo(order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: customer %s", customErrors.ErrNotExistConflict, order.CustomerID)
+	}
+	if order.CustomerName == "" {
+		order.CustomerName = customer.Name
+	}
+	return nil
+}
+
+// applyLoyalty takes the points the order redeems from its customer and adds
+// the discount they give to the order. It runs after applyPromotion, as points
+// only pay for what the promotion leaves. previous is the order before the
+// change, or the zero order for a new one: points it redeemed are given back
+// as far as the order redeems fewer now. Points asked for anew must be covered
+// by the order and the customer; points the order already redeemed are only
+// cut down to what the order still covers.
+func applyLoyalty(tx CustomerTx, order *models.Order, previous models.Order) error {
+	if order.RedeemPoints > 0 && order.CustomerID == "" {
+		return fmt.Errorf("%w: points are redeemed by the customer of the order", customErrors.ErrInvalidInput)
+	}
+
+	if redeemable := models.RedeemablePoints(*order); order.RedeemPoints > redeemable {
+		if order.CustomerID != previous.CustomerID || order.RedeemPoints != previous.RedeemPoints {
+			return fmt.Errorf("%w: at most %d points can be redeemed on order %s", customErrors.ErrInvalidInput, redeemable, order.ID)
+		}
+		order.RedeemPoints = redeemable
+	}
+
+	var err error
+	if order.CustomerID == previous.CustomerID {
+		if diff := order.RedeemPoints - previous.RedeemPoints; diff > 0 {
+			_, err = addPoints(tx, order.CustomerID, models.PointsEntry{Type: models.PointsRedeemed, Points: -diff, OrderID: order.ID})
+		} else if diff < 0 {
+			_, err = addPoints(tx, order.CustomerID, models.PointsEntry{Type: models.PointsReturned, Points: -diff, OrderID: order.ID})
+		}
+	} else {
+		if previous.RedeemPoints > 0 {
+			_, err = addPoints(tx, previous.CustomerID, models.PointsEntry{Type: models.PointsReturned, Points: previous.RedeemPoints, OrderID: order.ID})
+		}
+		if err == nil && order.RedeemPoints > 0 {
+			_, err = addPoints(tx, order.CustomerID, models.PointsEntry{Type: models.PointsRedeemed, Points: -order.RedeemPoints, OrderID: order.ID})
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if order.RedeemPoints > 0 {
+		order.Discounts = append(order.Discounts, models.LoyaltyDiscount(*order, order.RedeemPoints))
+	}
+	return nil
+}
+
+// earnPoints gives the customer of a closed order the points its total earns.
+func earnPoints(tx CustomerTx, order models.Order) error {
+	points := models.EarnedPoints(order.Total())
+	if order.CustomerID == "" || points == 0 {
+		return nil
+	}
+	_, err := addPoints(tx, order.CustomerID, models.PointsEntry{Type: models.PointsEarned, Points: points, OrderID: order.ID})
+	return err
+}
+
+// returnPoints gives the customer of a cancelled order back the points it
+// redeemed.
+func returnPoints(tx CustomerTx, order models.Order) error {
+	if order.CustomerID == "" || order.RedeemPoints == 0 {
+		return nil
+	}
+	_, err := addPoints(tx, order.CustomerID, models.PointsEntry{Type: models.PointsReturned, Points: order.RedeemPoints, OrderID: order.ID})
+	return err
+}
+
+// reversePoints takes back from the customer of the order the points the
+// refunded amount earned, no more than the order earned and the customer has
+// left, and records them on refund.
+func reversePoints(tx CustomerTx, order models.Order, refund *models.Refund) error {
+	if order.CustomerID == "" {
+		return nil
+	}
+
+	customer, exists, err := tx.GetCustomerRepo(order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	points := min(models.EarnedPoints(refund.Amount), customer.OrderPoints(order.ID), customer.Points)
+	if points <= 0 {
+		return nil
+	}
+	if _, err := addPoints(tx, order.CustomerID, models.PointsEntry{Type: models.PointsReversed, Points: -points, OrderID: order.ID, Reason: refund.ID}); err != nil {
+		return err
+	}
+	refund.PointsReversed = points
+	return nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type IdempotencyRepo interface {
+	GetIdempotencyRepo(key string) (models.IdempotencyRecord, bool, error)
+	SaveIdempotencyRepo(record models.IdempotencyRecord) error
+}
+
+// IdempotencyServImpl makes requests sent with the same idempotency key run
+// once: the response of the first is stored for ttl and given again to the
+// retries. The key is claimed in the repository before the request runs, so a
+// retry that overtakes the original is turned away instead of running twice,
+// and so is one whose original never got its response stored, for instance
+// because the server stopped in between: it may have been applied.
+type IdempotencyServImpl struct {
+	idempotencyRepo IdempotencyRepo
+	ttl             time.Duration
+
+	mu sync.Mutex
+	// running maps the keys of the requests still running to their
+	// fingerprints.
+	running map[string]string
+}
+
+func NewIdempotencyServImpl(iR IdempotencyRepo, ttl time.Duration) *IdempotencyServImpl {
+	return &IdempotencyServImpl{
+		idempotencyRepo: iR,
+		ttl:             ttl,
+		running:         make(map[string]string),
+	}
+}
+
+// BeginServ claims key for the request with fingerprint. It returns the stored
+// response when the request was already answered; otherwise it returns nil
+// and the request is to run, after which FinishServ must be called.
+func (s *IdempotencyServImpl) BeginServ(key, fingerprint string) (*models.IdempotencyRecord, error) {
+	if len(key) > models.MaxIdempotencyKeyLength {
+		return nil, fmt.Errorf("%w: the idempotency key is longer than %d characters", customErrors.ErrInvalidInput, models.MaxIdempotencyKeyLength)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if running, busy := s.running[key]; busy {
+		if running != fingerprint {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrIdempotencyReused, key)
+		}
+		return nil, fmt.Errorf("%w: %s", customErrors.ErrIdempotencyBusy, key)
+	}
+
+	now := time.Now()
+	record, exists, err := s.idempotencyRepo.GetIdempotencyRepo(key)
+	if err != nil {
+		slog.Error("Idempotency Service in BeginServ")
+		return nil, err
+	}
+	if exists && !record.Expired(now) {
+		if record.Fingerprint != fingerprint {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrIdempotencyReused, key)
+		}
+		if !record.Answered() {
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrIdempotencyUnknown, key)
+		}
+		return &record, nil
+	}
+
+	claim := models.IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	if err := s.idempotencyRepo.SaveIdempotencyRepo(claim); err != nil {
+		slog.Error("Idempotency Service in BeginServ")
+		return nil, err
+	}
+	s.running[key] = fingerprint
+	return nil, nil
+}
+
+// FinishServ stores the response of a request begun with BeginServ in place of
+// the claim on its key. A nil record drops the claim without storing anything,
+// so that a retry runs the request again. When the response cannot be saved
+// the claim stays, and retries are turned away.
+func (s *IdempotencyServImpl) FinishServ(key string, record *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fingerprint := s.running[key]
+	delete(s.running, key)
+
+	now := time.Now()
+	if record == nil {
+		// An expired record stands for no record at all.
+		record = &models.IdempotencyRecord{ExpiresAt: now}
+	} else {
+		record.ExpiresAt = now.Add(s.ttl)
+	}
+	record.Key = key
+	record.Fingerprint = fingerprint
+	record.CreatedAt = now
+	if err := s.idempotencyRepo.SaveIdempotencyRepo(*record); err != nil {
+		slog.Error("Idempotency Service in FinishServ")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+type IntegrityRepo interface {
+	GetDuplicatesRepo() ([]string, error)
+	RewriteRepo() error
+}
+
+type IntegrityServiceImpl struct {
+	integrityRepo IntegrityRepo
+	uow           UnitOfWork
+}
+
+func NewIntegrityServiceImpl(iR IntegrityRepo, uow UnitOfWork) *IntegrityServiceImpl {
+	return &IntegrityServiceImpl{
+		integrityRepo: iR,
+		uow:           uow,
+	}
+}
+
+// CheckIntegrityServ scans the orders, menu and inventory for dangling
+// references, duplicate IDs, negative stock and malformed order IDs. With fix
+// it also repairs what can be repaired, in a single transaction.
+func (s *IntegrityServiceImpl) CheckIntegrityServ(fix bool) (models.IntegrityReport, error) {
+	duplicates, err := s.integrityRepo.GetDuplicatesRepo()
+	if err != nil {
+		slog.Error("Integrity Service in CheckIntegrityServ")
+		return models.IntegrityReport{}, err
+	}
+
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Integrity Service in CheckIntegrityServ")
+		return models.IntegrityReport{}, err
+	}
+	defer tx.Rollback()
+
+	check := &integrityCheck{fix: fix, tx: tx}
+	if check.orders, err = tx.GetOrdersRepo(); err != nil {
+		return models.IntegrityReport{}, err
+	}
+	if check.menus, err = tx.GetMenusRepo(); err != nil {
+		return models.IntegrityReport{}, err
+	}
+	if check.invents, err = tx.GetInventsRepo(); err != nil {
+		return models.IntegrityReport{}, err
+	}
+
+	for _, duplicate := range duplicates {
+		collection, id, _ := strings.Cut(duplicate, "/")
+		check.issues = append(check.issues, models.IntegrityIssue{
+			Kind:       models.IssueDuplicateID,
+			Collection: collection,
+			ID:         id,
+			Detail:     "saved more than once in the data file, the last copy is used",
+			Fix:        "rewrite the data file without the earlier copies",
+		})
+	}
+	steps := []func() error{
+		check.menuIngredients,
+		check.orderProducts,
+		check.negativeStock,
+		check.orderIDs,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			slog.Error("Integrity Service in CheckIntegrityServ")
+			return models.IntegrityReport{}, err
+		}
+	}
+
+	if fix {
+		if err := check.save(tx); err != nil {
+			slog.Error("Integrity Service in CheckIntegrityServ")
+			return models.IntegrityReport{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			slog.Error("Integrity Service in CheckIntegrityServ")
+			return models.IntegrityReport{}, err
+		}
+		if len(duplicates) > 0 {
+			if err := s.integrityRepo.RewriteRepo(); err != nil {
+				slog.Error("Integrity Service in CheckIntegrityServ")
+				return models.IntegrityReport{}, err
+			}
+		}
+	}
+
+	report := models.IntegrityReport{Issues: check.issues}
+	if report.Issues == nil {
+		report.Issues = []models.IntegrityIssue{}
+	}
+	for i := range report.Issues {
+		if fix && report.Issues[i].Fix != "" {
+			report.Issues[i].Fixed = true
+			report.Fixed++
+		}
+	}
+	return report, nil
+}
+
+// integrityCheck holds the data being checked. Each check appends the issues
+// it finds and, in fix mode, repairs the data in place and records the events
+// for it.
+type integrityCheck struct {
+	fix     bool
+	tx      Tx
+	orders  map[string]models.Order
+	menus   map[string]models.MenuItem
+	invents map[string]models.InventoryItem
+	issues  []models.IntegrityIssue
+
+	ordersChanged, menusChanged, inventsChanged bool
+}
+
+// menuIngredients finds menu items using ingredients that are not in the
+// inventory. The fix removes those ingredients from the recipe.
+func (c *integrityCheck) menuIngredients() error {
+	for _, id := range sortedKeys(c.menus) {
+		menu := c.menus[id]
+		var kept []models.MenuItemIngredient
+		for _, ingredient := range menu.Ingredients {
+			if _, exists := c.invents[ingredient.IngredientID]; exists {
+				kept = append(kept, ingredient)
+				continue
+			}
+			c.issues = append(c.issues, models.IntegrityIssue{
+				Kind:       models.IssueDanglingReference,
+				Collection: "menu_items",
+				ID:         id,
+				Detail:     fmt.Sprintf("ingredient %s is not in the inventory", ingredient.IngredientID),
+				Fix:        "remove the ingredient from the recipe",
+			})
+		}
+
+		if !c.fix || len(kept) == len(menu.Ingredients) {
+			continue
+		}
+		if kept == nil {
+			kept = []models.MenuItemIngredient{}
+		}
+		menu.Ingredients = kept
+		c.menus[id] = menu
+		c.menusChanged = true
+		if err := c.tx.RecordEvent(models.EventMenuItemUpdated, models.MenuItemUpdated{MenuItem: menu}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderProducts finds order lines for products that are not on the menu. The
+// fix removes those lines from orders whose items can still be changed; orders
+// the kitchen has started on are kept as they were recorded.
+func (c *integrityCheck) orderProducts() error {
+	for _, id := range sortedKeys(c.orders) {
+		order := c.orders[id]
+		editable := models.OrderEditable(order.Status)
+
+		var kept []models.OrderItem
+		for _, item := range order.Items {
+			if _, exists := c.menus[item.ProductID]; exists {
+				kept = append(kept, item)
+				continue
+			}
+			issue := models.IntegrityIssue{
+				Kind:       models.IssueDanglingReference,
+				Collection: "orders",
+				ID:         id,
+				Detail:     fmt.Sprintf("product %s is not on the menu", item.ProductID),
+			}
+			if editable {
+				issue.Fix = "remove the line from the order"
+			}
+			c.issues = append(c.issues, issue)
+		}
+
+		if !c.fix || !editable || len(kept) == len(order.Items) {
+			continue
+		}
+		if kept == nil {
+			kept = []models.OrderItem{}
+		}
+		order.Items = kept
+		c.orders[id] = order
+		c.ordersChanged = true
+		if err := c.tx.RecordEvent(models.EventOrderUpdated, models.OrderUpdated{Order: order}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// negativeStock finds inventory items below zero. The fix sets them to zero.
+func (c *integrityCheck) negativeStock() error {
+	for _, id := range sortedKeys(c.invents) {
+		invent := c.invents[id]
+		if invent.Quantity >= 0 {
+			continue
+		}
+		c.issues = append(c.issues, models.IntegrityIssue{
+			Kind:       models.IssueNegativeStock,
+			Collection: "inventory",
+			ID:         id,
+			Detail:     fmt.Sprintf("quantity is %g %s", invent.Quantity, invent.Unit),
+			Fix:        "set the quantity to 0",
+		})
+
+		if !c.fix {
+			continue
+		}
+		invent.Quantity = 0
+		c.invents[id] = invent
+		c.inventsChanged = true
+		if err := c.tx.RecordEvent(models.EventInventoryUpdated, models.InventoryItemUpdated{InventoryItem: invent}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderIDs finds orders whose ID does not follow the active order ID
+// strategy, for example after the strategy was changed. The fix gives them new
+// IDs.
+func (c *integrityCheck) orderIDs() error {
+	for _, id := range sortedKeys(c.orders) {
+		if c.tx.IsValidOrderIDRepo(id) {
+			continue
+		}
+		issue := models.IntegrityIssue{
+			Kind:       models.IssueMalformedID,
+			Collection: "orders",
+			ID:         id,
+			Detail:     "the order ID does not follow the order ID strategy",
+			Fix:        "renumber the order",
+		}
+		if !c.fix {
+			c.issues = append(c.issues, issue)
+			continue
+		}
+
+		newID, err := c.tx.NextOrderIDRepo()
+		if err != nil {
+			return err
+		}
+		order := c.orders[id]
+		order.ID = newID
+		issue.Fix = "renumber the order as " + newID
+		c.issues = append(c.issues, issue)
+
+		delete(c.orders, id)
+		c.orders[newID] = order
+		c.ordersChanged = true
+		if err := c.tx.RecordEvent(models.EventOrderDeleted, models.OrderDeleted{OrderID: id}); err != nil {
+			return err
+		}
+		if err := c.tx.RecordEvent(models.EventOrderCreated, models.OrderCreated{Order: order}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save stages the repaired collections in tx.
+func (c *integrityCheck) save(tx Tx) error {
+	if c.ordersChanged {
+		if err := tx.UpdateOrdersRepo(c.orders); err != nil {
+			return err
+		}
+	}
+	if c.menusChanged {
+		if err := tx.UpdateMenusRepo(c.menus); err != nil {
+			return err
+		}
+	}
+	if c.inventsChanged {
+		if err := tx.UpdateInventsRepo(c.invents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -14,14 +14,25 @@ type InventRepo interface {
 
 type InventServImpl struct {
 	inventRepo InventRepo
+	uow        UnitOfWork
 }
 
-func NewInventServImpl(iR InventRepo) *InventServImpl {
-	return &InventServImpl{inventRepo: iR}
+func NewInventServImpl(iR InventRepo, uow UnitOfWork) *InventServImpl {
+	return &InventServImpl{
+		inventRepo: iR,
+		uow:        uow,
+	}
 }
 
 func (s *InventServImpl) CreateInventServ(invent models.InventoryItem) error {
-	inventoryMap, err := s.inventRepo.GetInventsRepo()
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Inventory Service in CreateInventServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	inventoryMap, err := tx.GetInventsRepo()
 	if err != nil {
 		slog.Error("Inventory Service in CreateInventServ")
 		return err
@@ -34,7 +45,17 @@ func (s *InventServImpl) CreateInventServ(invent models.InventoryItem) error {
 
 	inventoryMap[invent.IngredientID] = invent
 
-	return s.inventRepo.UpdateInventsRepo(inventoryMap)
+	if err := tx.UpdateInventsRepo(inventoryMap); err != nil {
+		slog.Error("Inventory Service in CreateInventServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventInventoryCreated, models.InventoryItemCreated{InventoryItem: invent}); err != nil {
+		slog.Error("Inventory Service in CreateInventServ")
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s *InventServImpl) GetInventsServ() ([]models.InventoryItem, error) {
@@ -67,7 +88,14 @@ func (s *InventServImpl) GetInventIdServ(id string) (models.InventoryItem, error
 }
 
 func (s *InventServImpl) UpdateInventIdServ(inventUpd models.InventoryItem) error {
-	invents, err := s.inventRepo.GetInventsRepo()
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Inventory Service in UpdateInventIdServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	invents, err := tx.GetInventsRepo()
 	if err != nil {
 		slog.Error("Inventory Service in UpdateInventIdServ")
 		return err
@@ -79,12 +107,28 @@ func (s *InventServImpl) UpdateInventIdServ(inventUpd models.InventoryItem) erro
 	}
 
 	invents[inventUpd.IngredientID] = inventUpd
+	if err := tx.UpdateInventsRepo(invents); err != nil {
+		slog.Error("Inventory Service in UpdateInventIdServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventInventoryUpdated, models.InventoryItemUpdated{InventoryItem: inventUpd}); err != nil {
+		slog.Error("Inventory Service in UpdateInventIdServ")
+		return err
+	}
 
-	return s.inventRepo.UpdateInventsRepo(invents)
+	return tx.Commit()
 }
 
 func (s *InventServImpl) DeleteInventIdServ(id string) error {
-	invents, err := s.inventRepo.GetInventsRepo()
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Inventory Service in DeleteInventIdServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	invents, err := tx.GetInventsRepo()
 	if err != nil {
 		slog.Error("Inventory Service in DeleteInventIdServ")
 		return err
@@ -96,6 +140,15 @@ func (s *InventServImpl) DeleteInventIdServ(id string) error {
 	}
 
 	delete(invents, id)
+	if err := tx.UpdateInventsRepo(invents); err != nil {
+		slog.Error("Inventory Service in DeleteInventIdServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventInventoryDeleted, models.InventoryItemDeleted{IngredientID: id}); err != nil {
+		slog.Error("Inventory Service in DeleteInventIdServ")
+		return err
+	}
 
-	return s.inventRepo.UpdateInventsRepo(invents)
+	return tx.Commit()
 }
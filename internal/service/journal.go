@@ -0,0 +1,378 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+)
+
+type JournalRepo interface {
+	GetEventsRepo() ([]models.Event, error)
+}
+
+type JournalServiceImpl struct {
+	journalRepo JournalRepo
+	uow         UnitOfWork
+}
+
+func NewJournalServiceImpl(jR JournalRepo, uow UnitOfWork) *JournalServiceImpl {
+	return &JournalServiceImpl{
+		journalRepo: jR,
+		uow:         uow,
+	}
+}
+
+// RebuildService replays the whole journal from an empty state and replaces
+// the orders, menu, inventory, promotions, settings, webhooks and customers
+// with the result. It returns the number of events replayed.
+func (s *JournalServiceImpl) RebuildService() (int, error) {
+	events, err := s.journalRepo.GetEventsRepo()
+	if err != nil {
+		slog.Error("Journal Service in RebuildService")
+		return 0, err
+	}
+
+	state := newReplayState()
+	for _, event := range events {
+		if err := state.apply(event); err != nil {
+			slog.Error("Journal Service in RebuildService: replaying event", "seq", event.Seq, "type", event.Type, "error", err)
+			return 0, err
+		}
+	}
+
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Journal Service in RebuildService")
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.UpdateOrdersRepo(state.orders); err != nil {
+		return 0, err
+	}
+	if err := tx.UpdateMenusRepo(state.menus); err != nil {
+		return 0, err
+	}
+	if err := tx.UpdateInventsRepo(state.invents); err != nil {
+		return 0, err
+	}
+	if err := tx.UpdatePromotionsRepo(state.promotions); err != nil {
+		return 0, err
+	}
+	if err := tx.UpdateSettingsRepo(state.settings); err != nil {
+		return 0, err
+	}
+	if err := tx.UpdateWebhooksRepo(state.webhooks); err != nil {
+		return 0, err
+	}
+	if err := tx.UpdateCustomersRepo(state.customers); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Journal Service in RebuildService")
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// replayState is the state the journal describes, built up one event at a
+// time.
+type replayState struct {
+	orders     map[string]models.Order
+	menus      map[string]models.MenuItem
+	invents    map[string]models.InventoryItem
+	promotions map[string]models.Promotion
+	settings   map[string]models.TaxSettings
+	webhooks   map[string]models.Webhook
+	customers  map[string]models.Customer
+}
+
+func newReplayState() *replayState {
+	return &replayState{
+		orders:     make(map[string]models.Order),
+		menus:      make(map[string]models.MenuItem),
+		invents:    make(map[string]models.InventoryItem),
+		promotions: make(map[string]models.Promotion),
+		settings:   make(map[string]models.TaxSettings),
+		webhooks:   make(map[string]models.Webhook),
+		customers:  make(map[string]models.Customer),
+	}
+}
+
+func (st *replayState) apply(event models.Event) error {
+	switch event.Type {
+	case models.EventStateImported:
+		data, err := decodeEvent[models.StateImported](event)
+		if err != nil {
+			return err
+		}
+		st.reset(data.Orders, data.MenuItems, data.Inventory, data.Promotions, data.Settings, data.Webhooks, data.Customers)
+
+	case models.EventStateRestored:
+		data, err := decodeEvent[models.StateRestored](event)
+		if err != nil {
+			return err
+		}
+		st.reset(data.Orders, data.MenuItems, data.Inventory, data.Promotions, data.Settings, data.Webhooks, data.Customers)
+
+	case models.EventOrderCreated:
+		data, err := decodeEvent[models.OrderCreated](event)
+		if err != nil {
+			return err
+		}
+		st.orders[data.Order.ID] = data.Order
+
+	case models.EventItemsAdded:
+		data, err := decodeEvent[models.ItemsAdded](event)
+		if err != nil {
+			return err
+		}
+		order := st.orders[data.OrderID]
+		order.CustomerName = data.CustomerName
+		order.Items = append(append([]models.OrderItem(nil), data.Items...), order.Items...)
+		st.orders[data.OrderID] = order
+
+	case models.EventOrderUpdated:
+		data, err := decodeEvent[models.OrderUpdated](event)
+		if err != nil {
+			return err
+		}
+		st.orders[data.Order.ID] = data.Order
+
+	case models.EventOrderItemsChanged:
+		data, err := decodeEvent[models.OrderItemsChanged](event)
+		if err != nil {
+			return err
+		}
+		order := st.orders[data.OrderID]
+		order.Items = data.Items
+		order.Discounts, order.Taxes = data.Discounts, data.Taxes
+		order.TaxInclusive, order.ServiceCharge = data.TaxInclusive, data.ServiceCharge
+		order.RedeemPoints = data.RedeemPoints
+		st.orders[data.OrderID] = order
+
+	case models.EventOrderStatusChanged:
+		data, err := decodeEvent[models.OrderStatusChanged](event)
+		if err != nil {
+			return err
+		}
+		order := st.orders[data.OrderID]
+		order.Status = data.To
+		order.CancelReason = data.Reason
+		order.StatusHistory = append(append([]models.StatusChange(nil), order.StatusHistory...), models.StatusChange{Status: data.To, At: data.At})
+		st.orders[data.OrderID] = order
+
+	case models.EventOrderPaid:
+		data, err := decodeEvent[models.OrderPaid](event)
+		if err != nil {
+			return err
+		}
+		order := st.orders[data.OrderID]
+		order.Payments = append(append([]models.Payment(nil), order.Payments...), data.Payments...)
+		st.orders[data.OrderID] = order
+
+	case models.EventOrderRefunded:
+		data, err := decodeEvent[models.OrderRefunded](event)
+		if err != nil {
+			return err
+		}
+		order := st.orders[data.Refund.OrderID]
+		order.Refunds = append(append([]models.Refund(nil), order.Refunds...), data.Refund)
+		st.orders[data.Refund.OrderID] = order
+
+	case models.EventOrderClosed:
+		data, err := decodeEvent[models.OrderClosed](event)
+		if err != nil {
+			return err
+		}
+		order := st.orders[data.OrderID]
+		order.Status = models.StatusClosed
+		st.orders[data.OrderID] = order
+
+	case models.EventOrderDeleted:
+		data, err := decodeEvent[models.OrderDeleted](event)
+		if err != nil {
+			return err
+		}
+		delete(st.orders, data.OrderID)
+
+	case models.EventMenuItemCreated:
+		data, err := decodeEvent[models.MenuItemCreated](event)
+		if err != nil {
+			return err
+		}
+		st.menus[data.MenuItem.ID] = data.MenuItem
+
+	case models.EventMenuItemUpdated:
+		data, err := decodeEvent[models.MenuItemUpdated](event)
+		if err != nil {
+			return err
+		}
+		st.menus[data.MenuItem.ID] = data.MenuItem
+
+	case models.EventMenuItemDeleted:
+		data, err := decodeEvent[models.MenuItemDeleted](event)
+		if err != nil {
+			return err
+		}
+		delete(st.menus, data.ProductID)
+
+	case models.EventInventoryCreated:
+		data, err := decodeEvent[models.InventoryItemCreated](event)
+		if err != nil {
+			return err
+		}
+		st.invents[data.InventoryItem.IngredientID] = data.InventoryItem
+
+	case models.EventInventoryUpdated:
+		data, err := decodeEvent[models.InventoryItemUpdated](event)
+		if err != nil {
+			return err
+		}
+		st.invents[data.InventoryItem.IngredientID] = data.InventoryItem
+
+	case models.EventInventoryAdjusted:
+		data, err := decodeEvent[models.InventoryAdjusted](event)
+		if err != nil {
+			return err
+		}
+		invent := st.invents[data.IngredientID]
+		invent.Quantity += data.Delta
+		st.invents[data.IngredientID] = invent
+
+	case models.EventInventoryDeleted:
+		data, err := decodeEvent[models.InventoryItemDeleted](event)
+		if err != nil {
+			return err
+		}
+		delete(st.invents, data.IngredientID)
+
+	case models.EventPromotionCreated:
+		data, err := decodeEvent[models.PromotionCreated](event)
+		if err != nil {
+			return err
+		}
+		st.promotions[data.Promotion.Code] = data.Promotion
+
+	case models.EventPromotionUpdated:
+		data, err := decodeEvent[models.PromotionUpdated](event)
+		if err != nil {
+			return err
+		}
+		st.promotions[data.Promotion.Code] = data.Promotion
+
+	case models.EventPromotionDeleted:
+		data, err := decodeEvent[models.PromotionDeleted](event)
+		if err != nil {
+			return err
+		}
+		delete(st.promotions, data.Code)
+
+	case models.EventTaxSettingsUpdated:
+		data, err := decodeEvent[models.TaxSettingsUpdated](event)
+		if err != nil {
+			return err
+		}
+		st.settings[data.Settings.Name] = data.Settings
+
+	case models.EventWebhookCreated:
+		data, err := decodeEvent[models.WebhookCreated](event)
+		if err != nil {
+			return err
+		}
+		st.webhooks[data.Webhook.ID] = data.Webhook
+
+	case models.EventWebhookUpdated:
+		data, err := decodeEvent[models.WebhookUpdated](event)
+		if err != nil {
+			return err
+		}
+		st.webhooks[data.Webhook.ID] = data.Webhook
+
+	case models.EventWebhookDeleted:
+		data, err := decodeEvent[models.WebhookDeleted](event)
+		if err != nil {
+			return err
+		}
+		delete(st.webhooks, data.WebhookID)
+
+	case models.EventCustomerCreated:
+		data, err := decodeEvent[models.CustomerCreated](event)
+		if err != nil {
+			return err
+		}
+		st.customers[data.Customer.ID] = data.Customer
+
+	case models.EventCustomerUpdated:
+		data, err := decodeEvent[models.CustomerUpdated](event)
+		if err != nil {
+			return err
+		}
+		customer := data.Customer
+		customer.Points, customer.Ledger = st.customers[customer.ID].Points, st.customers[customer.ID].Ledger
+		st.customers[customer.ID] = customer
+
+	case models.EventCustomerDeleted:
+		data, err := decodeEvent[models.CustomerDeleted](event)
+		if err != nil {
+			return err
+		}
+		delete(st.customers, data.CustomerID)
+
+	case models.EventCustomerPointsChanged:
+		data, err := decodeEvent[models.CustomerPointsChanged](event)
+		if err != nil {
+			return err
+		}
+		customer, exists := st.customers[data.CustomerID]
+		if !exists {
+			return fmt.Errorf("%w: points of unknown customer %s", customErrors.ErrInvalidInput, data.CustomerID)
+		}
+		customer.Points = data.Entry.Balance
+		customer.Ledger = append(customer.Ledger, data.Entry)
+		st.customers[customer.ID] = customer
+
+	default:
+		return fmt.Errorf("%w: unknown event type %q", customErrors.ErrInvalidInput, event.Type)
+	}
+
+	return nil
+}
+
+// reset replaces the whole state.
+func (st *replayState) reset(orders []models.Order, menus []models.MenuItem, invents []models.InventoryItem, promotions []models.Promotion, settings []models.TaxSettings, webhooks []models.Webhook, customers []models.Customer) {
+	*st = *newReplayState()
+	for _, order := range orders {
+		st.orders[order.ID] = order
+	}
+	for _, menu := range menus {
+		st.menus[menu.ID] = menu
+	}
+	for _, invent := range invents {
+		st.invents[invent.IngredientID] = invent
+	}
+	for _, promotion := range promotions {
+		st.promotions[promotion.Code] = promotion
+	}
+	for _, setting := range settings {
+		st.settings[setting.Name] = setting
+	}
+	for _, webhook := range webhooks {
+		st.webhooks[webhook.ID] = webhook
+	}
+	for _, customer := range customers {
+		st.customers[customer.ID] = customer
+	}
+}
+
+func decodeEvent[T any](event models.Event) (T, error) {
+	var data T
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return data, fmt.Errorf("%w: %s", customErrors.ErrJsonUnmarshal, err)
+	}
+	return data, nil
+}
@@ -17,24 +17,31 @@ type InventDal interface {
 }
 
 type MenuServImpl struct {
-	menuRepo  MenuRepo
-	inventDal InventDal
+	menuRepo MenuRepo
+	uow      UnitOfWork
 }
 
-func NewMenuServImpl(mR MenuRepo, iD InventDal) *MenuServImpl {
+func NewMenuServImpl(mR MenuRepo, uow UnitOfWork) *MenuServImpl {
 	return &MenuServImpl{
-		menuRepo:  mR,
-		inventDal: iD,
+		menuRepo: mR,
+		uow:      uow,
 	}
 }
 
 func (s *MenuServImpl) CreateMenuServ(menuNew models.MenuItem) error {
-	if err := s.validateMenuInventory(menuNew.Ingredients); err != nil {
+	tx, err := s.uow.Begin()
+	if err != nil {
 		slog.Error("Menu Service in CreateMenuServ")
 		return err
 	}
+	defer tx.Rollback()
 
-	menuMap, err := s.menuRepo.GetMenusRepo()
+	if err := validateMenuInventory(tx, menuNew); err != nil {
+		slog.Error("Menu Service in CreateMenuServ")
+		return err
+	}
+
+	menuMap, err := tx.GetMenusRepo()
 	if err != nil {
 		slog.Error("Menu Service in CreateMenuServ")
 		return err
@@ -46,7 +53,17 @@ func (s *MenuServImpl) CreateMenuServ(menuNew models.MenuItem) error {
 	}
 
 	menuMap[menuNew.ID] = menuNew
-	return s.menuRepo.UpdateMenusRepo(menuMap)
+	if err := tx.UpdateMenusRepo(menuMap); err != nil {
+		slog.Error("Menu Service in CreateMenuServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventMenuItemCreated, models.MenuItemCreated{MenuItem: menuNew}); err != nil {
+		slog.Error("Menu Service in CreateMenuServ")
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s *MenuServImpl) GetMenusServ() ([]models.MenuItem, error) {
@@ -81,12 +98,19 @@ func (s *MenuServImpl) GetMenuIdServ(id string) (models.MenuItem, error) {
 }
 
 func (s *MenuServImpl) UpdateMenuIdServ(menuNew models.MenuItem) error {
-	if err := s.validateMenuInventory(menuNew.Ingredients); err != nil {
+	tx, err := s.uow.Begin()
+	if err != nil {
 		slog.Error("Menu Service in UpdateMenuIdServ")
 		return err
 	}
+	defer tx.Rollback()
 
-	menuMap, err := s.menuRepo.GetMenusRepo()
+	if err := validateMenuInventory(tx, menuNew); err != nil {
+		slog.Error("Menu Service in UpdateMenuIdServ")
+		return err
+	}
+
+	menuMap, err := tx.GetMenusRepo()
 	if err != nil {
 		slog.Error("Menu Service in UpdateMenuIdServ")
 		return err
@@ -99,12 +123,28 @@ func (s *MenuServImpl) UpdateMenuIdServ(menuNew models.MenuItem) error {
 	}
 
 	menuMap[menuNew.ID] = menuNew
+	if err := tx.UpdateMenusRepo(menuMap); err != nil {
+		slog.Error("Menu Service in UpdateMenuIdServ")
+		return err
+	}
 
-	return s.menuRepo.UpdateMenusRepo(menuMap)
+	if err := tx.RecordEvent(models.EventMenuItemUpdated, models.MenuItemUpdated{MenuItem: menuNew}); err != nil {
+		slog.Error("Menu Service in UpdateMenuIdServ")
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s *MenuServImpl) DeleteMenuIdServ(id string) error {
-	menuMap, err := s.menuRepo.GetMenusRepo()
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Menu Service in DeleteMenuIdServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	menuMap, err := tx.GetMenusRepo()
 	if err != nil {
 		slog.Error("Menu Service in UpdateMenuIdServ")
 		return err
@@ -116,21 +156,32 @@ func (s *MenuServImpl) DeleteMenuIdServ(id string) error {
 	}
 
 	delete(menuMap, id)
+	if err := tx.UpdateMenusRepo(menuMap); err != nil {
+		slog.Error("Menu Service in DeleteMenuIdServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventMenuItemDeleted, models.MenuItemDeleted{ProductID: id}); err != nil {
+		slog.Error("Menu Service in DeleteMenuIdServ")
+		return err
+	}
 
-	return s.menuRepo.UpdateMenusRepo(menuMap)
+	return tx.Commit()
 }
 
-func (s *MenuServImpl) validateMenuInventory(ingredients []models.MenuItemIngredient) error {
-	inventMap, err := s.inventDal.GetInventsRepo()
+// validateMenuInventory checks that the ingredients of the recipe, the variants
+// and the modifier options of menu are in the inventory.
+func validateMenuInventory(inventDal InventDal, menu models.MenuItem) error {
+	inventMap, err := inventDal.GetInventsRepo()
 	if err != nil {
 		slog.Error("Menu Service in validateMenuInventory")
 		return err
 	}
 
-	for _, ingredient := range ingredients {
-		if _, exists := inventMap[ingredient.IngredientID]; !exists {
+	for _, ingredientID := range menu.IngredientIDs() {
+		if _, exists := inventMap[ingredientID]; !exists {
 			slog.Error("Menu Service in validateMenuInventory: doesn't exist")
-			return fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+			return fmt.Errorf("%w: ingredient %s is not in the inventory", customErrors.ErrNotExistConflict, ingredientID)
 		}
 	}
 
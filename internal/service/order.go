@@ -6,11 +6,25 @@ import (
 	"hot-coffee/internal/models"
 	"log/slog"
 	"sort"
+	"time"
 )
 
-type OrderRepo interface {
+// OrderTx is the part of a transaction single orders are read and staged
+// with.
+type OrderTx interface {
+	GetOrderRepo(id string) (models.Order, bool, error)
+	SaveOrderRepo(order models.Order) error
+	DeleteOrderRepo(id string) error
+}
+
+// OrderListRepo is the order repository the order list and the published
+// order events are read from.
+type OrderListRepo interface {
 	GetOrdersRepo() (map[string]models.Order, error)
-	UpdateOrdersRepo(ordersMap map[string]models.Order) error
+	GetOrderRepo(id string) (models.Order, bool, error)
+	GetOrdersByStatusRepo(status string) ([]models.Order, error)
+	GetOrdersByCustomerRepo(customer string) ([]models.Order, error)
+	GetOrdersByDateRepo(from, to time.Time) ([]models.Order, error)
 }
 
 type MenuRepoForOrder interface {
@@ -22,80 +36,165 @@ type InventRepoForOrder interface {
 	UpdateInventsRepo(inventMap map[string]models.InventoryItem) error
 }
 
+// OrderEventPublisher is told about every committed change to an order, in the
+// order the changes were committed.
+type OrderEventPublisher interface {
+	Publish(event models.OrderEvent)
+}
+
 type OrderServiceImpl struct {
-	orderRepo  OrderRepo
-	menuRepo   MenuRepoForOrder
-	inventRepo InventRepoForOrder
+	orderRepo OrderListRepo
+	menuRepo  MenuRepoForOrder
+	uow       UnitOfWork
+	events    OrderEventPublisher
 }
 
-func NewOrderServiceImpl(oR OrderRepo, mR MenuRepoForOrder, iR InventRepoForOrder) *OrderServiceImpl {
+func NewOrderServiceImpl(oR OrderListRepo, mR MenuRepoForOrder, uow UnitOfWork, events OrderEventPublisher) *OrderServiceImpl {
 	return &OrderServiceImpl{
-		orderRepo:  oR,
-		menuRepo:   mR,
-		inventRepo: iR,
+		orderRepo: oR,
+		menuRepo:  mR,
+		uow:       uow,
+		events:    events,
 	}
 }
 
-func (s *OrderServiceImpl) CreateOrderService(newOrder models.Order) (models.TotalPrice, error) {
-	menuMap, err := s.validateOrder(newOrder.Items)
+func (s *OrderServiceImpl) CreateOrderService(newOrder models.Order) (models.OrderTotals, error) {
+	tx, err := s.uow.Begin()
 	if err != nil {
 		slog.Error("Order Service in CreateOrderService")
-		return models.TotalPrice{}, err
+		return models.OrderTotals{}, err
 	}
+	defer tx.Rollback()
 
-	orderMap, err := s.orderRepo.GetOrdersRepo()
+	orderId, err := tx.NextOrderIDRepo()
 	if err != nil {
 		slog.Error("Order Service in CreateOrderService")
-		return models.TotalPrice{}, err
+		return models.OrderTotals{}, err
 	}
-	orderId, err := getNewOrderID(orderMap)
+
+	items, err := s.validateOrder(tx, orderId, nil, newOrder.Items)
 	if err != nil {
 		slog.Error("Order Service in CreateOrderService")
-		return models.TotalPrice{}, err
+		return models.OrderTotals{}, err
 	}
 
 	newOrder.ID = orderId
-	newOrder.Status = "open"
+	newOrder.Items = items
+	newOrder.Status = models.StatusPending
+	newOrder.StatusHistory = []models.StatusChange{{Status: models.StatusPending, At: newOrder.CreatedAt}}
 
-	orderMap[newOrder.ID] = newOrder
-	if err := s.orderRepo.UpdateOrdersRepo(orderMap); err != nil {
+	if err := linkCustomer(tx, &newOrder); err != nil {
 		slog.Error("Order Service in CreateOrderService")
-		return models.TotalPrice{}, err
+		return models.OrderTotals{}, err
+	}
+	if err := applyPromotion(tx, &newOrder, ""); err != nil {
+		slog.Error("Order Service in CreateOrderService")
+		return models.OrderTotals{}, err
+	}
+	if err := applyLoyalty(tx, &newOrder, models.Order{}); err != nil {
+		slog.Error("Order Service in CreateOrderService")
+		return models.OrderTotals{}, err
+	}
+	if err := applyTaxes(tx, &newOrder); err != nil {
+		slog.Error("Order Service in CreateOrderService")
+		return models.OrderTotals{}, err
+	}
+
+	if err := tx.SaveOrderRepo(newOrder); err != nil {
+		slog.Error("Order Service in CreateOrderService")
+		return models.OrderTotals{}, err
+	}
+
+	if err := tx.RecordEvent(models.EventOrderCreated, models.OrderCreated{Order: newOrder}); err != nil {
+		slog.Error("Order Service in CreateOrderService")
+		return models.OrderTotals{}, err
 	}
 
-	totalPrice := models.NewTotalPrice()
-	for _, orderItem := range newOrder.Items {
-		totalPrice.TotalSale += float64(orderItem.Quantity) * menuMap[orderItem.ProductID].Price
+	if err := tx.Commit(); err != nil {
+		slog.Error("Order Service in CreateOrderService")
+		return models.OrderTotals{}, err
 	}
 
-	return *totalPrice, nil
+	return models.NewOrderTotals(newOrder), nil
 }
 
-func (s *OrderServiceImpl) GetOrdersService() ([]models.Order, error) {
-	orderMap, err := s.orderRepo.GetOrdersRepo()
+// GetOrdersService returns the page of the orders selected by query, sorted as
+// it asks, that starts after its cursor, with the cursor of the next page when
+// there are more. Filtering by status goes through the status index.
+func (s *OrderServiceImpl) GetOrdersService(query models.OrderQuery) (models.OrderPage, error) {
+	candidates, err := s.candidateOrders(query)
 	if err != nil {
 		slog.Error("Order Service in GetOrdersService")
-		return nil, err
+		return models.OrderPage{}, err
 	}
+
 	var orders []models.Order
-	for _, item := range orderMap {
-		orders = append(orders, item)
+	for _, order := range candidates {
+		if query.Matches(order) && (query.Cursor == nil || query.Before(*query.Cursor, query.Position(order))) {
+			orders = append(orders, order)
+		}
 	}
 	sort.Slice(orders, func(i, j int) bool {
-		return orders[i].ID < orders[j].ID
+		return query.Before(query.Position(orders[i]), query.Position(orders[j]))
 	})
 
-	return orders, nil
+	page := models.OrderPage{Orders: []models.OrderView{}}
+	if len(orders) > query.Limit {
+		orders = orders[:query.Limit]
+		cursor, err := models.EncodeOrderCursor(query.Position(orders[len(orders)-1]))
+		if err != nil {
+			slog.Error("Order Service in GetOrdersService")
+			return models.OrderPage{}, err
+		}
+		page.NextCursor = cursor
+	}
+	for _, order := range orders {
+		page.Orders = append(page.Orders, models.NewOrderView(order))
+	}
+
+	return page, nil
 }
 
-func (s *OrderServiceImpl) GetOrderByIdService(id string) (models.Order, error) {
+// candidateOrders returns the orders the query can match, read from the
+// narrowest index it allows: the customer, the statuses or the days the orders
+// were created on. The query still has to be matched against each.
+func (s *OrderServiceImpl) candidateOrders(query models.OrderQuery) ([]models.Order, error) {
+	switch {
+	case query.Customer != "":
+		return s.orderRepo.GetOrdersByCustomerRepo(query.Customer)
+
+	case len(query.Statuses) != 0:
+		var candidates []models.Order
+		for _, status := range query.Statuses {
+			orders, err := s.orderRepo.GetOrdersByStatusRepo(status)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, orders...)
+		}
+		return candidates, nil
+
+	case !query.From.IsZero() || !query.To.IsZero():
+		return s.orderRepo.GetOrdersByDateRepo(query.From, query.To)
+	}
+
 	orderMap, err := s.orderRepo.GetOrdersRepo()
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]models.Order, 0, len(orderMap))
+	for _, order := range orderMap {
+		candidates = append(candidates, order)
+	}
+	return candidates, nil
+}
+
+func (s *OrderServiceImpl) GetOrderByIdService(id string) (models.Order, error) {
+	order, exists, err := s.orderRepo.GetOrderRepo(id)
 	if err != nil {
 		slog.Error("Order Service in GetOrderByIdService")
 		return models.Order{}, err
 	}
-
-	order, exists := orderMap[id]
 	if !exists {
 		slog.Error("Order Service in GetOrderByIdService")
 		return models.Order{}, fmt.Errorf("%w", customErrors.ErrNotExistConflict)
@@ -104,122 +203,759 @@ func (s *OrderServiceImpl) GetOrderByIdService(id string) (models.Order, error)
 	return order, nil
 }
 
-func (s *OrderServiceImpl) UpdateOrderByIdService(updateOrder models.Order) (models.TotalPrice, error) {
-	_, err := s.validateOrder(updateOrder.Items)
+// UpdateOrderByIdService replaces the customer, the items, the promo code and
+// the redeemed points of the order, adjusting the inventory by the difference
+// between the old and the new items.
+func (s *OrderServiceImpl) UpdateOrderByIdService(updateOrder models.Order) (models.OrderTotals, error) {
+	tx, err := s.uow.Begin()
 	if err != nil {
 		slog.Error("Order Service in UpdateOrderByIdService")
-		return models.TotalPrice{}, err
+		return models.OrderTotals{}, err
 	}
+	defer tx.Rollback()
 
-	orderMap, err := s.orderRepo.GetOrdersRepo()
+	order, err := editableOrder(tx, updateOrder.ID)
 	if err != nil {
 		slog.Error("Order Service in UpdateOrderByIdService")
-		return models.TotalPrice{}, err
+		return models.OrderTotals{}, err
 	}
 
-	order, exists := orderMap[updateOrder.ID]
-	if !exists {
+	items, err := s.validateOrder(tx, order.ID, order.Items, updateOrder.Items)
+	if err != nil {
 		slog.Error("Order Service in UpdateOrderByIdService")
-		return models.TotalPrice{}, fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+		return models.OrderTotals{}, err
 	}
 
-	if order.Status == "closed" {
+	previous := order
+	order.CustomerName = updateOrder.CustomerName
+	order.CustomerID = updateOrder.CustomerID
+	order.Priority = updateOrder.Priority
+	order.Items = items
+	order.PromoCode = updateOrder.PromoCode
+	order.RedeemPoints = updateOrder.RedeemPoints
+	if err := linkCustomer(tx, &order); err != nil {
+		slog.Error("Order Service in UpdateOrderByIdService")
+		return models.OrderTotals{}, err
+	}
+	if err := applyPromotion(tx, &order, previous.PromoCode); err != nil {
 		slog.Error("Order Service in UpdateOrderByIdService")
-		return models.TotalPrice{}, fmt.Errorf("%w", customErrors.ErrOrderClosed)
+		return models.OrderTotals{}, err
+	}
+	if err := applyLoyalty(tx, &order, previous); err != nil {
+		slog.Error("Order Service in UpdateOrderByIdService")
+		return models.OrderTotals{}, err
+	}
+	if err := applyTaxes(tx, &order); err != nil {
+		slog.Error("Order Service in UpdateOrderByIdService")
+		return models.OrderTotals{}, err
 	}
 
-	updateOrder.Status = order.Status
-	updateOrder.CreatedAt = order.CreatedAt
-	updateOrder.Items = append(updateOrder.Items, order.Items...)
+	if order.Paid() > order.Total() {
+		slog.Error("Order Service in UpdateOrderByIdService")
+		return models.OrderTotals{}, fmt.Errorf("%w: %.2f was paid, more than the new total of %.2f", customErrors.ErrOrderNotEditable, order.Paid(), order.Total())
+	}
+	if err := tx.SaveOrderRepo(order); err != nil {
+		slog.Error("Order Service in UpdateOrderByIdService")
+		return models.OrderTotals{}, err
+	}
 
-	orderMap[updateOrder.ID] = updateOrder
+	if err := tx.RecordEvent(models.EventOrderUpdated, models.OrderUpdated{Order: order}); err != nil {
+		slog.Error("Order Service in UpdateOrderByIdService")
+		return models.OrderTotals{}, err
+	}
 
-	if err := s.orderRepo.UpdateOrdersRepo(orderMap); err != nil {
+	if err := tx.Commit(); err != nil {
 		slog.Error("Order Service in UpdateOrderByIdService")
-		return models.TotalPrice{}, err
+		return models.OrderTotals{}, err
 	}
 
-	menuMap, err := s.menuRepo.GetMenusRepo()
+	return models.NewOrderTotals(order), nil
+}
+
+// UpdateOrderItemsService applies ops to the lines of the order and adjusts the
+// inventory by the difference, all in one transaction.
+func (s *OrderServiceImpl) UpdateOrderItemsService(id string, ops []models.OrderItemOperation) (models.Order, error) {
+	tx, err := s.uow.Begin()
 	if err != nil {
-		slog.Error("Order Service in UpdateOrderByIdService")
-		return models.TotalPrice{}, err
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
 	}
+	defer tx.Rollback()
 
-	totalPrice := models.NewTotalPrice()
-	for _, orderItem := range updateOrder.Items {
-		totalPrice.TotalSale += float64(orderItem.Quantity) * menuMap[orderItem.ProductID].Price
+	order, err := editableOrder(tx, id)
+	if err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+
+	items, err := models.ApplyItemOperations(order.Items, ops)
+	if err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+
+	items, err = s.validateOrder(tx, id, order.Items, items)
+	if err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+
+	previous := order
+	order.Items = items
+	if err := applyPromotion(tx, &order, order.PromoCode); err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+	if err := applyLoyalty(tx, &order, previous); err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+	if err := applyTaxes(tx, &order); err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+	if order.Paid() > order.Total() {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, fmt.Errorf("%w: %.2f was paid, more than the new total of %.2f", customErrors.ErrOrderNotEditable, order.Paid(), order.Total())
+	}
+	if err := tx.SaveOrderRepo(order); err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+
+	if err := tx.RecordEvent(models.EventOrderItemsChanged, models.NewOrderItemsChanged(order, ops)); err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
 	}
 
-	return *totalPrice, nil
+	if err := tx.Commit(); err != nil {
+		slog.Error("Order Service in UpdateOrderItemsService")
+		return models.Order{}, err
+	}
+
+	return order, nil
 }
 
+// PublishCommitted tells the event publisher about the orders a commit changed,
+// once each, in the order the commit first changed them. Register it with
+// Store.OnCommit: it runs while the commit still holds the store, so the
+// orders it reads are as the commit left them, and the events go out in the
+// order of the journal.
+func (s *OrderServiceImpl) PublishCommitted(events []models.Event) {
+	if s.events == nil {
+		return
+	}
+
+	var orderIDs []string
+	types := make(map[string]string)
+	for _, event := range events {
+		orderID, eventType, err := orderEventType(event)
+		if err != nil {
+			slog.Error("Order Service in PublishCommitted", "seq", event.Seq, "type", event.Type, "error", err)
+			continue
+		}
+		if orderID == "" {
+			continue
+		}
+		previous, exists := types[orderID]
+		if !exists {
+			orderIDs = append(orderIDs, orderID)
+		}
+		if orderEventRank[eventType] > orderEventRank[previous] {
+			types[orderID] = eventType
+		}
+	}
+
+	now := time.Now()
+	for _, orderID := range orderIDs {
+		event := models.OrderEvent{Type: types[orderID], OrderID: orderID, At: now}
+		if event.Type != models.OrderEventDeleted {
+			order, exists, err := s.orderRepo.GetOrderRepo(orderID)
+			if err != nil || !exists {
+				slog.Error("Order Service in PublishCommitted", "orderID", orderID, "error", err)
+				continue
+			}
+			entry := models.NewQueueEntry(order, now)
+			event.Status, event.Order = order.Status, &entry
+		}
+		s.events.Publish(event)
+	}
+}
+
+// orderEventRank decides which event a commit that changed an order in several
+// ways publishes for it.
+var orderEventRank = map[string]int{
+	models.OrderEventChanged: 1,
+	models.OrderEventClosed:  2,
+	models.OrderEventCreated: 3,
+	models.OrderEventDeleted: 4,
+}
+
+// orderEventType returns the order a journal event changed and the order
+// event it stands for, or no order for events about something else.
+func orderEventType(event models.Event) (string, string, error) {
+	switch event.Type {
+	case models.EventOrderCreated:
+		data, err := decodeEvent[models.OrderCreated](event)
+		return data.Order.ID, models.OrderEventCreated, err
+	case models.EventOrderUpdated:
+		data, err := decodeEvent[models.OrderUpdated](event)
+		return data.Order.ID, models.OrderEventChanged, err
+	case models.EventOrderItemsChanged:
+		data, err := decodeEvent[models.OrderItemsChanged](event)
+		return data.OrderID, models.OrderEventChanged, err
+	case models.EventOrderStatusChanged:
+		data, err := decodeEvent[models.OrderStatusChanged](event)
+		if data.To == models.StatusClosed {
+			return data.OrderID, models.OrderEventClosed, err
+		}
+		return data.OrderID, models.OrderEventChanged, err
+	case models.EventOrderPaid:
+		data, err := decodeEvent[models.OrderPaid](event)
+		return data.OrderID, models.OrderEventChanged, err
+	case models.EventOrderRefunded:
+		data, err := decodeEvent[models.OrderRefunded](event)
+		return data.Refund.OrderID, models.OrderEventChanged, err
+	case models.EventOrderDeleted:
+		data, err := decodeEvent[models.OrderDeleted](event)
+		return data.OrderID, models.OrderEventDeleted, err
+	}
+	return "", "", nil
+}
+
+// editableOrder returns the order if its items can still be changed.
+func editableOrder(tx OrderTx, id string) (models.Order, error) {
+	order, exists, err := tx.GetOrderRepo(id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if !exists {
+		return models.Order{}, fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+	}
+	if order.Status == models.StatusClosed {
+		return models.Order{}, fmt.Errorf("%w", customErrors.ErrOrderClosed)
+	}
+	if !models.OrderEditable(order.Status) {
+		return models.Order{}, fmt.Errorf("%w: the order is %s", customErrors.ErrOrderNotEditable, order.Status)
+	}
+	return order, nil
+}
+
+// DeleteOrderByIdService deletes a cancelled or closed order. An order still
+// in progress holds ingredients, a promo code use and redeemed points, which
+// only cancelling gives back.
 func (s *OrderServiceImpl) DeleteOrderByIdService(id string) error {
-	orderMap, err := s.orderRepo.GetOrdersRepo()
+	tx, err := s.uow.Begin()
 	if err != nil {
 		slog.Error("Order Service in DeleteOrderByIdService")
 		return err
 	}
+	defer tx.Rollback()
 
-	_, exists := orderMap[id]
+	order, exists, err := tx.GetOrderRepo(id)
+	if err != nil {
+		slog.Error("Order Service in DeleteOrderByIdService")
+		return err
+	}
 	if !exists {
 		slog.Error("Order Service in DeleteOrderByIdService")
 		return fmt.Errorf("%w", customErrors.ErrNotExistConflict)
 	}
+	if order.Status != models.StatusCancelled && order.Status != models.StatusClosed {
+		slog.Error("Order Service in DeleteOrderByIdService")
+		return fmt.Errorf("%w: order %s is %s, cancel it first", customErrors.ErrOrderNotDeletable, id, order.Status)
+	}
 
-	delete(orderMap, id)
-	return s.orderRepo.UpdateOrdersRepo(orderMap)
+	if err := tx.DeleteOrderRepo(id); err != nil {
+		slog.Error("Order Service in DeleteOrderByIdService")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventOrderDeleted, models.OrderDeleted{OrderID: id}); err != nil {
+		slog.Error("Order Service in DeleteOrderByIdService")
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Order Service in DeleteOrderByIdService")
+		return err
+	}
+
+	return nil
 }
 
-func (s *OrderServiceImpl) CloseOrderByIdService(id string) error {
-	orderMap, err := s.orderRepo.GetOrdersRepo()
+// CloseOrderByIdService takes payments for the order and closes it. The order
+// has to be ready or served, a ready one being served on the way, and only
+// closes once the payments, these and those taken before, cover its total.
+func (s *OrderServiceImpl) CloseOrderByIdService(id string, payments []models.Payment) (models.OrderBill, error) {
+	bill, err := s.takePayments(id, payments, true)
 	if err != nil {
 		slog.Error("Order Service in CloseOrderByIdService")
-		return err
+		return models.OrderBill{}, err
+	}
+	return bill, nil
+}
+
+// PayOrderService takes payments for the order without closing it, as when
+// the guests of a split bill pay one after another. A served order closes once
+// it is paid in full.
+func (s *OrderServiceImpl) PayOrderService(id string, payments []models.Payment) (models.OrderBill, error) {
+	if len(payments) == 0 {
+		slog.Error("Order Service in PayOrderService")
+		return models.OrderBill{}, fmt.Errorf("%w: no payments", customErrors.ErrInvalidInput)
 	}
 
-	order, exists := orderMap[id]
+	bill, err := s.takePayments(id, payments, false)
+	if err != nil {
+		slog.Error("Order Service in PayOrderService")
+		return models.OrderBill{}, err
+	}
+	return bill, nil
+}
+
+// takePayments adds payments to the order and closes it when close is set or
+// the order is served and paid in full, all in one transaction. A ready order
+// closed this way is served first.
+func (s *OrderServiceImpl) takePayments(id string, payments []models.Payment, close bool) (models.OrderBill, error) {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		return models.OrderBill{}, err
+	}
+	defer tx.Rollback()
+
+	order, exists, err := tx.GetOrderRepo(id)
+	if err != nil {
+		return models.OrderBill{}, err
+	}
 	if !exists {
-		slog.Error("Order Service in CloseOrderByIdService")
-		return fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+		return models.OrderBill{}, fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+	}
+	switch order.Status {
+	case models.StatusClosed:
+		return models.OrderBill{}, fmt.Errorf("%w", customErrors.ErrOrderClosed)
+	case models.StatusCancelled:
+		return models.OrderBill{}, fmt.Errorf("%w: the order is cancelled", customErrors.ErrOrderNotEditable)
+	}
+
+	taken, err := models.TakePayments(&order, payments, time.Now())
+	if err != nil {
+		return models.OrderBill{}, err
+	}
+	if len(taken) != 0 {
+		if err := tx.SaveOrderRepo(order); err != nil {
+			return models.OrderBill{}, err
+		}
+		if err := tx.RecordEvent(models.EventOrderPaid, models.OrderPaid{OrderID: id, Payments: taken}); err != nil {
+			return models.OrderBill{}, err
+		}
+	}
+
+	if close && order.Status == models.StatusReady {
+		if order, err = s.transition(tx, order, models.StatusServed, ""); err != nil {
+			return models.OrderBill{}, err
+		}
+	}
+	if close || (order.Balance() == 0 && models.CanTransition(order.Status, models.StatusClosed)) {
+		if order, err = s.transition(tx, order, models.StatusClosed, ""); err != nil {
+			return models.OrderBill{}, err
+		}
 	}
 
-	order.Status = "closed"
-	orderMap[id] = order
+	if err := tx.Commit(); err != nil {
+		return models.OrderBill{}, err
+	}
 
-	return s.orderRepo.UpdateOrdersRepo(orderMap)
+	return models.NewOrderBill(order, taken), nil
 }
 
-func (s *OrderServiceImpl) validateOrder(orderItems []models.OrderItem) (map[string]models.MenuItem, error) {
+// TransitionOrderService moves the order to status, if the order lifecycle
+// allows it from the status the order is in, and records when it did. An order
+// cancelled this way is cancelled for the "other" reason.
+func (s *OrderServiceImpl) TransitionOrderService(id, status string) (models.Order, error) {
+	if !models.ValidOrderStatus(status) {
+		slog.Error("Order Service in TransitionOrderService")
+		return models.Order{}, fmt.Errorf("%w: unknown order status %q", customErrors.ErrInvalidInput, status)
+	}
+
+	var reason string
+	if status == models.StatusCancelled {
+		reason = models.CancelReasonOther
+	}
+
+	order, err := s.changeStatus(id, status, reason)
+	if err != nil {
+		slog.Error("Order Service in TransitionOrderService")
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+// CancelOrderService cancels the order for reason and puts the ingredients of
+// its items back into the inventory.
+func (s *OrderServiceImpl) CancelOrderService(id, reason string) (models.Order, error) {
+	if !models.ValidCancelReason(reason) {
+		slog.Error("Order Service in CancelOrderService")
+		return models.Order{}, fmt.Errorf("%w: unknown cancel reason %q", customErrors.ErrInvalidInput, reason)
+	}
+
+	order, err := s.changeStatus(id, models.StatusCancelled, reason)
+	if err != nil {
+		slog.Error("Order Service in CancelOrderService")
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+// changeStatus moves the order to status in one transaction.
+func (s *OrderServiceImpl) changeStatus(id, status, reason string) (models.Order, error) {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Order Service in changeStatus")
+		return models.Order{}, err
+	}
+	defer tx.Rollback()
+
+	order, exists, err := tx.GetOrderRepo(id)
+	if err != nil {
+		slog.Error("Order Service in changeStatus")
+		return models.Order{}, err
+	}
+	if !exists {
+		slog.Error("Order Service in changeStatus")
+		return models.Order{}, fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+	}
+
+	order, err = s.transition(tx, order, status, reason)
+	if err != nil {
+		slog.Error("Order Service in changeStatus")
+		return models.Order{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Order Service in changeStatus")
+		return models.Order{}, err
+	}
+
+	return order, nil
+}
+
+// StatusTx is the part of a transaction transition works on.
+type StatusTx interface {
+	OrderTx
+	InventTxForOrder
+	PromotionTx
+	CustomerTx
+}
+
+// transition stages the move of order to status in tx and returns the order
+// after it. An order only closes once it is paid in full, and earns its
+// customer points when it does. Cancelling also returns the ingredients the
+// order's items took to the inventory, the use of its promo code and the points
+// it redeemed.
+func (s *OrderServiceImpl) transition(tx StatusTx, order models.Order, status, reason string) (models.Order, error) {
+	if !models.CanTransition(order.Status, status) {
+		return models.Order{}, &customErrors.TransitionError{
+			OrderID: order.ID,
+			From:    order.Status,
+			To:      status,
+			Allowed: models.NextOrderStatuses(order.Status),
+		}
+	}
+	if status == models.StatusClosed && order.Balance() > 0 {
+		return models.Order{}, fmt.Errorf("%w: %.2f of %.2f is still due on order %s", customErrors.ErrPaymentDue, order.Balance(), order.Total(), order.ID)
+	}
+
+	changed := models.OrderStatusChanged{
+		OrderID: order.ID,
+		From:    order.Status,
+		To:      status,
+		At:      time.Now(),
+		Reason:  reason,
+	}
+
+	order.Status = status
+	order.CancelReason = reason
+	order.StatusHistory = append(append([]models.StatusChange(nil), order.StatusHistory...), models.StatusChange{Status: status, At: changed.At})
+	if err := tx.SaveOrderRepo(order); err != nil {
+		return models.Order{}, err
+	}
+	if status == models.StatusClosed {
+		changed.Order = &order
+	}
+
+	if err := tx.RecordEvent(models.EventOrderStatusChanged, changed); err != nil {
+		return models.Order{}, err
+	}
+
+	if status == models.StatusCancelled {
+		if _, err := restock(tx, order.ID, models.ItemsIngredients(order.Items)); err != nil {
+			return models.Order{}, err
+		}
+		if err := releasePromotion(tx, order.PromoCode); err != nil {
+			return models.Order{}, err
+		}
+		if err := returnPoints(tx, order); err != nil {
+			return models.Order{}, err
+		}
+	}
+	if status == models.StatusClosed {
+		if err := earnPoints(tx, order); err != nil {
+			return models.Order{}, err
+		}
+	}
+
+	return order, nil
+}
+
+// restock stages the return of quantities, taken by the order orderID, to the
+// inventory in tx, and returns them. Ingredients no longer in the inventory are
+// skipped, as there is nothing left to return them to.
+func restock(tx InventTxForOrder, orderID string, quantities map[string]float64) (map[string]float64, error) {
+	inventoryMap, err := tx.GetInventsRepo()
+	if err != nil {
+		slog.Error("Order Service in restock")
+		return nil, err
+	}
+
+	returned := make(map[string]float64, len(quantities))
+	for ingredientID, quantity := range quantities {
+		if _, exists := inventoryMap[ingredientID]; exists && quantity != 0 {
+			returned[ingredientID] = quantity
+		}
+	}
+	if len(returned) == 0 {
+		return returned, nil
+	}
+
+	for ingredientID, quantity := range returned {
+		inventoryItem := inventoryMap[ingredientID]
+		inventoryItem.Quantity += quantity
+		inventoryMap[ingredientID] = inventoryItem
+	}
+
+	if err := tx.UpdateInventsRepo(inventoryMap); err != nil {
+		slog.Error("Order Service in restock")
+		return nil, err
+	}
+
+	return returned, recordInventoryAdjustments(tx, orderID, returned, 1, inventoryMap)
+}
+
+// RefundOrderService refunds units of the lines of a closed order, or all of
+// it, and restocks their ingredients or writes them off as waste, all in one
+// transaction.
+func (s *OrderServiceImpl) RefundOrderService(id string, refund models.Refund) (models.Refund, error) {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, err
+	}
+	defer tx.Rollback()
+
+	order, exists, err := tx.GetOrderRepo(id)
+	if err != nil {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, err
+	}
+	if !exists {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+	}
+
+	refund, err = models.NewRefund(order, refund, time.Now())
+	if err != nil {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, err
+	}
+
+	refund.Ingredients = models.ItemsIngredients(refund.OrderItems(order))
+	if refund.Inventory == models.RefundRestock {
+		if refund.Ingredients, err = restock(tx, id, refund.Ingredients); err != nil {
+			slog.Error("Order Service in RefundOrderService")
+			return models.Refund{}, err
+		}
+	}
+
+	if err := reversePoints(tx, order, &refund); err != nil {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, err
+	}
+
+	order.Refunds = append(order.Refunds, refund)
+	if err := tx.SaveOrderRepo(order); err != nil {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, err
+	}
+
+	if err := tx.RecordEvent(models.EventOrderRefunded, models.OrderRefunded{Refund: refund}); err != nil {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Order Service in RefundOrderService")
+		return models.Refund{}, err
+	}
+
+	return refund, nil
+}
+
+// PromotionTx is the part of a transaction applyPromotion works on.
+type PromotionTx interface {
+	GetPromotionsRepo() (map[string]models.Promotion, error)
+	UpdatePromotionsRepo(promotionMap map[string]models.Promotion) error
+	EventRecorder
+}
+
+// applyPromotion works out the discounts of order from its promo code and
+// stages the use of the code in tx. previousCode is the code the order had
+// before: when the code changes, the old one's use is given back and the new
+// one has to be available. A code the order already had is only evaluated
+// again, and gives no discount anymore once its promotion is deleted.
+func applyPromotion(tx PromotionTx, order *models.Order, previousCode string) error {
+	order.PromoCode = models.NormalizePromoCode(order.PromoCode)
+	promotionMap, err := tx.GetPromotionsRepo()
+	if err != nil {
+		return err
+	}
+
+	var changed []models.Promotion
+	if order.PromoCode != previousCode {
+		if previous, exists := promotionMap[previousCode]; exists && previous.Used > 0 {
+			previous.Used--
+			promotionMap[previousCode] = previous
+			changed = append(changed, previous)
+		}
+		if order.PromoCode != "" {
+			promotion, exists := promotionMap[order.PromoCode]
+			if !exists {
+				return fmt.Errorf("%w: unknown promo code %s", customErrors.ErrInvalidPromotion, order.PromoCode)
+			}
+			if err := promotion.Available(time.Now()); err != nil {
+				return err
+			}
+			promotion.Used++
+			promotionMap[order.PromoCode] = promotion
+			changed = append(changed, promotion)
+		}
+	}
+
+	order.Discounts = nil
+	if promotion, exists := promotionMap[order.PromoCode]; exists && order.PromoCode != "" {
+		order.Discounts = promotion.Discounts(order.Items)
+	}
+
+	return savePromotions(tx, promotionMap, changed)
+}
+
+// releasePromotion gives back the use of code by an order that was cancelled.
+func releasePromotion(tx PromotionTx, code string) error {
+	promotionMap, err := tx.GetPromotionsRepo()
+	if err != nil {
+		return err
+	}
+
+	promotion, exists := promotionMap[code]
+	if !exists || code == "" || promotion.Used == 0 {
+		return nil
+	}
+	promotion.Used--
+	promotionMap[code] = promotion
+	return savePromotions(tx, promotionMap, []models.Promotion{promotion})
+}
+
+func savePromotions(tx PromotionTx, promotionMap map[string]models.Promotion, changed []models.Promotion) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	if err := tx.UpdatePromotionsRepo(promotionMap); err != nil {
+		return err
+	}
+	for _, promotion := range changed {
+		if err := tx.RecordEvent(models.EventPromotionUpdated, models.PromotionUpdated{Promotion: promotion}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TaxTx is the part of a transaction applyTaxes reads.
+type TaxTx interface {
+	GetTaxSettingsRepo() (models.TaxSettings, error)
+}
+
+// applyTaxes works out the taxes and the service charge of order with the
+// current tax settings. It runs after applyPromotion, as discounts lower the
+// taxable amounts.
+func applyTaxes(tx TaxTx, order *models.Order) error {
+	settings, err := tx.GetTaxSettingsRepo()
+	if err != nil {
+		return err
+	}
+	settings.ApplyTaxes(order)
+	return nil
+}
+
+// InventTxForOrder is the part of a transaction validateOrder works on.
+type InventTxForOrder interface {
+	InventRepoForOrder
+	EventRecorder
+}
+
+// validateOrder prices the lines of the order orderID going from before to
+// after, checks that the inventory covers the change, and stages the
+// difference in ingredients in tx; nothing is written until the caller commits.
+// A new order has no lines before. It returns the priced lines with the
+// ingredients they took. Only lines whose quantity goes up have to match the
+// menu, so lines for products or options removed from the menu since can still
+// be kept or dropped.
+func (s *OrderServiceImpl) validateOrder(tx InventTxForOrder, orderID string, before, after []models.OrderItem) ([]models.OrderItem, error) {
 	menuMap, err := s.menuRepo.GetMenusRepo()
 	if err != nil {
 		slog.Error("Order Service in validateOrder")
 		return nil, err
 	}
-	inventoryMap, err := s.inventRepo.GetInventsRepo()
+	priced, err := models.PriceOrderItems(after, before, menuMap)
+	if err != nil {
+		slog.Error("Order Service in validateOrder")
+		return nil, err
+	}
+	inventoryMap, err := tx.GetInventsRepo()
 	if err != nil {
 		slog.Error("Order Service in validateOrder")
 		return nil, err
 	}
 
-	requiredIngredients := make(map[string]float64)
-	for _, orderItem := range orderItems {
-		menuItem, exists := menuMap[orderItem.ProductID]
-		if !exists {
-			return nil, customErrors.ErrNotExistConflict
-		}
+	placed := make(map[string]models.OrderItem)
+	for _, orderItem := range models.MergeOrderItems(before) {
+		placed[orderItem.LineKey()] = orderItem
+	}
 
-		for _, ingredient := range menuItem.Ingredients {
-			requiredIngredients[ingredient.IngredientID] += ingredient.Quantity * float64(orderItem.Quantity)
+	requiredIngredients := make(map[string]float64)
+	for i, orderItem := range priced {
+		priced[i].Ingredients = lineIngredients(menuMap, placed[orderItem.LineKey()], orderItem, requiredIngredients)
+		delete(placed, orderItem.LineKey())
+	}
+	for _, orderItem := range placed {
+		for ingredientID, quantity := range orderItem.Ingredients {
+			requiredIngredients[ingredientID] -= quantity
 		}
 	}
 
 	for ingredientID, requiredQuantity := range requiredIngredients {
 		inventoryItem, exists := inventoryMap[ingredientID]
-		if !exists || inventoryItem.Quantity < requiredQuantity {
+		if requiredQuantity == 0 || (!exists && requiredQuantity < 0) {
+			delete(requiredIngredients, ingredientID)
+			continue
+		}
+		if requiredQuantity > 0 && (!exists || inventoryItem.Quantity < requiredQuantity) {
 			slog.Error("Insufficient ingredient in inventory", "ingredientID", ingredientID)
-			return nil, fmt.Errorf("insufficient ingredient: %s", ingredientID)
+			return nil, fmt.Errorf("%w: %s", customErrors.ErrInsufficientStock, ingredientID)
 		}
 	}
+	if len(requiredIngredients) == 0 {
+		return priced, nil
+	}
 
 	for ingredientID, usedQuantity := range requiredIngredients {
 		inventoryItem := inventoryMap[ingredientID]
@@ -227,10 +963,37 @@ func (s *OrderServiceImpl) validateOrder(orderItems []models.OrderItem) (map[str
 		inventoryMap[ingredientID] = inventoryItem
 	}
 
-	if err := s.inventRepo.UpdateInventsRepo(inventoryMap); err != nil {
+	if err := tx.UpdateInventsRepo(inventoryMap); err != nil {
 		slog.Error("Order Service in validateOrder")
 		return nil, err
 	}
 
-	return menuMap, nil
+	if err := recordInventoryAdjustments(tx, orderID, requiredIngredients, -1, inventoryMap); err != nil {
+		slog.Error("Order Service in validateOrder")
+		return nil, err
+	}
+
+	return priced, nil
+}
+
+// lineIngredients returns the ingredients the line item takes when it goes from
+// the quantity of placed, the line before, to its own, and adds the change to
+// required. Units added take the current recipe; units removed give back their
+// share of what the line took.
+func lineIngredients(menuMap map[string]models.MenuItem, placed, item models.OrderItem, required map[string]float64) map[string]float64 {
+	if item.Quantity <= placed.Quantity {
+		taken := placed.UnitsIngredients(item.Quantity)
+		for ingredientID, quantity := range placed.Ingredients {
+			required[ingredientID] -= quantity - taken[ingredientID]
+		}
+		return taken
+	}
+
+	taken := placed.UnitsIngredients(placed.Quantity)
+	added := float64(item.Quantity - placed.Quantity)
+	for ingredientID, quantity := range menuMap[item.ProductID].UnitIngredients(item) {
+		taken[ingredientID] += quantity * added
+		required[ingredientID] += quantity * added
+	}
+	return taken
 }
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"sort"
+)
+
+type PromotionRepo interface {
+	GetPromotionsRepo() (map[string]models.Promotion, error)
+}
+
+type PromotionServImpl struct {
+	promotionRepo PromotionRepo
+	uow           UnitOfWork
+}
+
+func NewPromotionServImpl(pR PromotionRepo, uow UnitOfWork) *PromotionServImpl {
+	return &PromotionServImpl{
+		promotionRepo: pR,
+		uow:           uow,
+	}
+}
+
+func (s *PromotionServImpl) CreatePromotionServ(promotion models.Promotion) error {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Promotion Service in CreatePromotionServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	promotionMap, err := tx.GetPromotionsRepo()
+	if err != nil {
+		slog.Error("Promotion Service in CreatePromotionServ")
+		return err
+	}
+
+	if _, exists := promotionMap[promotion.Code]; exists {
+		slog.Error("Promotion Service in CreatePromotionServ: The promotion already exists.")
+		return fmt.Errorf("%w", customErrors.ErrExistConflict)
+	}
+
+	promotionMap[promotion.Code] = promotion
+	if err := tx.UpdatePromotionsRepo(promotionMap); err != nil {
+		slog.Error("Promotion Service in CreatePromotionServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventPromotionCreated, models.PromotionCreated{Promotion: promotion}); err != nil {
+		slog.Error("Promotion Service in CreatePromotionServ")
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PromotionServImpl) GetPromotionsServ() ([]models.Promotion, error) {
+	promotionMap, err := s.promotionRepo.GetPromotionsRepo()
+	if err != nil {
+		slog.Error("Promotion Service in GetPromotionsServ")
+		return nil, err
+	}
+
+	promotions := []models.Promotion{}
+	for _, promotion := range promotionMap {
+		promotions = append(promotions, promotion)
+	}
+	sort.Slice(promotions, func(i, j int) bool {
+		return promotions[i].Code < promotions[j].Code
+	})
+
+	return promotions, nil
+}
+
+func (s *PromotionServImpl) GetPromotionServ(code string) (models.Promotion, error) {
+	promotionMap, err := s.promotionRepo.GetPromotionsRepo()
+	if err != nil {
+		slog.Error("Promotion Service in GetPromotionServ")
+		return models.Promotion{}, err
+	}
+
+	promotion, exists := promotionMap[models.NormalizePromoCode(code)]
+	if !exists {
+		slog.Error("Promotion Service in GetPromotionServ: doesn't exist")
+		return models.Promotion{}, fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+	}
+
+	return promotion, nil
+}
+
+// UpdatePromotionServ replaces the rules of a promotion. The uses it already
+// has are kept.
+func (s *PromotionServImpl) UpdatePromotionServ(promotion models.Promotion) error {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Promotion Service in UpdatePromotionServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	promotionMap, err := tx.GetPromotionsRepo()
+	if err != nil {
+		slog.Error("Promotion Service in UpdatePromotionServ")
+		return err
+	}
+
+	old, exists := promotionMap[promotion.Code]
+	if !exists {
+		slog.Error("Promotion Service in UpdatePromotionServ: doesn't exist")
+		return fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+	}
+
+	promotion.Used = old.Used
+	promotionMap[promotion.Code] = promotion
+	if err := tx.UpdatePromotionsRepo(promotionMap); err != nil {
+		slog.Error("Promotion Service in UpdatePromotionServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventPromotionUpdated, models.PromotionUpdated{Promotion: promotion}); err != nil {
+		slog.Error("Promotion Service in UpdatePromotionServ")
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeletePromotionServ deletes a promotion. Orders it is attached to keep the
+// discounts they got until their items change.
+func (s *PromotionServImpl) DeletePromotionServ(code string) error {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Promotion Service in DeletePromotionServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	code = models.NormalizePromoCode(code)
+	promotionMap, err := tx.GetPromotionsRepo()
+	if err != nil {
+		slog.Error("Promotion Service in DeletePromotionServ")
+		return err
+	}
+	if _, exists := promotionMap[code]; !exists {
+		slog.Error("Promotion Service in DeletePromotionServ: doesn't exist")
+		return fmt.Errorf("%w", customErrors.ErrNotExistConflict)
+	}
+
+	delete(promotionMap, code)
+	if err := tx.UpdatePromotionsRepo(promotionMap); err != nil {
+		slog.Error("Promotion Service in DeletePromotionServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventPromotionDeleted, models.PromotionDeleted{Code: code}); err != nil {
+		slog.Error("Promotion Service in DeletePromotionServ")
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"time"
+)
+
+type OrderRepoForQueue interface {
+	GetOrdersByStatusRepo(status string) ([]models.Order, error)
+}
+
+type QueueServiceImpl struct {
+	orderRepo OrderRepoForQueue
+}
+
+func NewQueueServiceImpl(oR OrderRepoForQueue) *QueueServiceImpl {
+	return &QueueServiceImpl{
+		orderRepo: oR,
+	}
+}
+
+// GetQueueService returns the open and in-progress orders in the queue order
+// by.
+func (s *QueueServiceImpl) GetQueueService(by string) ([]models.QueueEntry, error) {
+	if by != models.QueueFIFO && by != models.QueuePriority {
+		slog.Error("Queue Service in GetQueueService")
+		return nil, fmt.Errorf("%w: cannot order the queue by %q, available: %v", customErrors.ErrInvalidInput, by, models.QueueOrders())
+	}
+
+	now := time.Now()
+	entries := []models.QueueEntry{}
+	for _, status := range models.QueueStatuses() {
+		orders, err := s.orderRepo.GetOrdersByStatusRepo(status)
+		if err != nil {
+			slog.Error("Queue Service in GetQueueService")
+			return nil, err
+		}
+		for _, order := range orders {
+			entries = append(entries, models.NewQueueEntry(order, now))
+		}
+	}
+
+	models.SortQueue(entries, by)
+	return entries, nil
+}
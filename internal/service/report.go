@@ -1,9 +1,11 @@
 package service
 
 import (
+	"fmt"
 	"hot-coffee/internal/customErrors"
 	"hot-coffee/internal/models"
 	"sort"
+	"time"
 )
 
 type OrderRepoForReport interface {
@@ -27,51 +29,76 @@ func NewReportsService(or OrderRepoForReport, mr MenuRepoForReports) *ReportsSer
 	}
 }
 
+// TotalSalesReportService sums the net sales of the orders that are closed or
+// paid in full. Tax is left to the tax summary.
 func (rs *ReportsServiceImplementation) TotalSalesReportService() (models.TotalPrice, error) {
 	ordersMap, err := rs.ordersRepository.GetOrdersRepo()
 	if err != nil {
 		return models.TotalPrice{}, err
 	}
 
-	menuMap, err := rs.menuRepository.GetMenusRepo()
-	if err != nil {
-		return models.TotalPrice{}, err
-	}
-
 	var totalSale models.TotalPrice
-	for _, items := range ordersMap {
-		for _, item := range items.Items {
-			totalSale.TotalSale += menuMap[item.ProductID].Price * float64(item.Quantity)
+	for _, order := range ordersMap {
+		paid := order.Status != models.StatusCancelled && order.Paid() > 0 && order.Balance() == 0
+		if order.Status != models.StatusClosed && !paid {
+			continue
 		}
+		totalSale.TotalSale += order.NetSales()
 	}
+	totalSale.TotalSale = models.RoundMoney(totalSale.TotalSale)
 
 	return totalSale, nil
 }
 
-func (rs *ReportsServiceImplementation) PopularItemsReportService() ([]models.PopularItem, error) {
+// PopularItemsReportService returns the most sold item, counting sales per
+// product or, grouped by variant, per product variant. Cancelled orders and
+// refunded units are not sales.
+func (rs *ReportsServiceImplementation) PopularItemsReportService(groupBy string) ([]models.PopularItem, error) {
+	if groupBy != models.GroupByProduct && groupBy != models.GroupByVariant {
+		return nil, fmt.Errorf("%w: cannot group by %q", customErrors.ErrInvalidInput, groupBy)
+	}
+
 	ordersMap, err := rs.ordersRepository.GetOrdersRepo()
 	if err != nil {
 		return nil, err
 	}
 
 	popularItemsMap := make(map[string]models.PopularItem)
+	count := func(productID, variantID string, quantity int) {
+		key, variant := productID, ""
+		if groupBy == models.GroupByVariant {
+			key, variant = productID+"/"+variantID, variantID
+		}
 
-	for _, items := range ordersMap {
-		for _, item := range items.Items {
-			_, exists := popularItemsMap[item.ProductID]
-			if exists {
-				tempItem := popularItemsMap[item.ProductID]
-				tempItem.QuantityOfSales += item.Quantity
-				popularItemsMap[item.ProductID] = tempItem
-			} else {
-				popularItemsMap[item.ProductID] = models.PopularItem{ItemName: item.ProductID, QuantityOfSales: item.Quantity}
+		_, exists := popularItemsMap[key]
+		if exists {
+			tempItem := popularItemsMap[key]
+			tempItem.QuantityOfSales += quantity
+			popularItemsMap[key] = tempItem
+		} else {
+			popularItemsMap[key] = models.PopularItem{ItemName: productID, Variant: variant, QuantityOfSales: quantity}
+		}
+	}
+
+	for _, order := range ordersMap {
+		if order.Status == models.StatusCancelled {
+			continue
+		}
+		for _, item := range order.Items {
+			count(item.ProductID, item.Variant, item.Quantity)
+		}
+		for _, refund := range order.Refunds {
+			for _, item := range refund.Items {
+				count(item.ProductID, item.Variant, -item.Quantity)
 			}
 		}
 	}
 
 	var popularItems []models.PopularItem
 	for _, item := range popularItemsMap {
-		popularItems = append(popularItems, item)
+		if item.QuantityOfSales > 0 {
+			popularItems = append(popularItems, item)
+		}
 	}
 	sort.Slice(popularItems, func(i, j int) bool {
 		return popularItems[i].QuantityOfSales > popularItems[j].QuantityOfSales
@@ -83,3 +110,108 @@ func (rs *ReportsServiceImplementation) PopularItemsReportService() ([]models.Po
 		return nil, customErrors.ErrNotExistConflict
 	}
 }
+
+// TaxSummaryReportService adds up the taxes and service charges of the orders
+// created from from to to, both "2006-01-02" dates and either of them
+// optional. Cancelled orders were never paid and are left out.
+func (rs *ReportsServiceImplementation) TaxSummaryReportService(from, to string) (models.TaxSummary, error) {
+	if err := checkDateRange(from, to); err != nil {
+		return models.TaxSummary{}, err
+	}
+
+	ordersMap, err := rs.ordersRepository.GetOrdersRepo()
+	if err != nil {
+		return models.TaxSummary{}, err
+	}
+
+	summary := models.TaxSummary{From: from, To: to, Taxes: []models.TaxLine{}}
+	taxes := make(map[string]models.TaxLine)
+	for _, order := range ordersMap {
+		if order.Status == models.StatusCancelled || !inDateRange(order.CreatedAt, from, to) {
+			continue
+		}
+
+		summary.Orders++
+		summary.Subtotal += order.Subtotal()
+		summary.DiscountTotal += order.DiscountTotal()
+		summary.ServiceCharge += order.ServiceCharge
+		summary.Total += order.Total()
+		for _, tax := range order.Taxes {
+			key := fmt.Sprintf("%s/%s/%g", tax.Category, tax.Name, tax.Rate)
+			line, exists := taxes[key]
+			if !exists {
+				line = models.TaxLine{Category: tax.Category, Name: tax.Name, Rate: tax.Rate}
+			}
+			line.Taxable += tax.Taxable
+			line.Amount += tax.Amount
+			taxes[key] = line
+		}
+	}
+
+	for _, line := range taxes {
+		line.Taxable, line.Amount = models.RoundMoney(line.Taxable), models.RoundMoney(line.Amount)
+		summary.Taxes = append(summary.Taxes, line)
+		summary.TaxTotal += line.Amount
+	}
+	sort.Slice(summary.Taxes, func(i, j int) bool {
+		if summary.Taxes[i].Category != summary.Taxes[j].Category {
+			return summary.Taxes[i].Category < summary.Taxes[j].Category
+		}
+		return summary.Taxes[i].Rate < summary.Taxes[j].Rate
+	})
+
+	summary.Subtotal = models.RoundMoney(summary.Subtotal)
+	summary.DiscountTotal = models.RoundMoney(summary.DiscountTotal)
+	summary.TaxTotal = models.RoundMoney(summary.TaxTotal)
+	summary.ServiceCharge = models.RoundMoney(summary.ServiceCharge)
+	summary.Total = models.RoundMoney(summary.Total)
+	return summary, nil
+}
+
+// RefundsReportService lists the refunds made from from to to, both
+// "2006-01-02" dates and either of them optional, newest first.
+func (rs *ReportsServiceImplementation) RefundsReportService(from, to string) (models.RefundReport, error) {
+	if err := checkDateRange(from, to); err != nil {
+		return models.RefundReport{}, err
+	}
+
+	ordersMap, err := rs.ordersRepository.GetOrdersRepo()
+	if err != nil {
+		return models.RefundReport{}, err
+	}
+
+	report := models.RefundReport{From: from, To: to, ByReason: make(map[string]float64), Refunds: []models.Refund{}}
+	for _, order := range ordersMap {
+		for _, refund := range order.Refunds {
+			if !inDateRange(refund.CreatedAt, from, to) {
+				continue
+			}
+			report.Count++
+			report.Total += refund.Amount
+			report.ByReason[refund.Reason] = models.RoundMoney(report.ByReason[refund.Reason] + refund.Amount)
+			report.Refunds = append(report.Refunds, refund)
+		}
+	}
+	report.Total = models.RoundMoney(report.Total)
+	sort.Slice(report.Refunds, func(i, j int) bool {
+		return report.Refunds[i].CreatedAt.After(report.Refunds[j].CreatedAt)
+	})
+
+	return report, nil
+}
+
+func checkDateRange(from, to string) error {
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse(time.DateOnly, date); date != "" && err != nil {
+			return fmt.Errorf("%w: %q is not a date like 2006-01-02", customErrors.ErrInvalidInput, date)
+		}
+	}
+	return nil
+}
+
+// inDateRange reports whether t falls on a day from from to to, either of them
+// optional.
+func inDateRange(t time.Time, from, to string) bool {
+	day := t.Format(time.DateOnly)
+	return (from == "" || day >= from) && (to == "" || day <= to)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"hot-coffee/internal/models"
+	"log/slog"
+)
+
+type SettingsRepo interface {
+	GetTaxSettingsRepo() (models.TaxSettings, error)
+}
+
+type SettingsServImpl struct {
+	settingsRepo SettingsRepo
+	uow          UnitOfWork
+}
+
+func NewSettingsServImpl(sR SettingsRepo, uow UnitOfWork) *SettingsServImpl {
+	return &SettingsServImpl{
+		settingsRepo: sR,
+		uow:          uow,
+	}
+}
+
+func (s *SettingsServImpl) GetTaxSettingsServ() (models.TaxSettings, error) {
+	tax, err := s.settingsRepo.GetTaxSettingsRepo()
+	if err != nil {
+		slog.Error("Settings Service in GetTaxSettingsServ")
+		return models.TaxSettings{}, err
+	}
+	return tax, nil
+}
+
+// UpdateTaxSettingsServ replaces the tax settings. Orders keep the taxes they
+// were given until their items change.
+func (s *SettingsServImpl) UpdateTaxSettingsServ(tax models.TaxSettings) error {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Settings Service in UpdateTaxSettingsServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.UpdateTaxSettingsRepo(tax); err != nil {
+		slog.Error("Settings Service in UpdateTaxSettingsServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventTaxSettingsUpdated, models.TaxSettingsUpdated{Settings: tax}); err != nil {
+		slog.Error("Settings Service in UpdateTaxSettingsServ")
+		return err
+	}
+
+	return tx.Commit()
+}
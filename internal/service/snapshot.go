@@ -0,0 +1,58 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"regexp"
+)
+
+type SnapshotRepo interface {
+	CreateSnapshotRepo(note string) (models.Snapshot, error)
+	GetSnapshotsRepo() ([]models.Snapshot, error)
+	RestoreSnapshotRepo(id string) (models.Snapshot, error)
+}
+
+var snapshotIDPattern = regexp.MustCompile(`^snap-[0-9]{8}T[0-9]{6}Z(-[0-9]+)?$`)
+
+type SnapshotServiceImpl struct {
+	snapshotRepo SnapshotRepo
+}
+
+func NewSnapshotServiceImpl(sR SnapshotRepo) *SnapshotServiceImpl {
+	return &SnapshotServiceImpl{
+		snapshotRepo: sR,
+	}
+}
+
+func (s *SnapshotServiceImpl) CreateSnapshotServ(note string) (models.Snapshot, error) {
+	snapshot, err := s.snapshotRepo.CreateSnapshotRepo(note)
+	if err != nil {
+		slog.Error("Snapshot Service in CreateSnapshotServ")
+		return models.Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotServiceImpl) GetSnapshotsServ() ([]models.Snapshot, error) {
+	snapshots, err := s.snapshotRepo.GetSnapshotsRepo()
+	if err != nil {
+		slog.Error("Snapshot Service in GetSnapshotsServ")
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (s *SnapshotServiceImpl) RestoreSnapshotServ(id string) (models.Snapshot, error) {
+	if !snapshotIDPattern.MatchString(id) {
+		return models.Snapshot{}, fmt.Errorf("%w: snapshot %s", customErrors.ErrNotExistConflict, id)
+	}
+
+	snapshot, err := s.snapshotRepo.RestoreSnapshotRepo(id)
+	if err != nil {
+		slog.Error("Snapshot Service in RestoreSnapshotServ")
+		return models.Snapshot{}, err
+	}
+	return snapshot, nil
+}
@@ -1,34 +1,97 @@
 package service
 
 import (
-	"fmt"
 	"hot-coffee/internal/models"
-	"regexp"
-	"strconv"
+	"sort"
 )
 
-func getNewOrderID(orders map[string]models.Order) (string, error) {
-	var maxNum int
-	re := regexp.MustCompile(`\d+`)
+// UnitOfWork starts a transaction; every read-modify-write of the stores goes
+// through one so concurrent requests are applied one after another.
+type UnitOfWork interface {
+	Begin() (Tx, error)
+}
 
-	for id := range orders {
-		match := re.FindString(id)
-		if match == "" {
-			return "", fmt.Errorf("non valid ID")
-		}
+// Tx is a running transaction. Reads see what it staged, and nothing is
+// written until Commit; Rollback drops what is left uncommitted.
+type Tx interface {
+	GetOrdersRepo() (map[string]models.Order, error)
+	UpdateOrdersRepo(ordersMap map[string]models.Order) error
+	OrderTx
+	NextOrderIDRepo() (string, error)
+	IsValidOrderIDRepo(id string) bool
 
-		num, err := strconv.Atoi(match)
-		if err != nil {
-			return "", err
-		}
+	GetMenusRepo() (map[string]models.MenuItem, error)
+	UpdateMenusRepo(menuMap map[string]models.MenuItem) error
 
-		if num > maxNum {
-			maxNum = num
-		}
+	GetInventsRepo() (map[string]models.InventoryItem, error)
+	UpdateInventsRepo(inventMap map[string]models.InventoryItem) error
+
+	GetPromotionsRepo() (map[string]models.Promotion, error)
+	UpdatePromotionsRepo(promotionMap map[string]models.Promotion) error
+
+	GetTaxSettingsRepo() (models.TaxSettings, error)
+	UpdateTaxSettingsRepo(tax models.TaxSettings) error
+	UpdateSettingsRepo(settingsMap map[string]models.TaxSettings) error
+
+	GetWebhooksRepo() (map[string]models.Webhook, error)
+	UpdateWebhooksRepo(webhookMap map[string]models.Webhook) error
+	NewWebhookIDRepo() (string, error)
+	SetWebhookSecretRepo(id, secret string) error
+	DeleteWebhookSecretRepo(id string) error
+
+	GetCustomersRepo() (map[string]models.Customer, error)
+	UpdateCustomersRepo(customerMap map[string]models.Customer) error
+	GetCustomerRepo(id string) (models.Customer, bool, error)
+	SaveCustomerRepo(customer models.Customer) error
+	NewCustomerIDRepo() (string, error)
+
+	EventRecorder
+	Commit() error
+	Rollback()
+}
+
+// NewUnitOfWork returns the UnitOfWork that starts transactions with begin,
+// such as the Begin of a store whose transactions are of its own type.
+func NewUnitOfWork[T Tx](begin func() (T, error)) UnitOfWork {
+	return unitOfWork[T](begin)
+}
+
+type unitOfWork[T Tx] func() (T, error)
+
+func (begin unitOfWork[T]) Begin() (Tx, error) {
+	tx, err := begin()
+	if err != nil {
+		return nil, err
 	}
+	return tx, nil
+}
 
-	nextNum := strconv.Itoa(maxNum + 1)
-	orderID := "order" + nextNum
+// EventRecorder adds events to the journal of the running transaction.
+type EventRecorder interface {
+	RecordEvent(eventType string, data any) error
+}
 
-	return orderID, nil
+// recordInventoryAdjustments records one InventoryAdjusted event per
+// ingredient, multiplying each quantity by sign. inventoryMap is the inventory
+// after the adjustments.
+func recordInventoryAdjustments(events EventRecorder, orderID string, quantities map[string]float64, sign float64, inventoryMap map[string]models.InventoryItem) error {
+	ingredientIDs := make([]string, 0, len(quantities))
+	for ingredientID := range quantities {
+		ingredientIDs = append(ingredientIDs, ingredientID)
+	}
+	sort.Strings(ingredientIDs)
+
+	for _, ingredientID := range ingredientIDs {
+		err := events.RecordEvent(models.EventInventoryAdjusted, models.InventoryAdjusted{
+			IngredientID: ingredientID,
+			Delta:        sign * quantities[ingredientID],
+			Quantity:     inventoryMap[ingredientID].Quantity,
+			Unit:         inventoryMap[ingredientID].Unit,
+			OrderID:      orderID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
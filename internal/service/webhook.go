@@ -0,0 +1,229 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/internal/customErrors"
+	"hot-coffee/internal/models"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+type WebhookRepo interface {
+	GetWebhooksRepo() (map[string]models.Webhook, error)
+}
+
+type DeliveryLog interface {
+	NewDeliveryIDRepo() (string, error)
+	SaveDeliveryRepo(delivery models.WebhookDelivery) error
+	GetDeliveriesRepo() ([]models.WebhookDelivery, error)
+}
+
+type WebhookServImpl struct {
+	webhookRepo WebhookRepo
+	deliveries  DeliveryLog
+	uow         UnitOfWork
+}
+
+func NewWebhookServImpl(wR WebhookRepo, deliveries DeliveryLog, uow UnitOfWork) *WebhookServImpl {
+	return &WebhookServImpl{
+		webhookRepo: wR,
+		deliveries:  deliveries,
+		uow:         uow,
+	}
+}
+
+// CreateWebhookServ adds a webhook and returns it with its secret, made up
+// when none is given. The secret is kept apart from the webhook, out of the
+// journal, and is not shown again.
+func (s *WebhookServImpl) CreateWebhookServ(webhook models.Webhook) (models.Webhook, error) {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Webhook Service in CreateWebhookServ")
+		return models.Webhook{}, err
+	}
+	defer tx.Rollback()
+
+	webhookMap, err := tx.GetWebhooksRepo()
+	if err != nil {
+		slog.Error("Webhook Service in CreateWebhookServ")
+		return models.Webhook{}, err
+	}
+
+	if webhook.ID, err = tx.NewWebhookIDRepo(); err != nil {
+		slog.Error("Webhook Service in CreateWebhookServ: generating webhook ID")
+		return models.Webhook{}, err
+	}
+	if webhook.Secret == "" {
+		if webhook.Secret, err = models.NewWebhookSecret(); err != nil {
+			slog.Error("Webhook Service in CreateWebhookServ: generating secret")
+			return models.Webhook{}, err
+		}
+	}
+	webhook.CreatedAt = time.Now()
+
+	webhookMap[webhook.ID] = webhook.Redacted()
+	if err := tx.UpdateWebhooksRepo(webhookMap); err != nil {
+		slog.Error("Webhook Service in CreateWebhookServ")
+		return models.Webhook{}, err
+	}
+	if err := tx.SetWebhookSecretRepo(webhook.ID, webhook.Secret); err != nil {
+		slog.Error("Webhook Service in CreateWebhookServ")
+		return models.Webhook{}, err
+	}
+
+	if err := tx.RecordEvent(models.EventWebhookCreated, models.WebhookCreated{Webhook: webhook.Redacted()}); err != nil {
+		slog.Error("Webhook Service in CreateWebhookServ")
+		return models.Webhook{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Webhook Service in CreateWebhookServ")
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// GetWebhooksServ returns every webhook, oldest first, without secrets.
+func (s *WebhookServImpl) GetWebhooksServ() ([]models.Webhook, error) {
+	webhookMap, err := s.webhookRepo.GetWebhooksRepo()
+	if err != nil {
+		slog.Error("Webhook Service in GetWebhooksServ")
+		return nil, err
+	}
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range webhookMap {
+		webhooks = append(webhooks, webhook.Redacted())
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].ID < webhooks[j].ID
+	})
+
+	return webhooks, nil
+}
+
+func (s *WebhookServImpl) GetWebhookServ(id string) (models.Webhook, error) {
+	webhookMap, err := s.webhookRepo.GetWebhooksRepo()
+	if err != nil {
+		slog.Error("Webhook Service in GetWebhookServ")
+		return models.Webhook{}, err
+	}
+
+	webhook, exists := webhookMap[id]
+	if !exists {
+		slog.Error("Webhook Service in GetWebhookServ: doesn't exist")
+		return models.Webhook{}, fmt.Errorf("%w: webhook %s", customErrors.ErrNotExistConflict, id)
+	}
+
+	return webhook.Redacted(), nil
+}
+
+// UpdateWebhookServ replaces the URL, events and secret of a webhook. Without
+// a new secret the old one is kept.
+func (s *WebhookServImpl) UpdateWebhookServ(webhook models.Webhook) (models.Webhook, error) {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Webhook Service in UpdateWebhookServ")
+		return models.Webhook{}, err
+	}
+	defer tx.Rollback()
+
+	webhookMap, err := tx.GetWebhooksRepo()
+	if err != nil {
+		slog.Error("Webhook Service in UpdateWebhookServ")
+		return models.Webhook{}, err
+	}
+
+	old, exists := webhookMap[webhook.ID]
+	if !exists {
+		slog.Error("Webhook Service in UpdateWebhookServ: doesn't exist")
+		return models.Webhook{}, fmt.Errorf("%w: webhook %s", customErrors.ErrNotExistConflict, webhook.ID)
+	}
+
+	if webhook.Secret != "" {
+		if err := tx.SetWebhookSecretRepo(webhook.ID, webhook.Secret); err != nil {
+			slog.Error("Webhook Service in UpdateWebhookServ")
+			return models.Webhook{}, err
+		}
+	}
+	webhook = webhook.Redacted()
+	webhook.CreatedAt = old.CreatedAt
+	webhookMap[webhook.ID] = webhook
+	if err := tx.UpdateWebhooksRepo(webhookMap); err != nil {
+		slog.Error("Webhook Service in UpdateWebhookServ")
+		return models.Webhook{}, err
+	}
+
+	if err := tx.RecordEvent(models.EventWebhookUpdated, models.WebhookUpdated{Webhook: webhook}); err != nil {
+		slog.Error("Webhook Service in UpdateWebhookServ")
+		return models.Webhook{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Webhook Service in UpdateWebhookServ")
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// DeleteWebhookServ deletes a webhook. Deliveries still being retried for it
+// are given up.
+func (s *WebhookServImpl) DeleteWebhookServ(id string) error {
+	tx, err := s.uow.Begin()
+	if err != nil {
+		slog.Error("Webhook Service in DeleteWebhookServ")
+		return err
+	}
+	defer tx.Rollback()
+
+	webhookMap, err := tx.GetWebhooksRepo()
+	if err != nil {
+		slog.Error("Webhook Service in DeleteWebhookServ")
+		return err
+	}
+
+	if _, exists := webhookMap[id]; !exists {
+		slog.Error("Webhook Service in DeleteWebhookServ: doesn't exist")
+		return fmt.Errorf("%w: webhook %s", customErrors.ErrNotExistConflict, id)
+	}
+
+	delete(webhookMap, id)
+	if err := tx.UpdateWebhooksRepo(webhookMap); err != nil {
+		slog.Error("Webhook Service in DeleteWebhookServ")
+		return err
+	}
+	if err := tx.DeleteWebhookSecretRepo(id); err != nil {
+		slog.Error("Webhook Service in DeleteWebhookServ")
+		return err
+	}
+
+	if err := tx.RecordEvent(models.EventWebhookDeleted, models.WebhookDeleted{WebhookID: id}); err != nil {
+		slog.Error("Webhook Service in DeleteWebhookServ")
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetDeliveriesServ returns the deliveries to a webhook, newest first,
+// optionally only those with the given status.
+func (s *WebhookServImpl) GetDeliveriesServ(id, status string) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhookServ(id); err != nil {
+		return nil, err
+	}
+
+	all, err := s.deliveries.GetDeliveriesRepo()
+	if err != nil {
+		slog.Error("Webhook Service in GetDeliveriesServ")
+		return nil, err
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].WebhookID == id && (status == "" || all[i].Status == status) {
+			deliveries = append(deliveries, all[i])
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,541 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/models"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDeliveryAttempts is how many times a delivery is tried before it is
+	// given up as failed.
+	maxDeliveryAttempts = 8
+	// deliveryBackoff is the wait before the first retry; it doubles with
+	// every further retry, up to maxDeliveryBackoff.
+	deliveryBackoff    = 2 * time.Second
+	maxDeliveryBackoff = 10 * time.Minute
+	// deliveryTimeout bounds every attempt, reading the response included.
+	deliveryTimeout = 10 * time.Second
+	// maxErrorBody is how much of a failed response is kept as its error.
+	maxErrorBody = 256
+)
+
+type DispatcherWebhookRepo interface {
+	GetWebhooksRepo() (map[string]models.Webhook, error)
+	GetWebhookSecretRepo(id string) (string, bool, error)
+	GetDeliveredSeqsRepo() (map[string]int64, error)
+	SaveDeliveredSeqRepo(id string, seq int64) error
+}
+
+type DispatcherJournalRepo interface {
+	GetEventsAfterRepo(seq int64) ([]models.Event, error)
+}
+
+// WebhookDispatcher sends the order and inventory events of the journal to
+// the webhooks subscribed to them. Notify only queues the events of a commit,
+// so requests never wait for a receiver: a background worker turns them into
+// deliveries and hands them to the worker of their webhook, which signs and
+// posts them and retries failed ones with exponential backoff. A slow receiver
+// only holds up its own deliveries. The seq of the last event turned into
+// deliveries is saved for every webhook, so events still queued when the
+// server stops are read back from the journal when it starts, and so are the
+// deliveries still pending.
+type WebhookDispatcher struct {
+	webhookRepo DispatcherWebhookRepo
+	journalRepo DispatcherJournalRepo
+	deliveries  DeliveryLog
+	client      *http.Client
+
+	mu    sync.Mutex
+	inbox []models.Event
+	wake  chan struct{}
+
+	// workers are the delivery workers by webhook ID. Only the dispatching
+	// worker touches the map.
+	workers map[string]*deliveryWorker
+	running sync.WaitGroup
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// deliveryWorker makes the deliveries to one webhook, one at a time in the
+// order they were created.
+type deliveryWorker struct {
+	mu    sync.Mutex
+	queue []models.WebhookDelivery
+	wake  chan struct{}
+}
+
+func NewWebhookDispatcher(wR DispatcherWebhookRepo, jR DispatcherJournalRepo, deliveries DeliveryLog) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		webhookRepo: wR,
+		journalRepo: jR,
+		deliveries:  deliveries,
+		client:      &http.Client{Timeout: deliveryTimeout},
+		wake:        make(chan struct{}, 1),
+		workers:     make(map[string]*deliveryWorker),
+	}
+}
+
+// Notify queues the events of a commit for the worker. It never blocks, so
+// it can be registered with Store.OnCommit.
+func (d *WebhookDispatcher) Notify(events []models.Event) {
+	d.mu.Lock()
+	d.inbox = append(d.inbox, events...)
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the workers until Stop.
+func (d *WebhookDispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+	go d.run(ctx)
+}
+
+// Stop ends the workers, cutting short the deliveries in flight, and waits for
+// them. Events queued but not yet turned into deliveries are read again from
+// the journal on the next Start.
+func (d *WebhookDispatcher) Stop() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.done
+}
+
+// run turns events into deliveries until ctx is done, then waits for the
+// delivery workers.
+func (d *WebhookDispatcher) run(ctx context.Context) {
+	defer close(d.done)
+	defer d.running.Wait()
+
+	deliveries, err := d.deliveries.GetDeliveriesRepo()
+	if err != nil {
+		slog.Error("Webhook Dispatcher in run: loading deliveries", "error", err)
+	}
+	resumed := 0
+	for _, delivery := range deliveries {
+		if delivery.Status == models.DeliveryPending {
+			d.enqueue(ctx, delivery)
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		slog.Info("Webhook Dispatcher: resuming pending deliveries", "deliveries", resumed)
+	}
+
+	missed, err := d.missedEvents()
+	if err != nil {
+		slog.Error("Webhook Dispatcher in run: reading the journal", "error", err)
+	}
+	for _, delivery := range d.dispatch(missed) {
+		d.enqueue(ctx, delivery)
+	}
+
+	for {
+		for _, delivery := range d.dispatch(d.takeInbox()) {
+			d.enqueue(ctx, delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		}
+	}
+}
+
+// enqueue hands delivery to the worker of its webhook, starting the worker if
+// the webhook has none yet.
+func (d *WebhookDispatcher) enqueue(ctx context.Context, delivery models.WebhookDelivery) {
+	worker, exists := d.workers[delivery.WebhookID]
+	if !exists {
+		worker = &deliveryWorker{wake: make(chan struct{}, 1)}
+		d.workers[delivery.WebhookID] = worker
+		d.running.Add(1)
+		go func() {
+			defer d.running.Done()
+			d.deliver(ctx, worker)
+		}()
+	}
+
+	worker.mu.Lock()
+	worker.queue = append(worker.queue, delivery)
+	worker.mu.Unlock()
+
+	select {
+	case worker.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver makes the deliveries queued for worker until ctx is done.
+func (d *WebhookDispatcher) deliver(ctx context.Context, worker *deliveryWorker) {
+	// pending are the deliveries still to be made, in the order they were
+	// created, which is the order they are attempted in.
+	var pending []models.WebhookDelivery
+	for {
+		worker.mu.Lock()
+		pending = append(pending, worker.queue...)
+		worker.queue = nil
+		worker.mu.Unlock()
+
+		next := time.Time{}
+		left := pending[:0]
+		for _, delivery := range pending {
+			if ctx.Err() != nil {
+				return
+			}
+			if delivery.NextAttemptAt == nil || !time.Now().Before(*delivery.NextAttemptAt) {
+				delivery = d.attempt(ctx, delivery)
+				if ctx.Err() != nil {
+					// The attempt was cut short by Stop and is not counted.
+					return
+				}
+				if err := d.deliveries.SaveDeliveryRepo(delivery); err != nil {
+					slog.Error("Webhook Dispatcher in deliver: saving delivery", "deliveryID", delivery.ID, "error", err)
+				}
+				if delivery.Status != models.DeliveryPending {
+					continue
+				}
+			}
+
+			left = append(left, delivery)
+			if next.IsZero() || delivery.NextAttemptAt.Before(next) {
+				next = *delivery.NextAttemptAt
+			}
+		}
+		pending = left
+
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			retry = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-worker.wake:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// missedEvents returns the events of the journal after the oldest seq saved
+// for a webhook, which may not have been turned into deliveries yet.
+func (d *WebhookDispatcher) missedEvents() ([]models.Event, error) {
+	webhookMap, err := d.webhookRepo.GetWebhooksRepo()
+	if err != nil {
+		return nil, err
+	}
+	seqs, err := d.webhookRepo.GetDeliveredSeqsRepo()
+	if err != nil {
+		return nil, err
+	}
+
+	from := int64(-1)
+	for id := range webhookMap {
+		if seq, exists := seqs[id]; exists && (from < 0 || seq < from) {
+			from = seq
+		}
+	}
+	if from < 0 {
+		return nil, nil
+	}
+	return d.journalRepo.GetEventsAfterRepo(from)
+}
+
+// takeInbox returns the queued events and empties the queue.
+func (d *WebhookDispatcher) takeInbox() []models.Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	events := d.inbox
+	d.inbox = nil
+	return events
+}
+
+// dispatch turns events into deliveries to the webhooks subscribed to them,
+// skipping those a webhook already had, records the deliveries and moves the
+// seq of every webhook past the events. Only webhooks with a secret are sent
+// anything.
+func (d *WebhookDispatcher) dispatch(events []models.Event) []models.WebhookDelivery {
+	if len(events) == 0 {
+		return nil
+	}
+
+	webhookMap, err := d.webhookRepo.GetWebhooksRepo()
+	if err != nil {
+		slog.Error("Webhook Dispatcher in dispatch", "error", err)
+		return nil
+	}
+	seqs, err := d.webhookRepo.GetDeliveredSeqsRepo()
+	if err != nil {
+		slog.Error("Webhook Dispatcher in dispatch", "error", err)
+		return nil
+	}
+	var ids []string
+	for id := range webhookMap {
+		if _, exists := seqs[id]; exists {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var deliveries []models.WebhookDelivery
+	for _, event := range events {
+		payloads, err := d.payloads(event)
+		if err != nil {
+			slog.Error("Webhook Dispatcher in dispatch: reading event", "seq", event.Seq, "type", event.Type, "error", err)
+			continue
+		}
+
+		for _, id := range ids {
+			if event.Seq <= seqs[id] {
+				continue
+			}
+			seqs[id] = event.Seq
+
+			created := 0
+			for _, payload := range payloads {
+				if !webhookMap[id].Subscribes(payload.Event) {
+					continue
+				}
+				delivery, err := d.newDelivery(webhookMap[id], payload)
+				if err != nil {
+					slog.Error("Webhook Dispatcher in dispatch: creating delivery", "webhookID", id, "error", err)
+					continue
+				}
+				deliveries = append(deliveries, delivery)
+				created++
+			}
+			if created > 0 {
+				d.saveSeq(id, event.Seq)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		d.saveSeq(id, seqs[id])
+	}
+	return deliveries
+}
+
+func (d *WebhookDispatcher) saveSeq(id string, seq int64) {
+	if err := d.webhookRepo.SaveDeliveredSeqRepo(id, seq); err != nil {
+		slog.Error("Webhook Dispatcher in saveSeq", "webhookID", id, "seq", seq, "error", err)
+	}
+}
+
+func (d *WebhookDispatcher) newDelivery(webhook models.Webhook, payload models.WebhookPayload) (models.WebhookDelivery, error) {
+	id, err := d.deliveries.NewDeliveryIDRepo()
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	payload.ID = id
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery := models.WebhookDelivery{
+		ID:        id,
+		WebhookID: webhook.ID,
+		Event:     payload.Event,
+		URL:       webhook.URL,
+		Payload:   body,
+		Status:    models.DeliveryPending,
+		CreatedAt: time.Now(),
+	}
+	if err := d.deliveries.SaveDeliveryRepo(delivery); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// payloads returns the webhook events a journal event stands for, if any.
+func (d *WebhookDispatcher) payloads(event models.Event) ([]models.WebhookPayload, error) {
+	payload := func(name string, data any) models.WebhookPayload {
+		return models.WebhookPayload{Event: name, CreatedAt: event.Time, Data: data}
+	}
+
+	switch event.Type {
+	case models.EventOrderCreated:
+		data, err := decodeEvent[models.OrderCreated](event)
+		if err != nil {
+			return nil, err
+		}
+		return []models.WebhookPayload{payload(models.WebhookOrderCreated, data.Order)}, nil
+
+	case models.EventOrderStatusChanged:
+		data, err := decodeEvent[models.OrderStatusChanged](event)
+		if err != nil {
+			return nil, err
+		}
+		closed := data.Order
+		data.Order = nil
+		payloads := []models.WebhookPayload{payload(models.WebhookOrderStatusChanged, data)}
+		if data.To == models.StatusClosed && closed != nil {
+			payloads = append(payloads, payload(models.WebhookOrderClosed, models.NewOrderView(*closed)))
+		}
+		return payloads, nil
+
+	case models.EventInventoryCreated, models.EventInventoryUpdated:
+		// Both events carry the item the same way.
+		data, err := decodeEvent[models.InventoryItemUpdated](event)
+		if err != nil {
+			return nil, err
+		}
+		change := "updated"
+		if event.Type == models.EventInventoryCreated {
+			change = "created"
+		}
+		return []models.WebhookPayload{payload(models.WebhookInventoryChanged, models.InventoryChange{
+			IngredientID: data.InventoryItem.IngredientID,
+			Change:       change,
+			Quantity:     data.InventoryItem.Quantity,
+			Unit:         data.InventoryItem.Unit,
+		})}, nil
+
+	case models.EventInventoryAdjusted:
+		data, err := decodeEvent[models.InventoryAdjusted](event)
+		if err != nil {
+			return nil, err
+		}
+		return []models.WebhookPayload{payload(models.WebhookInventoryChanged, models.InventoryChange{
+			IngredientID: data.IngredientID,
+			Change:       "adjusted",
+			Delta:        data.Delta,
+			Quantity:     data.Quantity,
+			Unit:         data.Unit,
+			OrderID:      data.OrderID,
+		})}, nil
+
+	case models.EventInventoryDeleted:
+		data, err := decodeEvent[models.InventoryItemDeleted](event)
+		if err != nil {
+			return nil, err
+		}
+		return []models.WebhookPayload{payload(models.WebhookInventoryChanged, models.InventoryChange{
+			IngredientID: data.IngredientID,
+			Change:       "deleted",
+		})}, nil
+	}
+	return nil, nil
+}
+
+// attempt posts delivery once and returns it with the outcome: delivered on
+// a 2xx response, otherwise pending with the time of the next attempt, or
+// failed once it runs out of attempts or its webhook is gone.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) models.WebhookDelivery {
+	webhookMap, err := d.webhookRepo.GetWebhooksRepo()
+	if err != nil {
+		slog.Error("Webhook Dispatcher in attempt", "error", err)
+		next := time.Now().Add(deliveryBackoff)
+		delivery.NextAttemptAt = &next
+		return delivery
+	}
+	webhook, exists := webhookMap[delivery.WebhookID]
+	if !exists {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "the webhook was deleted"
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+	secret, exists, err := d.webhookRepo.GetWebhookSecretRepo(webhook.ID)
+	if err != nil {
+		slog.Error("Webhook Dispatcher in attempt", "error", err)
+		next := time.Now().Add(deliveryBackoff)
+		delivery.NextAttemptAt = &next
+		return delivery
+	}
+	if !exists {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "the webhook has no secret"
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+
+	now := time.Now()
+	delivery.URL = webhook.URL
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	err = d.post(ctx, webhook.URL, secret, &delivery, now)
+	if err == nil {
+		delivered := time.Now()
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &delivered
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= maxDeliveryAttempts {
+		slog.Warn("Webhook Dispatcher: giving up on delivery", "deliveryID", delivery.ID, "webhookID", webhook.ID, "attempts", delivery.Attempts, "error", err)
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+
+	backoff := min(deliveryBackoff<<(delivery.Attempts-1), maxDeliveryBackoff)
+	next := now.Add(backoff)
+	delivery.NextAttemptAt = &next
+	return delivery
+}
+
+// post sends the delivery to url signed with the webhook secret. The
+// X-HotCoffee-Signature header is "t=<unix seconds>,v1=<signature>".
+func (d *WebhookDispatcher) post(ctx context.Context, url, secret string, delivery *models.WebhookDelivery, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hot-coffee-webhooks")
+	req.Header.Set("X-HotCoffee-Event", delivery.Event)
+	req.Header.Set("X-HotCoffee-Delivery", delivery.ID)
+	req.Header.Set("X-HotCoffee-Signature", "t="+strconv.FormatInt(timestamp, 10)+",v1="+models.SignWebhook(secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	delivery.LastStatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+}